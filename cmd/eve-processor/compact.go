@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sheacloud/surithena/internal/settings"
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func compactCommand(args []string) {
+	flags := flag.NewFlagSet("compact", flag.ExitOnError)
+	location := flags.String("location", "", "s3://bucket/prefix or local directory containing the partitions to compact")
+	eventType := flags.String("event-type", "", "event type of the files, used to pick up per event type settings, inferred from the location when it's under a directory named after one")
+	targetSizeMB := flags.Int64("target-size-mb", 0, "target size of the merged files, defaults to file_target_size_mb")
+	sortByEventTime := flags.Bool("sort", false, "sort rows by event_time within each merged file")
+	dryRun := flags.Bool("dry-run", false, "log the files which would be merged without changing anything")
+	flags.Parse(args)
+
+	if *location == "" {
+		logrus.Fatal("-location is required")
+	}
+	// every per event type setting is read for the inferred event type, so compacting s3://bucket/flow uses the flow settings
+	tableEventType := *eventType
+	if tableEventType == "" {
+		tableEventType = inferEventType(*location)
+	}
+
+	targetSize := *targetSizeMB * 1024 * 1024
+	if targetSize == 0 {
+		targetSize = getFileTargetSize(tableEventType)
+	}
+
+	parquetOptions, err := getParquetOptions(tableEventType)
+	if err != nil {
+		logrus.Fatalf("invalid parquet options, %v", err)
+	}
+
+	uploadOptions, err := getUploadOptions(tableEventType)
+	if err != nil {
+		logrus.Fatalf("invalid upload options, %v", err)
+	}
+
+	store, prefix, err := storage.OpenObjectStore(*location, newS3Client(), uploadOptions)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if viper.GetString(settings.EventTypeKey(tableEventType, "table_format")) == "iceberg" {
+		// deleting files the table's manifests reference would break the table, which has to be compacted through Athena's OPTIMIZE instead
+		logrus.Warnf("skipping %s events as they're written to an Iceberg table", tableEventType)
+		return
+	}
+
+	groups, err := storage.Compact(store, prefix, storage.CompactionOptions{
+		TargetSize:      targetSize,
+		SortByEventTime: *sortByEventTime,
+		DryRun:          *dryRun,
+		ParquetOptions:  parquetOptions,
+		SensorName:      viper.GetString("sensor_name"),
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"groups":  len(groups),
+		"dry_run": *dryRun,
+	}).Info("finished compaction")
+}
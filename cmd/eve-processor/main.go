@@ -7,18 +7,26 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"path"
+	"strings"
 	"sync"
 	"syscall"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/oschwald/geoip2-golang"
+	"github.com/sheacloud/surithena/internal/settings"
 	"github.com/sheacloud/surithena/internal/storage"
 	"github.com/sheacloud/surithena/pkg/suricata"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+const (
+	defaultFileTargetSizeMB = 128
+)
+
 var (
 	EventModels = map[string]interface{}{
 		"alert": suricata.AlertEvent{},
@@ -56,6 +64,21 @@ func init() {
 
 	viper.BindEnv("s3_bucket_name")
 
+	viper.BindEnv("threat_intel_feeds")
+	viper.SetDefault("threat_intel_feeds", "")
+
+	viper.BindEnv("threat_intel_default_confidence")
+	viper.SetDefault("threat_intel_default_confidence", 50)
+
+	viper.BindEnv("public_suffix_list_path")
+	viper.SetDefault("public_suffix_list_path", "")
+
+	viper.BindEnv("ja3_labels_path")
+	viper.SetDefault("ja3_labels_path", "")
+
+	viper.BindEnv("community_id_seed")
+	viper.SetDefault("community_id_seed", 0)
+
 	viper.BindEnv("worker_threads")
 	viper.SetDefault("worker_threads", 10)
 
@@ -65,8 +88,214 @@ func init() {
 	viper.BindEnv("file_max_age_minutes")
 	viper.SetDefault("file_max_age_minutes", 15)
 
+	viper.BindEnv("sensor_name")
+	if hostname, err := os.Hostname(); err == nil {
+		viper.SetDefault("sensor_name", hostname)
+	}
+
+	viper.BindEnv("sensor_site")
+	viper.SetDefault("sensor_site", "")
+
+	viper.BindEnv("sensor_tags")
+	viper.SetDefault("sensor_tags", "")
+
+	// record the socket events arrived on in the sensor column
+	viper.BindEnv("sensor_record_source")
+	viper.SetDefault("sensor_record_source", false)
+
+	// partition_keys adds optional partitions after event_date and event_hour, one or more of event_minute, sensor_name, iface and vlan_id.
+	// Both can be overridden per event type, e.g. flow_partition_keys
+	viper.BindEnv("partition_keys")
+	viper.SetDefault("partition_keys", "")
+
+	viper.BindEnv("partition_minute_interval")
+	viper.SetDefault("partition_minute_interval", 15)
+
+	// retention_days can be overridden per event type, e.g. flow_retention_days, and 0 keeps data forever
+	viper.BindEnv("retention_days")
+	viper.SetDefault("retention_days", 0)
+
+	// file_target_size_mb and file_min_records can be overridden per event type, e.g. dhcp_file_min_records.
+	// file_target_size_mb has no default so the deprecated file_max_size_bytes it replaced can still be read, see getFileTargetSize
+	viper.BindEnv("file_target_size_mb")
+
 	viper.BindEnv("file_max_size_bytes")
-	viper.SetDefault("file_max_size_bytes", 2000)
+
+	viper.BindEnv("file_min_records")
+	viper.SetDefault("file_min_records", 0)
+
+	// output_formats is a comma separated list of parquet and ndjson, and can be overridden per event type, e.g. alert_output_formats=parquet,ndjson.
+	// ndjson files are written under ndjson_prefix so they're kept apart from the parquet files the Glue tables read
+	viper.BindEnv("output_formats")
+	viper.SetDefault("output_formats", storage.OutputFormatParquet)
+
+	// table_format is hive, for plain partitioned parquet files, or iceberg, where each parquet file is committed to an Iceberg table tracked by iceberg_catalog.
+	// Both can be overridden per event type. The glue catalog updates the <table_name_prefix><type>_events table in glue_database_name, which must be created as an Iceberg table first.
+	viper.BindEnv("table_format")
+	viper.SetDefault("table_format", "hive")
+
+	viper.BindEnv("iceberg_catalog")
+	viper.SetDefault("iceberg_catalog", "glue")
+
+	viper.BindEnv("glue_database_name")
+	viper.SetDefault("glue_database_name", "surithena")
+
+	viper.BindEnv("table_name_prefix")
+	viper.SetDefault("table_name_prefix", "")
+
+	viper.BindEnv("ndjson_compression")
+	viper.SetDefault("ndjson_compression", "gzip")
+
+	viper.BindEnv("ndjson_prefix")
+	viper.SetDefault("ndjson_prefix", "ndjson")
+
+	// s3_sse_kms_key_id encrypts every object with SSE-KMS using the key, which must be the key ARN when the bucket policy from the terraform-generator is used
+	viper.BindEnv("s3_sse_kms_key_id")
+	viper.SetDefault("s3_sse_kms_key_id", "")
+
+	viper.BindEnv("s3_bucket_key_enabled")
+	viper.SetDefault("s3_bucket_key_enabled", true)
+
+	// s3_tag_objects tags every object with its event_type and sensor, along with s3_object_tags, comma separated key=value pairs which can be overridden per event type, e.g. dns_s3_object_tags=classification=confidential
+	viper.BindEnv("s3_tag_objects")
+	viper.SetDefault("s3_tag_objects", false)
+
+	viper.BindEnv("s3_object_tags")
+	viper.SetDefault("s3_object_tags", "")
+
+	// each parquet setting can be overridden per event type, e.g. flow_parquet_compression_codec
+	viper.BindEnv("parquet_compression_codec")
+	viper.SetDefault("parquet_compression_codec", storage.DefaultCompressionCodec)
+
+	viper.BindEnv("parquet_row_group_size_bytes")
+	viper.SetDefault("parquet_row_group_size_bytes", storage.DefaultRowGroupSize)
+
+	viper.BindEnv("parquet_page_size_bytes")
+	viper.SetDefault("parquet_page_size_bytes", storage.DefaultPageSize)
+
+	viper.BindEnv("parquet_parallelism")
+	viper.SetDefault("parquet_parallelism", storage.DefaultParallelism)
+}
+
+func getParquetOptions(eventType string) (storage.ParquetOptions, error) {
+	codec, err := storage.ParseCompressionCodec(viper.GetString(settings.EventTypeKey(eventType, "parquet_compression_codec")))
+	if err != nil {
+		return storage.ParquetOptions{}, err
+	}
+	options := storage.ParquetOptions{
+		CompressionCodec: codec,
+		RowGroupSize:     viper.GetInt64(settings.EventTypeKey(eventType, "parquet_row_group_size_bytes")),
+		PageSize:         viper.GetInt64(settings.EventTypeKey(eventType, "parquet_page_size_bytes")),
+		Parallelism:      viper.GetInt64(settings.EventTypeKey(eventType, "parquet_parallelism")),
+	}
+	return options, options.Validate()
+}
+
+// getFileTargetSize returns the size in bytes to rotate the files of an event type at, falling back to file_max_size_bytes for deployments configured before file_target_size_mb
+func getFileTargetSize(eventType string) int64 {
+	targetSizeKey := settings.EventTypeKey(eventType, "file_target_size_mb")
+	if viper.IsSet(targetSizeKey) {
+		return viper.GetInt64(targetSizeKey) * 1024 * 1024
+	}
+	if viper.IsSet("file_max_size_bytes") {
+		return viper.GetInt64("file_max_size_bytes")
+	}
+	return defaultFileTargetSizeMB * 1024 * 1024
+}
+
+// warnDeprecatedSettings logs the settings which are still read but have been replaced
+func warnDeprecatedSettings() {
+	if viper.IsSet("file_max_size_bytes") {
+		logrus.WithFields(logrus.Fields{
+			"file_max_size_bytes": viper.GetInt64("file_max_size_bytes"),
+		}).Warn("file_max_size_bytes is deprecated and only used when file_target_size_mb isn't set, set file_target_size_mb instead")
+	}
+}
+
+// getUploadOptions returns the encryption and tags to upload the objects of an event type with
+func getUploadOptions(eventType string) (storage.UploadOptions, error) {
+	tags, err := storage.ParseObjectTags(viper.GetString(settings.EventTypeKey(eventType, "s3_object_tags")))
+	if err != nil {
+		return storage.UploadOptions{}, err
+	}
+	if viper.GetBool("s3_tag_objects") {
+		tags["event_type"] = eventType
+		tags["sensor"] = viper.GetString("sensor_name")
+	}
+	options := storage.UploadOptions{
+		KMSKeyID:         viper.GetString(settings.EventTypeKey(eventType, "s3_sse_kms_key_id")),
+		BucketKeyEnabled: viper.GetBool("s3_bucket_key_enabled"),
+		Tags:             tags,
+	}
+	return options, options.Validate()
+}
+
+// getOutputFormats returns the formats to write an event type in, along with the prefix to write each under
+func getOutputFormats(eventType string, cfg aws.Config, store storage.ObjectStore) (map[string]storage.OutputFormat, error) {
+	formats := map[string]storage.OutputFormat{}
+	for _, name := range strings.Split(viper.GetString(settings.EventTypeKey(eventType, "output_formats")), ",") {
+		switch strings.TrimSpace(name) {
+		case storage.OutputFormatParquet:
+			parquetOptions, err := getParquetOptions(eventType)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parquet options, %w", err)
+			}
+			switch viper.GetString(settings.EventTypeKey(eventType, "table_format")) {
+			case "hive":
+				formats[eventType] = storage.ParquetFormat{
+					Options: parquetOptions,
+				}
+			case "iceberg":
+				metadataPrefix := path.Join(eventType, "metadata")
+				var catalog storage.IcebergCatalog
+				switch viper.GetString(settings.EventTypeKey(eventType, "iceberg_catalog")) {
+				case "glue":
+					catalog = storage.NewGlueCatalog(cfg, viper.GetString("glue_database_name"), fmt.Sprintf("%s%s_events", viper.GetString("table_name_prefix"), eventType), metadataPrefix)
+				case "file":
+					catalog = storage.NewFileCatalog(store, metadataPrefix)
+				default:
+					return nil, fmt.Errorf("unknown iceberg catalog %s, expected one of glue, file", viper.GetString(settings.EventTypeKey(eventType, "iceberg_catalog")))
+				}
+				table := storage.NewIcebergTable(store, eventType, catalog, parquetOptions)
+				formats[table.DataPrefix()] = table
+			default:
+				return nil, fmt.Errorf("unknown table format %s, expected one of hive, iceberg", viper.GetString(settings.EventTypeKey(eventType, "table_format")))
+			}
+		case storage.OutputFormatNDJSON:
+			compression, err := storage.ParseNDJSONCompression(viper.GetString(settings.EventTypeKey(eventType, "ndjson_compression")))
+			if err != nil {
+				return nil, err
+			}
+			formats[path.Join(viper.GetString("ndjson_prefix"), eventType)] = storage.NDJSONFormat{
+				Compression: compression,
+			}
+		default:
+			return nil, fmt.Errorf("unknown output format %s, expected one of %s, %s", name, storage.OutputFormatParquet, storage.OutputFormatNDJSON)
+		}
+	}
+	return formats, nil
+}
+
+func getPartitionLayout(eventType string) (storage.PartitionLayout, error) {
+	return storage.ParsePartitionLayout(viper.GetString(settings.EventTypeKey(eventType, "partition_keys")), viper.GetInt(settings.EventTypeKey(eventType, "partition_minute_interval")), viper.GetString("sensor_name"))
+}
+
+func getSensorIdentity() *suricata.SensorIdentity {
+	identity := &suricata.SensorIdentity{
+		Name: viper.GetString("sensor_name"),
+		Site: viper.GetString("sensor_site"),
+		Tags: []string{},
+	}
+	identity.Hostname, _ = os.Hostname()
+	for _, tag := range strings.Split(viper.GetString("sensor_tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			identity.Tags = append(identity.Tags, tag)
+		}
+	}
+	if viper.GetBool("sensor_record_source") {
+		identity.Source = viper.GetString("eve_socket_path")
+	}
+	return identity
 }
 
 func serve(c net.Conn, outputChan chan<- string) {
@@ -81,20 +310,50 @@ func serve(c net.Conn, outputChan chan<- string) {
 	}
 }
 
-func main() {
-	stopChannel := make(chan struct{})
-	go signalHandler(stopChannel)
-
+func newAWSConfig() aws.Config {
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
 	if err != nil {
 		logrus.Fatalf("failed to load configuration, %v", err)
 	}
 
-	s3Client := s3.NewFromConfig(cfg)
+	return cfg
+}
 
-	if err != nil {
-		panic(err)
+func newS3Client() *s3.Client {
+	return s3.NewFromConfig(newAWSConfig())
+}
+
+func main() {
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
 	}
+
+	warnDeprecatedSettings()
+
+	switch command {
+	case "serve":
+		serveCommand()
+	case "compact":
+		compactCommand(os.Args[2:])
+	case "retention":
+		retentionCommand(os.Args[2:])
+	case "validate":
+		validateCommand(os.Args[2:])
+	case "read":
+		readCommand(os.Args[2:])
+	default:
+		logrus.Fatalf("unknown command %s, expected one of serve, compact, retention, validate, read", command)
+	}
+}
+
+func serveCommand() {
+	stopChannel := make(chan struct{})
+	go signalHandler(stopChannel)
+
+	cfg := newAWSConfig()
+	s3Client := s3.NewFromConfig(cfg)
+
 	l, err := net.Listen("unix", viper.GetString("eve_socket_path"))
 	if err != nil {
 		panic(err)
@@ -108,6 +367,43 @@ func main() {
 	}
 	defer mmdb.Close()
 
+	enrichers := &Enrichers{
+		GeoIP:           mmdb,
+		PublicSuffixes:  suricata.DefaultPublicSuffixList(),
+		CommunityIDSeed: uint16(viper.GetUint("community_id_seed")),
+		Sensor:          getSensorIdentity(),
+	}
+	if viper.GetString("public_suffix_list_path") != "" {
+		enrichers.PublicSuffixes, err = suricata.LoadPublicSuffixList(viper.GetString("public_suffix_list_path"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	if viper.GetString("ja3_labels_path") != "" {
+		enrichers.JA3Labels, err = suricata.LoadJA3Labels(viper.GetString("ja3_labels_path"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"labels": enrichers.JA3Labels.Len(),
+		}).Info("loaded ja3 labels")
+	}
+	if viper.GetString("threat_intel_feeds") != "" {
+		enrichers.ThreatIntel, err = suricata.LoadThreatIntelFeeds(strings.Split(viper.GetString("threat_intel_feeds"), ","), viper.GetInt("threat_intel_default_confidence"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"indicators": enrichers.ThreatIntel.Len(),
+		}).Info("loaded threat intel feeds")
+		for indicatorType, count := range enrichers.ThreatIntel.Skipped() {
+			logrus.WithFields(logrus.Fields{
+				"indicator_type": indicatorType,
+				"indicators":     count,
+			}).Warn("skipped threat intel indicators of a type no event field is matched against")
+		}
+	}
+
 	eveChannel := make(chan string)
 	go func() {
 		for {
@@ -119,9 +415,25 @@ func main() {
 		}
 	}()
 
-	writers := map[string]*storage.RotatingWriter{}
+	writers := map[string][]*storage.RotatingWriter{}
 	for name := range EventModels {
-		writers[name] = storage.NewRotatingWriter(s3Client, viper.GetString("s3_bucket_name"), name, viper.GetInt("file_timeout_minutes"), viper.GetInt("file_max_age_minutes"), viper.GetInt64("file_max_size_bytes"))
+		uploadOptions, err := getUploadOptions(name)
+		if err != nil {
+			logrus.Fatalf("invalid upload options for %s events, %v", name, err)
+		}
+		// a store per event type as the objects are tagged with it
+		store := storage.NewS3ObjectStore(s3Client, viper.GetString("s3_bucket_name"), uploadOptions)
+		outputFormats, err := getOutputFormats(name, cfg, store)
+		if err != nil {
+			logrus.Fatalf("invalid output formats for %s events, %v", name, err)
+		}
+		partitionLayout, err := getPartitionLayout(name)
+		if err != nil {
+			logrus.Fatalf("invalid partition layout for %s events, %v", name, err)
+		}
+		for prefix, outputFormat := range outputFormats {
+			writers[name] = append(writers[name], storage.NewRotatingWriter(store, prefix, viper.GetInt("file_timeout_minutes"), viper.GetInt("file_max_age_minutes"), getFileTargetSize(name), viper.GetInt64(settings.EventTypeKey(name, "file_min_records")), outputFormat, partitionLayout))
+		}
 	}
 
 	cancelChannels := []chan bool{}
@@ -131,7 +443,7 @@ func main() {
 		cancelChannels = append(cancelChannels, cancelCh)
 		workerWaitGroup.Add(1)
 		go func(cancelCh <-chan bool, workerNumber int) {
-			Worker(eveChannel, cancelCh, workerWaitGroup, workerNumber, mmdb, writers)
+			Worker(eveChannel, cancelCh, workerWaitGroup, workerNumber, enrichers, writers)
 		}(cancelCh, i)
 	}
 
@@ -149,12 +461,14 @@ func main() {
 
 	logrus.Info("worker threads have been stopped")
 
-	for _, writer := range writers {
-		err = writer.Close()
-		if err != nil {
-			fmt.Println(err)
+	for _, eventTypeWriters := range writers {
+		for _, writer := range eventTypeWriters {
+			err = writer.Close()
+			if err != nil {
+				fmt.Println(err)
+			}
 		}
 	}
 
-	logrus.Info("closed all S3 parquet writers")
+	logrus.Info("closed all S3 writers")
 }
@@ -11,7 +11,17 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func ProcessEveEvent(workerNumber int, event string, mmdb *geoip2.Reader, writers map[string]*storage.RotatingWriter) error {
+// Enrichers holds the shared, read-only state used to enrich events before they are written
+type Enrichers struct {
+	GeoIP           *geoip2.Reader
+	ThreatIntel     *suricata.ThreatIntelDB
+	PublicSuffixes  *suricata.PublicSuffixList
+	JA3Labels       *suricata.JA3Labels
+	CommunityIDSeed uint16
+	Sensor          *suricata.SensorIdentity
+}
+
+func ProcessEveEvent(workerNumber int, event string, enrichers *Enrichers, writers map[string][]*storage.RotatingWriter) error {
 	eveEvent := suricata.EveBase{}
 	err := json.Unmarshal([]byte(event), &eveEvent)
 	if err != nil {
@@ -75,17 +85,91 @@ func ProcessEveEvent(workerNumber int, event string, mmdb *geoip2.Reader, writer
 	if eventObject != nil {
 		geoIPModel, ok := eventObject.(suricata.GeoIPModel)
 		if ok {
-			err = geoIPModel.UpdateGeoIP(mmdb)
+			err = geoIPModel.UpdateGeoIP(enrichers.GeoIP)
 			if err != nil {
 				return err
 			}
 		}
 
-		eventObject.UpdateFields()
-		err = writers[eveEvent.EventType].Write(eventObject)
+		domainModel, ok := eventObject.(suricata.DomainModel)
+		if ok {
+			err = domainModel.UpdateDomainData(enrichers.PublicSuffixes)
+			if err != nil {
+				return err
+			}
+		}
+
+		if enrichers.JA3Labels != nil {
+			ja3Model, ok := eventObject.(suricata.JA3Model)
+			if ok {
+				err = ja3Model.UpdateJA3Labels(enrichers.JA3Labels)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if enrichers.ThreatIntel != nil {
+			threatIntelModel, ok := eventObject.(suricata.ThreatIntelModel)
+			if ok {
+				err = threatIntelModel.UpdateThreatIntel(enrichers.ThreatIntel)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		communityIDModel, ok := eventObject.(suricata.CommunityIDModel)
+		if ok {
+			// a missing community id shouldn't cause the whole event to be dropped
+			err = communityIDModel.UpdateCommunityID(enrichers.CommunityIDSeed)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"event_type": eveEvent.EventType,
+					"error":      err,
+				}).Warn("failed to compute community id")
+			}
+		}
+
+		httpParsingModel, ok := eventObject.(suricata.HTTPParsingModel)
+		if ok {
+			err = httpParsingModel.UpdateHTTPParsing()
+			if err != nil {
+				return err
+			}
+		}
+
+		certificateModel, ok := eventObject.(suricata.CertificateModel)
+		if ok {
+			// the event is still worth keeping without the validity fields of a malformed certificate
+			err = certificateModel.UpdateCertificateData()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"event_type": eveEvent.EventType,
+					"error":      err,
+				}).Warn("failed to parse certificate validity")
+			}
+		}
+
+		sensorModel, ok := eventObject.(suricata.SensorModel)
+		if ok {
+			err = sensorModel.UpdateSensorData(enrichers.Sensor)
+			if err != nil {
+				return err
+			}
+		}
+
+		// an event with an unparseable timestamp would be written with an event_time of 0, so it's dropped instead
+		err = eventObject.UpdateFields()
 		if err != nil {
-			fmt.Println(eveEvent.EventType, err)
-			return err
+			return fmt.Errorf("failed to update the fields of %s event, %w", eveEvent.EventType, err)
+		}
+		for _, writer := range writers[eveEvent.EventType] {
+			err = writer.Write(eventObject)
+			if err != nil {
+				fmt.Println(eveEvent.EventType, err)
+				return err
+			}
 		}
 	}
 	logrus.WithFields(logrus.Fields{
@@ -96,7 +180,7 @@ func ProcessEveEvent(workerNumber int, event string, mmdb *geoip2.Reader, writer
 	return nil
 }
 
-func Worker(eventChannel <-chan string, cancelChannel <-chan bool, workerWaitGroup *sync.WaitGroup, workerNum int, mmdb *geoip2.Reader, writers map[string]*storage.RotatingWriter) {
+func Worker(eventChannel <-chan string, cancelChannel <-chan bool, workerWaitGroup *sync.WaitGroup, workerNum int, enrichers *Enrichers, writers map[string][]*storage.RotatingWriter) {
 	logrus.Info("Started eve processor worker")
 InfiniteLoop:
 	for {
@@ -104,9 +188,12 @@ InfiniteLoop:
 		case <-cancelChannel:
 			break InfiniteLoop
 		case event := <-eventChannel:
-			err := ProcessEveEvent(workerNum, event, mmdb, writers)
+			err := ProcessEveEvent(workerNum, event, enrichers, writers)
 			if err != nil {
-				fmt.Println(err)
+				logrus.WithFields(logrus.Fields{
+					"worker_number": workerNum,
+					"error":         err,
+				}).Error("failed to process eve event")
 			}
 		}
 	}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+const (
+	// eveTimestampLayout is the layout of the timestamp of EVE records
+	eveTimestampLayout = "2006-01-02T15:04:05.000000-0700"
+	readBatchSize      = 1000
+)
+
+// whereFlags collects repeated -where path=value filters
+type whereFlags []string
+
+func (w *whereFlags) String() string {
+	return strings.Join(*w, ",")
+}
+
+func (w *whereFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%s should be path=value", value)
+	}
+	*w = append(*w, value)
+	return nil
+}
+
+// RecordFilter selects the rows dumped by read
+type RecordFilter struct {
+	// From and To bound event_time, including From and excluding To, and are ignored when zero
+	From time.Time
+	To   time.Time
+	// Where holds values which must be at dotted paths, matching any element of lists along the path
+	Where map[string]string
+}
+
+// Match returns whether the record passes the filter
+func (f RecordFilter) Match(record *storage.ParquetRecord) (bool, error) {
+	if !f.From.IsZero() || !f.To.IsZero() {
+		eventTime, ok := record.Values[storage.EventTimeColumn].(int64)
+		if !ok {
+			return false, fmt.Errorf("rows have no %s column to filter on", storage.EventTimeColumn)
+		}
+		if !f.From.IsZero() && eventTime < f.From.UnixMilli() {
+			return false, nil
+		}
+		if !f.To.IsZero() && eventTime >= f.To.UnixMilli() {
+			return false, nil
+		}
+	}
+	for path, expected := range f.Where {
+		matched := false
+		for _, value := range record.Lookup(path) {
+			if _, ok := value.(*storage.ParquetRecord); ok {
+				continue
+			}
+			if fmt.Sprint(value) == expected {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ToEVE adds the timestamp and event_type the processor routes and parses records by, so dumped rows can be replayed
+func ToEVE(record *storage.ParquetRecord, eventType string) {
+	if eventType != "" {
+		record.Prepend("event_type", eventType)
+	}
+	if eventTime, ok := record.Values[storage.EventTimeColumn].(int64); ok {
+		record.Prepend("timestamp", time.UnixMilli(eventTime).UTC().Format(eveTimestampLayout))
+	}
+}
+
+// parquetKeys returns the parquet file at prefix, or every visible parquet file under it in key order
+func parquetKeys(store storage.ObjectStore, prefix string) ([]string, error) {
+	if strings.HasSuffix(prefix, ".parquet") {
+		return []string{prefix}, nil
+	}
+	objects, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, object := range objects {
+		name := object.Key[strings.LastIndex(object.Key, "/")+1:]
+		if strings.HasSuffix(name, ".parquet") && !strings.HasPrefix(name, "_") && !strings.HasPrefix(name, ".") {
+			keys = append(keys, object.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// inferEventType returns the event type a file is stored under, from the last directory named after one, e.g. flow for s3://bucket/flow/event_date=2024-01-02/...
+func inferEventType(url string) string {
+	eventType := ""
+	for _, segment := range strings.Split(url, "/") {
+		if _, ok := EventModels[segment]; ok {
+			eventType = segment
+		}
+	}
+	return eventType
+}
+
+func parquetElementType(element *parquet.SchemaElement) string {
+	if element.Type == nil {
+		description := "group"
+		if element.ConvertedType != nil {
+			description += " " + element.ConvertedType.String()
+		}
+		return description
+	}
+	description := element.Type.String()
+	if element.ConvertedType != nil {
+		description += " " + element.ConvertedType.String()
+	}
+	return description
+}
+
+// printSchema prints the schema elements from index as an indented tree, returning the index after the element and its children
+func printSchema(writer io.Writer, schema []*parquet.SchemaElement, index, depth int) int {
+	element := schema[index]
+	fmt.Fprintf(writer, "  %s%s\t%s\t%s\n", strings.Repeat("  ", depth), element.Name, parquetElementType(element), element.GetRepetitionType())
+	index++
+	for i := int32(0); i < element.GetNumChildren(); i++ {
+		index = printSchema(writer, schema, index, depth+1)
+	}
+	return index
+}
+
+// InspectParquetFile prints the schema, key-value metadata and row group statistics of a parquet file
+func InspectParquetFile(output io.Writer, store storage.ObjectStore, key string) error {
+	file, err := storage.OpenParquetFile(store, key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	footer := file.Footer()
+
+	fmt.Fprintf(output, "%s\n", store.URL(key))
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "  rows\t%d\n", file.NumRows())
+	fmt.Fprintf(writer, "  row groups\t%d\n", len(footer.RowGroups))
+	fmt.Fprintf(writer, "  created by\t%s\n", footer.GetCreatedBy())
+	if version, ok := storage.ParquetSchemaVersion(footer.KeyValueMetadata); ok {
+		fmt.Fprintf(writer, "  schema version\t%d\n", version)
+	}
+	writer.Flush()
+
+	fmt.Fprintf(output, "\nkey-value metadata\n")
+	writer = tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	for _, keyValue := range footer.KeyValueMetadata {
+		fmt.Fprintf(writer, "  %s\t%s\n", keyValue.Key, keyValue.GetValue())
+	}
+	writer.Flush()
+
+	fmt.Fprintf(output, "\nschema\n")
+	writer = tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	schema := file.Schema()
+	for index := 1; index < len(schema); {
+		index = printSchema(writer, schema, index, 0)
+	}
+	writer.Flush()
+
+	for i, rowGroup := range footer.RowGroups {
+		fmt.Fprintf(output, "\nrow group %d: %d rows, %d bytes\n", i, rowGroup.NumRows, rowGroup.TotalByteSize)
+		writer = tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(writer, "  COLUMN\tCODEC\tVALUES\tNULLS\tMIN\tMAX\tCOMPRESSED\tUNCOMPRESSED\n")
+		for _, chunk := range rowGroup.Columns {
+			if chunk.MetaData == nil {
+				continue
+			}
+			path, element := file.ColumnPath(chunk)
+			nulls, min, max := "-", "-", "-"
+			if statistics := chunk.MetaData.Statistics; statistics != nil {
+				if statistics.NullCount != nil {
+					nulls = fmt.Sprint(*statistics.NullCount)
+				}
+				minValue, maxValue := statistics.MinValue, statistics.MaxValue
+				if minValue == nil {
+					minValue, maxValue = statistics.Min, statistics.Max
+				}
+				if minValue != nil {
+					min = storage.ParquetStatisticValue(element, minValue)
+				}
+				if maxValue != nil {
+					max = storage.ParquetStatisticValue(element, maxValue)
+				}
+			}
+			fmt.Fprintf(writer, "  %s\t%s\t%d\t%s\t%s\t%s\t%d\t%d\n", path, chunk.MetaData.Codec, chunk.MetaData.NumValues, nulls, min, max, chunk.MetaData.TotalCompressedSize, chunk.MetaData.TotalUncompressedSize)
+		}
+		writer.Flush()
+	}
+	return nil
+}
+
+// DumpParquetFile writes the rows of a parquet file which pass the filter as EVE-like JSON lines, returning how many were written. A limit of 0 writes every row.
+func DumpParquetFile(output io.Writer, store storage.ObjectStore, key, eventType string, filter RecordFilter, limit int) (int, error) {
+	file, err := storage.OpenParquetFile(store, key)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(output)
+	encoder.SetEscapeHTML(false)
+	written := 0
+	for remaining := file.NumRows(); remaining > 0; {
+		records, err := file.Read(readBatchSize)
+		if err != nil {
+			return written, err
+		}
+		if len(records) == 0 {
+			break
+		}
+		remaining -= int64(len(records))
+		for _, record := range records {
+			matched, err := filter.Match(record)
+			if err != nil {
+				return written, err
+			}
+			if !matched {
+				continue
+			}
+			ToEVE(record, eventType)
+			err = encoder.Encode(record)
+			if err != nil {
+				return written, err
+			}
+			written++
+			if limit > 0 && written >= limit {
+				return written, nil
+			}
+		}
+	}
+	return written, nil
+}
+
+func readCommand(args []string) {
+	flags := flag.NewFlagSet("read", flag.ExitOnError)
+	location := flags.String("location", "", "s3://bucket/key or local path of a parquet file, or a prefix or directory to read every parquet file under")
+	rows := flags.Bool("rows", false, "write the rows as EVE-like JSON lines rather than printing the schema, metadata and row group statistics")
+	eventType := flags.String("event-type", "", "event type to set on the rows, inferred from the location when it's under a directory named after one")
+	from := flags.String("from", "", "only write rows with an event_time at or after this RFC 3339 time")
+	to := flags.String("to", "", "only write rows with an event_time before this RFC 3339 time")
+	limit := flags.Int("limit", 0, "stop after writing this many rows")
+	where := whereFlags{}
+	flags.Var(&where, "where", "only write rows with this value at a dotted path, e.g. http.hostname=example.com, can be repeated")
+	flags.Parse(args)
+
+	if *location == "" {
+		logrus.Fatal("-location is required")
+	}
+	filter := RecordFilter{
+		Where: map[string]string{},
+	}
+	var err error
+	if *from != "" {
+		filter.From, err = time.Parse(time.RFC3339, *from)
+		if err != nil {
+			logrus.Fatalf("invalid -from, %v", err)
+		}
+	}
+	if *to != "" {
+		filter.To, err = time.Parse(time.RFC3339, *to)
+		if err != nil {
+			logrus.Fatalf("invalid -to, %v", err)
+		}
+	}
+	for _, condition := range where {
+		parts := strings.SplitN(condition, "=", 2)
+		filter.Where[parts[0]] = parts[1]
+	}
+
+	store, prefix, err := storage.OpenObjectStore(*location, newS3Client(), storage.UploadOptions{})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	keys, err := parquetKeys(store, prefix)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if len(keys) == 0 {
+		logrus.Fatalf("no parquet files at %s", *location)
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	defer output.Flush()
+	written := 0
+	for i, key := range keys {
+		if !*rows {
+			if i > 0 {
+				fmt.Fprintln(output)
+			}
+			err = InspectParquetFile(output, store, key)
+			if err != nil {
+				output.Flush()
+				logrus.Fatalf("failed to read %s, %v", store.URL(key), err)
+			}
+			continue
+		}
+
+		fileEventType := *eventType
+		if fileEventType == "" {
+			fileEventType = inferEventType(store.URL(key))
+		}
+		remaining := 0
+		if *limit > 0 {
+			remaining = *limit - written
+		}
+		count, err := DumpParquetFile(output, store, key, fileEventType, filter, remaining)
+		written += count
+		if err != nil {
+			output.Flush()
+			logrus.Fatalf("failed to read %s, %v", store.URL(key), err)
+		}
+		if *limit > 0 && written >= *limit {
+			break
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sheacloud/surithena/internal/settings"
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func retentionCommand(args []string) {
+	flags := flag.NewFlagSet("retention", flag.ExitOnError)
+	location := flags.String("location", "", "s3://bucket/prefix or local directory containing a directory per event type, defaults to s3://$S3_BUCKET_NAME")
+	eventTypes := flags.String("event-types", "", "comma separated event types to expire, defaults to all of them")
+	auditLogPath := flags.String("audit-log", "", "file to append a JSON line to for every expired partition")
+	interval := flags.Duration("interval", 0, "keep running and enforce retention at this interval, e.g. 24h")
+	dryRun := flags.Bool("dry-run", false, "log the partitions which would be deleted without deleting them")
+	flags.Parse(args)
+
+	if *location == "" {
+		if viper.GetString("s3_bucket_name") == "" {
+			logrus.Fatal("-location or S3_BUCKET_NAME is required")
+		}
+		*location = "s3://" + viper.GetString("s3_bucket_name")
+	}
+
+	names := []string{}
+	if *eventTypes != "" {
+		names = strings.Split(*eventTypes, ",")
+	} else {
+		for name := range EventModels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var auditLog io.Writer
+	if *auditLogPath != "" {
+		f, err := os.OpenFile(*auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer f.Close()
+		auditLog = f
+	}
+
+	store, prefix, err := storage.OpenObjectStore(*location, newS3Client(), storage.UploadOptions{})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	for {
+		for _, name := range names {
+			retentionDays := viper.GetInt(settings.EventTypeKey(name, "retention_days"))
+			for _, typePrefix := range getRetentionPrefixes(prefix, name) {
+				expired, err := storage.EnforceRetention(store, typePrefix, storage.RetentionOptions{
+					RetentionDays: retentionDays,
+					Now:           time.Now().UTC(),
+					DryRun:        *dryRun,
+					AuditLog:      auditLog,
+				})
+				if err != nil {
+					logrus.Errorf("failed to enforce retention for %s events under %s, %v", name, store.URL(typePrefix), err)
+					continue
+				}
+				logrus.WithFields(logrus.Fields{
+					"event_type":     name,
+					"location":       store.URL(typePrefix),
+					"retention_days": retentionDays,
+					"expired":        len(expired),
+					"dry_run":        *dryRun,
+				}).Info("enforced retention")
+			}
+		}
+
+		if *interval == 0 {
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// getRetentionPrefixes returns the prefixes under prefix which hold the event_date partitions of an event type, the parquet files and, when enabled, the ndjson files
+func getRetentionPrefixes(prefix, eventType string) []string {
+	prefixes := []string{}
+	if viper.GetString(settings.EventTypeKey(eventType, "table_format")) == "iceberg" {
+		// deleting files would break the table, which has to be expired through Athena instead
+		logrus.Warnf("skipping the parquet files of %s events as they're written to an Iceberg table", eventType)
+	} else {
+		prefixes = append(prefixes, path.Join(prefix, eventType))
+	}
+	for _, name := range strings.Split(viper.GetString(settings.EventTypeKey(eventType, "output_formats")), ",") {
+		if strings.TrimSpace(name) == storage.OutputFormatNDJSON {
+			prefixes = append(prefixes, path.Join(prefix, viper.GetString("ndjson_prefix"), eventType))
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sheacloud/surithena/pkg/suricata"
+	"github.com/sirupsen/logrus"
+)
+
+// validationProblem counts the events of one event type which had the same problem, keeping the first value or error as an example
+type validationProblem struct {
+	Count   int
+	Example string
+}
+
+// eventTypeValidation is what validate found in the events of one event type
+type eventTypeValidation struct {
+	Events         int
+	Modeled        bool
+	UnmodeledKeys  map[string]*validationProblem
+	TypeMismatches map[string]*validationProblem
+	FieldErrors    map[string]*validationProblem
+}
+
+func (v *eventTypeValidation) problems() int {
+	return len(v.TypeMismatches) + len(v.FieldErrors)
+}
+
+func addProblem(problems map[string]*validationProblem, key, example string) {
+	problem, ok := problems[key]
+	if !ok {
+		problem = &validationProblem{
+			Example: example,
+		}
+		problems[key] = problem
+	}
+	problem.Count++
+}
+
+// jsonField returns the field of a struct type a JSON key is decoded into, matching names case insensitively as encoding/json does
+func jsonField(structType reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if name == key {
+			return field, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = &field
+		}
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonKind describes a JSON value for type mismatches, e.g. string or number
+func jsonKind(raw json.RawMessage) string {
+	trimmed := strings.TrimSpace(string(raw))
+	switch {
+	case trimmed == "":
+		return "nothing"
+	case trimmed == "null":
+		return "null"
+	case trimmed == "true" || trimmed == "false":
+		return "boolean"
+	case trimmed[0] == '"':
+		return "string"
+	case trimmed[0] == '{':
+		return "object"
+	case trimmed[0] == '[':
+		return "array"
+	}
+	return "number"
+}
+
+// exampleValue shortens a JSON value to be printed as an example
+func exampleValue(raw json.RawMessage) string {
+	value := strings.TrimSpace(string(raw))
+	if len(value) > 40 {
+		value = value[:37] + "..."
+	}
+	return value
+}
+
+// validateJSON walks a JSON value alongside the Go type it's decoded into, recording keys with no field and values json.Unmarshal would reject.
+// Arrays are named with [] and map values with {value}, as schema check names them.
+func (v *eventTypeValidation) validateJSON(raw json.RawMessage, valueType reflect.Type, path string) {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if jsonKind(raw) == "null" {
+		return
+	}
+
+	mismatch := func() {
+		addProblem(v.TypeMismatches, fmt.Sprintf("%s: %s for %s", path, jsonKind(raw), valueType), exampleValue(raw))
+	}
+	switch valueType.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.Struct:
+		object := map[string]json.RawMessage{}
+		if json.Unmarshal(raw, &object) != nil {
+			mismatch()
+			return
+		}
+		for key, value := range object {
+			name := key
+			if path != "" {
+				name = path + "." + key
+			}
+			field, ok := jsonField(valueType, key)
+			if !ok {
+				addProblem(v.UnmodeledKeys, name, exampleValue(value))
+				continue
+			}
+			v.validateJSON(value, field.Type, name)
+		}
+	case reflect.Slice, reflect.Array:
+		if valueType.Elem().Kind() == reflect.Uint8 && jsonKind(raw) == "string" {
+			return
+		}
+		elements := []json.RawMessage{}
+		if json.Unmarshal(raw, &elements) != nil {
+			mismatch()
+			return
+		}
+		for _, element := range elements {
+			v.validateJSON(element, valueType.Elem(), path+"[]")
+		}
+	case reflect.Map:
+		object := map[string]json.RawMessage{}
+		if json.Unmarshal(raw, &object) != nil {
+			mismatch()
+			return
+		}
+		for _, value := range object {
+			v.validateJSON(value, valueType.Elem(), path+"{value}")
+		}
+	default:
+		if json.Unmarshal(raw, reflect.New(valueType).Interface()) != nil {
+			mismatch()
+		}
+	}
+}
+
+// ValidateEvents reads EVE JSON lines, checking each event against the model of its event type without enriching or writing it.
+// Lines which aren't JSON objects are counted under an empty event type.
+func ValidateEvents(input io.Reader) (map[string]*eventTypeValidation, error) {
+	results := map[string]*eventTypeValidation{}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		eveEvent := suricata.EveBase{}
+		err := json.Unmarshal(line, &eveEvent)
+		result, ok := results[eveEvent.EventType]
+		if !ok {
+			result = &eventTypeValidation{
+				UnmodeledKeys:  map[string]*validationProblem{},
+				TypeMismatches: map[string]*validationProblem{},
+				FieldErrors:    map[string]*validationProblem{},
+			}
+			results[eveEvent.EventType] = result
+		}
+		result.Events++
+		if err != nil {
+			addProblem(result.FieldErrors, "invalid JSON", err.Error())
+			continue
+		}
+
+		model, ok := EventModels[eveEvent.EventType]
+		if !ok {
+			continue
+		}
+		result.Modeled = true
+		modelType := reflect.TypeOf(model)
+		result.validateJSON(line, modelType, "")
+
+		// json.Unmarshal skips the fields it can't decode, so the rest of the event can still be checked by UpdateFields
+		eventObject := reflect.New(modelType).Interface()
+		json.Unmarshal(line, eventObject)
+		rotatable, ok := eventObject.(storage.Rotatable)
+		if !ok {
+			continue
+		}
+		err = rotatable.UpdateFields()
+		if err != nil {
+			addProblem(result.FieldErrors, err.Error(), "")
+		}
+		if certificateModel, ok := eventObject.(suricata.CertificateModel); ok {
+			err = certificateModel.UpdateCertificateData()
+			if err != nil {
+				addProblem(result.FieldErrors, err.Error(), "")
+			}
+		}
+	}
+	return results, scanner.Err()
+}
+
+// sortedProblems returns the keys of problems, the most frequent first
+func sortedProblems(problems map[string]*validationProblem) []string {
+	keys := []string{}
+	for key := range problems {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if problems[keys[i]].Count != problems[keys[j]].Count {
+			return problems[keys[i]].Count > problems[keys[j]].Count
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func validateCommand(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "exit with an error on keys the models don't have, not only on type mismatches and field errors")
+	flags.Parse(args)
+
+	input := io.Reader(os.Stdin)
+	if len(flags.Args()) > 0 {
+		readers := []io.Reader{}
+		for _, filename := range flags.Args() {
+			file, err := os.Open(filename)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			defer file.Close()
+			// a file without a trailing newline shouldn't run into the first line of the next
+			readers = append(readers, file, strings.NewReader("\n"))
+		}
+		input = io.MultiReader(readers...)
+	}
+
+	results, err := ValidateEvents(input)
+	if err != nil {
+		logrus.Fatalf("failed to read events, %v", err)
+	}
+
+	eventTypes := []string{}
+	for eventType := range results {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "EVENT TYPE\tEVENTS\tMODELED\tUNMODELED KEYS\tTYPE MISMATCHES\tFIELD ERRORS\n")
+	problems := 0
+	unmodeled := 0
+	for _, eventType := range eventTypes {
+		result := results[eventType]
+		modeled := "no"
+		if result.Modeled {
+			modeled = "yes"
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%d\t%d\t%d\n", valueOrNone(eventType), result.Events, modeled, len(result.UnmodeledKeys), len(result.TypeMismatches), len(result.FieldErrors))
+		problems += result.problems()
+		unmodeled += len(result.UnmodeledKeys)
+	}
+	writer.Flush()
+
+	for _, eventType := range eventTypes {
+		result := results[eventType]
+		if len(result.UnmodeledKeys)+result.problems() == 0 {
+			continue
+		}
+		fmt.Printf("\n%s\n", valueOrNone(eventType))
+		writer = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, key := range sortedProblems(result.UnmodeledKeys) {
+			fmt.Fprintf(writer, "  unmodeled key\t%s\t%d events\te.g. %s\n", key, result.UnmodeledKeys[key].Count, result.UnmodeledKeys[key].Example)
+		}
+		for _, key := range sortedProblems(result.TypeMismatches) {
+			fmt.Fprintf(writer, "  type mismatch\t%s\t%d events\te.g. %s\n", key, result.TypeMismatches[key].Count, result.TypeMismatches[key].Example)
+		}
+		for _, key := range sortedProblems(result.FieldErrors) {
+			fmt.Fprintf(writer, "  field error\t%s\t%d events\t%s\n", key, result.FieldErrors[key].Count, result.FieldErrors[key].Example)
+		}
+		writer.Flush()
+	}
+
+	if problems > 0 || (*strict && unmodeled > 0) {
+		os.Exit(1)
+	}
+}
+
+func valueOrNone(eventType string) string {
+	if eventType == "" {
+		return "(none)"
+	}
+	return eventType
+}
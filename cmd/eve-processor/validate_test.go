@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const validFlowEvent = `{"timestamp":"2024-01-02T03:04:05.123456+0000","flow_id":1234,"event_type":"flow","src_ip":"10.0.0.1","src_port":51234,"dest_ip":"10.0.0.2","dest_port":53,"proto":"UDP","app_proto":"dns","flow":{"pkts_toserver":1,"pkts_toclient":1,"bytes_toserver":74,"bytes_toclient":90,"start":"2024-01-02T03:04:00.000000+0000","end":"2024-01-02T03:04:01.000000+0000","age":1,"state":"established","reason":"timeout","alerted":false}}`
+
+func problemKeys(problems map[string]*validationProblem) []string {
+	keys := []string{}
+	for key := range problems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestValidateEvents(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		eventType      string
+		events         int
+		modeled        bool
+		unmodeledKeys  []string
+		typeMismatches []string
+		fieldErrors    []string
+	}{
+		{
+			name:      "valid",
+			input:     validFlowEvent,
+			eventType: "flow",
+			events:    1,
+			modeled:   true,
+		},
+		{
+			name:      "blank lines skipped",
+			input:     "\n" + validFlowEvent + "\n  \n" + validFlowEvent + "\n",
+			eventType: "flow",
+			events:    2,
+			modeled:   true,
+		},
+		{
+			name:      "vlan tagged",
+			input:     strings.Replace(validFlowEvent, `"flow_id":1234,`, `"flow_id":1234,"vlan":[100,200],`, 1),
+			eventType: "flow",
+			events:    1,
+			modeled:   true,
+		},
+		{
+			name:          "unmodeled keys",
+			input:         strings.Replace(validFlowEvent, `"flow":{`, `"host":"sensor-1","flow":{"emergency":false,`, 1),
+			eventType:     "flow",
+			events:        1,
+			modeled:       true,
+			unmodeledKeys: []string{"flow.emergency"},
+		},
+		{
+			name:           "type mismatch",
+			input:          strings.Replace(validFlowEvent, `"src_port":51234`, `"src_port":"51234"`, 1),
+			eventType:      "flow",
+			events:         1,
+			modeled:        true,
+			typeMismatches: []string{"src_port: string for int"},
+		},
+		{
+			name:      "null for an optional field",
+			input:     strings.Replace(validFlowEvent, `"src_port":51234`, `"src_port":null`, 1),
+			eventType: "flow",
+			events:    1,
+			modeled:   true,
+		},
+		{
+			name:        "invalid timestamp",
+			input:       strings.Replace(validFlowEvent, "2024-01-02T03:04:05.123456+0000", "2024-01-02T03:04:05", 1),
+			eventType:   "flow",
+			events:      1,
+			modeled:     true,
+			fieldErrors: []string{`parsing time "2024-01-02T03:04:05" as "2006-01-02T15:04:05.999999-0700": cannot parse "" as "-0700"`},
+		},
+		{
+			name:        "invalid certificate",
+			input:       `{"timestamp":"2024-01-02T03:04:05.000000+0000","event_type":"tls","src_ip":"10.0.0.1","dest_ip":"10.0.0.2","proto":"TCP","tls":{"version":"TLS 1.2","notbefore":"2024-01-01","notafter":"2025-01-01T00:00:00"}}`,
+			eventType:   "tls",
+			events:      1,
+			modeled:     true,
+			fieldErrors: []string{`parsing time "2024-01-01" as "2006-01-02T15:04:05": cannot parse "" as "T"`},
+		},
+		{
+			name:      "unmodeled event type",
+			input:     `{"timestamp":"2024-01-02T03:04:05.000000+0000","event_type":"anomaly","anomaly":{"type":"decode"}}`,
+			eventType: "anomaly",
+			events:    1,
+		},
+		{
+			name:        "invalid JSON",
+			input:       `{"event_type":"flow"`,
+			eventType:   "",
+			events:      1,
+			fieldErrors: []string{"invalid JSON"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := ValidateEvents(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("results for %d event types, expected 1", len(results))
+			}
+			result, ok := results[test.eventType]
+			if !ok {
+				t.Fatalf("no results for event type %q", test.eventType)
+			}
+			if result.Events != test.events || result.Modeled != test.modeled {
+				t.Errorf("%d events modeled %v, expected %d modeled %v", result.Events, result.Modeled, test.events, test.modeled)
+			}
+			for _, check := range []struct {
+				kind     string
+				problems map[string]*validationProblem
+				expected []string
+			}{
+				{kind: "unmodeled keys", problems: result.UnmodeledKeys, expected: test.unmodeledKeys},
+				{kind: "type mismatches", problems: result.TypeMismatches, expected: test.typeMismatches},
+				{kind: "field errors", problems: result.FieldErrors, expected: test.fieldErrors},
+			} {
+				expected := check.expected
+				if expected == nil {
+					expected = []string{}
+				}
+				if keys := problemKeys(check.problems); !reflect.DeepEqual(keys, expected) {
+					t.Errorf("%s are %q, expected %q", check.kind, keys, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// athenaString quotes a string literal for Athena DDL, which escapes with backslashes
+func athenaString(value string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", `\'`) + "'"
+}
+
+func athenaIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func athenaColumns(columns []Columns) string {
+	lines := []string{}
+	for _, column := range columns {
+		line := fmt.Sprintf("  %s %s", athenaIdentifier(column.Name), column.Type)
+		if column.Comment != "" {
+			line += " COMMENT " + athenaString(column.Comment)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, ",\n")
+}
+
+func athenaProperties(properties map[string]string) string {
+	keys := []string{}
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := []string{}
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("  %s=%s", athenaString(key), athenaString(properties[key])))
+	}
+	return strings.Join(lines, ",\n")
+}
+
+// GenerateAthenaDDL returns the CREATE TABLE statement for the table. Hive tables are external tables using partition projection, while Iceberg tables are created by Athena itself.
+func GenerateAthenaDDL(table GlueCatalogTable, database string) string {
+	name := fmt.Sprintf("%s.%s", athenaIdentifier(database), athenaIdentifier(table.Name))
+	ddl := &strings.Builder{}
+
+	if table.OpenTableFormatInput != nil {
+		properties := map[string]string{}
+		for key, value := range table.Parameters {
+			properties[key] = value
+		}
+		properties["format"] = "parquet"
+		fmt.Fprintf(ddl, "CREATE TABLE IF NOT EXISTS %s (\n%s\n)\n", name, athenaColumns(table.StorageDescriptor.Columns))
+		fmt.Fprintf(ddl, "LOCATION %s\n", athenaString(table.StorageDescriptor.Location))
+		fmt.Fprintf(ddl, "TBLPROPERTIES (\n%s\n);\n", athenaProperties(properties))
+		return ddl.String()
+	}
+
+	fmt.Fprintf(ddl, "CREATE EXTERNAL TABLE IF NOT EXISTS %s (\n%s\n)\n", name, athenaColumns(table.StorageDescriptor.Columns))
+	if len(table.PartitionKeys) > 0 {
+		partitionKeys := []Columns{}
+		for _, key := range table.PartitionKeys {
+			partitionKeys = append(partitionKeys, Columns{
+				Name: key.Name,
+				Type: key.Type,
+			})
+		}
+		fmt.Fprintf(ddl, "PARTITIONED BY (\n%s\n)\n", athenaColumns(partitionKeys))
+	}
+	fmt.Fprintf(ddl, "ROW FORMAT SERDE %s\n", athenaString(table.StorageDescriptor.SerDeInfo.SerializationLibrary))
+	if len(table.StorageDescriptor.SerDeInfo.Parameters) > 0 {
+		fmt.Fprintf(ddl, "WITH SERDEPROPERTIES (\n%s\n)\n", athenaProperties(table.StorageDescriptor.SerDeInfo.Parameters))
+	}
+	fmt.Fprintf(ddl, "STORED AS INPUTFORMAT %s\nOUTPUTFORMAT %s\n", athenaString(table.StorageDescriptor.InputFormat), athenaString(table.StorageDescriptor.OutputFormat))
+	fmt.Fprintf(ddl, "LOCATION %s\n", athenaString(table.StorageDescriptor.Location))
+	fmt.Fprintf(ddl, "TBLPROPERTIES (\n%s\n);\n", athenaProperties(table.Parameters))
+	return ddl.String()
+}
+
+// WriteAthenaDDL writes athena/<event type>.sql per table, each a statement which can be run as is in the Athena console
+func WriteAthenaDDL(tables []GlueCatalogTable) error {
+	if viper.GetString("s3_bucket_name") == "" {
+		return fmt.Errorf("S3_BUCKET_NAME is required for the %s output", OutputModeDDL)
+	}
+	err := os.MkdirAll(outputPath("athena"), 0755)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		ddl := GenerateAthenaDDL(table, viper.GetString("glue_database_name"))
+		err = os.WriteFile(outputPath("athena", table.EventName+".sql"), []byte(ddl), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/viper"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// queries holds the SQL templates shipped as Athena named queries, and as Glue views when their header says so
+//
+//go:embed queries/*.sql
+var queries embed.FS
+
+// QueryTemplate is a SQL template from queries/. Its header is a block of -- key: value comments:
+// description is the description of the named query, view: true also creates it as a view, and each column: <name> <type> declares a column of the view
+type QueryTemplate struct {
+	Name        string
+	Description string
+	View        bool
+	Columns     []Columns
+	SQL         string
+}
+
+// ParseQueryTemplate reads the header of a SQL template, leaving the template itself in SQL
+func ParseQueryTemplate(name, text string) (QueryTemplate, error) {
+	query := QueryTemplate{
+		Name: name,
+	}
+	lines := strings.Split(text, "\n")
+	index := 0
+	for ; index < len(lines); index++ {
+		line := strings.TrimSpace(lines[index])
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		key, value, ok := cutString(strings.TrimSpace(strings.TrimPrefix(line, "--")), ":")
+		if !ok {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "description":
+			query.Description = value
+		case "view":
+			query.View = value == "true"
+		case "column":
+			fields := strings.Fields(value)
+			if len(fields) != 2 {
+				return QueryTemplate{}, fmt.Errorf("%s: column should be <name> <type>, got %s", name, value)
+			}
+			query.Columns = append(query.Columns, Columns{
+				Name: fields[0],
+				Type: fields[1],
+			})
+		default:
+			return QueryTemplate{}, fmt.Errorf("%s: unknown header %s", name, key)
+		}
+	}
+	query.SQL = strings.TrimSpace(strings.Join(lines[index:], "\n"))
+	if query.View && len(query.Columns) == 0 {
+		return QueryTemplate{}, fmt.Errorf("%s: views must declare their columns", name)
+	}
+	return query, nil
+}
+
+func cutString(s, separator string) (string, string, bool) {
+	index := strings.Index(s, separator)
+	if index < 0 {
+		return s, "", false
+	}
+	return s[:index], s[index+len(separator):], true
+}
+
+// LoadQueryTemplates returns the templates in queries/, sorted by name
+func LoadQueryTemplates() ([]QueryTemplate, error) {
+	filenames, err := queries.ReadDir("queries")
+	if err != nil {
+		return nil, err
+	}
+	templates := []QueryTemplate{}
+	for _, file := range filenames {
+		data, err := queries.ReadFile(path.Join("queries", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		query, err := ParseQueryTemplate(strings.TrimSuffix(file.Name(), ".sql"), string(data))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, query)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// RenderQuery executes the template of a query against the tables. {{ table "flow" }} is the name of the flow table,
+// and {{ if partitioned "flow" }} guards conditions on event_date, which Iceberg tables don't have
+func RenderQuery(query QueryTemplate, tables []GlueCatalogTable) (string, error) {
+	byEvent := map[string]GlueCatalogTable{}
+	for _, table := range tables {
+		byEvent[table.EventName] = table
+	}
+	lookup := func(eventName string) (GlueCatalogTable, error) {
+		table, ok := byEvent[eventName]
+		if !ok {
+			return GlueCatalogTable{}, fmt.Errorf("no table for event type %s", eventName)
+		}
+		return table, nil
+	}
+
+	sqlTemplate, err := template.New(query.Name).Funcs(template.FuncMap{
+		"table": func(eventName string) (string, error) {
+			table, err := lookup(eventName)
+			return table.Name, err
+		},
+		"partitioned": func(eventName string) (bool, error) {
+			table, err := lookup(eventName)
+			if err != nil {
+				return false, err
+			}
+			for _, key := range table.PartitionKeys {
+				if key.Name == "event_date" {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}).Parse(query.SQL)
+	if err != nil {
+		return "", err
+	}
+	sql := &strings.Builder{}
+	err = sqlTemplate.Execute(sql, nil)
+	if err != nil {
+		return "", err
+	}
+	return sql.String(), nil
+}
+
+// prestoType converts a Glue column type to the type Athena records for view columns, e.g. array<string> to array(varchar)
+func prestoType(glueType string) (string, error) {
+	switch glueType {
+	case "string":
+		return "varchar", nil
+	case "int":
+		return "integer", nil
+	case "float":
+		return "real", nil
+	case "boolean", "tinyint", "smallint", "bigint", "double", "date", "timestamp":
+		return glueType, nil
+	}
+	if strings.HasPrefix(glueType, "array<") && strings.HasSuffix(glueType, ">") {
+		element, err := prestoType(glueType[len("array<") : len(glueType)-1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("array(%s)", element), nil
+	}
+	return "", fmt.Errorf("view columns of type %s aren't supported", glueType)
+}
+
+// parseExpression converts HCL source to tokens, for expressions too involved to build token by token
+func parseExpression(expression string) (hclwrite.Tokens, error) {
+	file, diags := hclwrite.ParseConfig([]byte("expression = "+expression+"\n"), "expression", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file.Body().GetAttribute("expression").Expr().BuildTokens(nil), nil
+}
+
+// heredoc returns the HCL source of a heredoc string, escaping template sequences so the SQL is kept as is
+func heredoc(value string) string {
+	value = strings.ReplaceAll(value, "${", "$${")
+	value = strings.ReplaceAll(value, "%{", "%%{")
+	return "<<EOT\n" + value + "\nEOT"
+}
+
+// viewOriginalText returns the expression of a view's view_original_text, the base64 JSON Athena reads views from
+func viewOriginalText(query QueryTemplate, sql string) (hclwrite.Tokens, error) {
+	columns := "[\n"
+	for _, column := range query.Columns {
+		columnType, err := prestoType(column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", query.Name, err)
+		}
+		columns += fmt.Sprintf("{ name = %s, type = %s },\n", hclwrite.TokensForValue(cty.StringVal(column.Name)).Bytes(), hclwrite.TokensForValue(cty.StringVal(columnType)).Bytes())
+	}
+	columns += "]"
+	return parseExpression(fmt.Sprintf(`format("/* Presto View: %%s */", base64encode(jsonencode({
+  originalSql = %s
+  catalog     = "awsdatacatalog"
+  schema      = aws_glue_catalog_database.surithena.name
+  columns     = %s
+})))`, heredoc(sql), columns))
+}
+
+// athenaResultsLocation is where the workgroup writes query results, in the events bucket unless athena_output_location is set
+func athenaResultsLocation() (hclwrite.Tokens, error) {
+	if location := viper.GetString("athena_output_location"); location != "" {
+		return hclwrite.TokensForValue(cty.StringVal(location)), nil
+	}
+	return parseExpression(`"s3://${var.bucket_name}/athena-results/"`)
+}
+
+// GenerateAthenaConfig returns the workgroup analysts query the tables in, along with a named query per SQL template and a Glue view per template marked as one
+func GenerateAthenaConfig(tables []GlueCatalogTable, module bool) (*hclwrite.File, error) {
+	templates, err := LoadQueryTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+
+	workgroup := body.AppendNewBlock("resource", []string{"aws_athena_workgroup", "surithena"}).Body()
+	if module {
+		workgroup.SetAttributeRaw("name", rawExpression("var.athena_workgroup_name"))
+	} else {
+		workgroup.SetAttributeValue("name", cty.StringVal(viper.GetString("athena_workgroup_name")))
+	}
+	configuration := workgroup.AppendNewBlock("configuration", nil).Body()
+	configuration.SetAttributeValue("enforce_workgroup_configuration", cty.True)
+	configuration.SetAttributeValue("publish_cloudwatch_metrics_enabled", cty.True)
+	if cutoff := viper.GetInt64("athena_bytes_scanned_cutoff_per_query"); cutoff > 0 {
+		configuration.SetAttributeValue("bytes_scanned_cutoff_per_query", cty.NumberIntVal(cutoff))
+	}
+	resultConfiguration := configuration.AppendNewBlock("result_configuration", nil).Body()
+	location, err := athenaResultsLocation()
+	if err != nil {
+		return nil, err
+	}
+	resultConfiguration.SetAttributeRaw("output_location", location)
+	encryption := resultConfiguration.AppendNewBlock("encryption_configuration", nil).Body()
+	if viper.GetBool("sse_kms") {
+		encryption.SetAttributeValue("encryption_option", cty.StringVal("SSE_KMS"))
+		encryption.SetAttributeRaw("kms_key_arn", rawExpression("aws_kms_key.surithena.arn"))
+	} else {
+		encryption.SetAttributeValue("encryption_option", cty.StringVal("SSE_S3"))
+	}
+
+	for _, query := range templates {
+		sql, err := RenderQuery(query, tables)
+		if err != nil {
+			return nil, err
+		}
+
+		body.AppendNewline()
+		namedQuery := body.AppendNewBlock("resource", []string{"aws_athena_named_query", query.Name}).Body()
+		namedQuery.SetAttributeValue("name", cty.StringVal(query.Name))
+		namedQuery.SetAttributeValue("description", cty.StringVal(query.Description))
+		namedQuery.SetAttributeRaw("workgroup", rawExpression("aws_athena_workgroup.surithena.id"))
+		namedQuery.SetAttributeRaw("database", rawExpression("aws_glue_catalog_database.surithena.name"))
+		queryText, err := parseExpression(heredoc(sql))
+		if err != nil {
+			return nil, err
+		}
+		namedQuery.SetAttributeRaw("query", queryText)
+
+		if !query.View {
+			continue
+		}
+		originalText, err := viewOriginalText(query, sql)
+		if err != nil {
+			return nil, err
+		}
+		body.AppendNewline()
+		view := body.AppendNewBlock("resource", []string{"aws_glue_catalog_table", query.Name}).Body()
+		view.SetAttributeValue("name", cty.StringVal(query.Name))
+		view.SetAttributeRaw("database_name", rawExpression("aws_glue_catalog_database.surithena.name"))
+		view.SetAttributeValue("description", cty.StringVal(query.Description))
+		view.SetAttributeValue("table_type", cty.StringVal("VIRTUAL_VIEW"))
+		view.SetAttributeRaw("view_original_text", originalText)
+		view.SetAttributeValue("view_expanded_text", cty.StringVal("/* Presto View */"))
+		view.SetAttributeValue("parameters", cty.MapVal(map[string]cty.Value{
+			"presto_view": cty.StringVal("true"),
+			"comment":     cty.StringVal("Presto View"),
+		}))
+		storageDescriptor := view.AppendNewBlock("storage_descriptor", nil).Body()
+		for _, column := range query.Columns {
+			columns := storageDescriptor.AppendNewBlock("columns", nil).Body()
+			columns.SetAttributeValue("name", cty.StringVal(column.Name))
+			columns.SetAttributeValue("type", cty.StringVal(column.Type))
+		}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type CloudFormationTemplate struct {
+	AWSTemplateFormatVersion string                             `json:"AWSTemplateFormatVersion"`
+	Description              string                             `json:"Description"`
+	Parameters               map[string]CloudFormationParameter `json:"Parameters"`
+	Resources                map[string]CloudFormationResource  `json:"Resources"`
+	Outputs                  map[string]CloudFormationOutput    `json:"Outputs"`
+}
+
+type CloudFormationParameter struct {
+	Type        string `json:"Type"`
+	Default     string `json:"Default,omitempty"`
+	Description string `json:"Description"`
+}
+
+type CloudFormationResource struct {
+	Type       string      `json:"Type"`
+	Properties interface{} `json:"Properties"`
+}
+
+type CloudFormationOutput struct {
+	Value interface{} `json:"Value"`
+}
+
+type GlueDatabaseProperties struct {
+	CatalogId     interface{}            `json:"CatalogId"`
+	DatabaseInput map[string]interface{} `json:"DatabaseInput"`
+}
+
+type GlueTableProperties struct {
+	CatalogId            interface{}               `json:"CatalogId"`
+	DatabaseName         interface{}               `json:"DatabaseName"`
+	TableInput           GlueTableInput            `json:"TableInput"`
+	OpenTableFormatInput *GlueOpenTableFormatInput `json:"OpenTableFormatInput,omitempty"`
+}
+
+// cloudFormationLogicalID converts a table name such as flow_events to FlowEventsTable
+func cloudFormationLogicalID(name string) string {
+	id := ""
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id + "Table"
+}
+
+// WriteCloudFormationTemplate writes cloudformation/surithena.json, a template with the Glue database and a table per event type, with the bucket and database name as parameters
+func WriteCloudFormationTemplate(tables []GlueCatalogTable) error {
+	template := CloudFormationTemplate{
+		AWSTemplateFormatVersion: "2010-09-09",
+		Description:              "Glue tables for the Suricata events written by eve-processor",
+		Parameters: map[string]CloudFormationParameter{
+			"BucketName": {
+				Type:        "String",
+				Description: "Bucket eve-processor writes to",
+			},
+			"DatabaseName": {
+				Type:        "String",
+				Default:     viper.GetString("glue_database_name"),
+				Description: "Glue database to create the tables in",
+			},
+		},
+		Resources: map[string]CloudFormationResource{
+			"Database": {
+				Type: "AWS::Glue::Database",
+				Properties: GlueDatabaseProperties{
+					CatalogId: map[string]string{"Ref": "AWS::AccountId"},
+					DatabaseInput: map[string]interface{}{
+						"Name": map[string]string{"Ref": "DatabaseName"},
+					},
+				},
+			},
+		},
+		Outputs: map[string]CloudFormationOutput{
+			"DatabaseName": {
+				Value: map[string]string{"Ref": "Database"},
+			},
+		},
+	}
+
+	for _, table := range tables {
+		var location interface{} = map[string]string{
+			"Fn::Sub": fmt.Sprintf("s3://${BucketName}/%s/", table.EventName),
+		}
+		if TableLocation(table.EventName) != "" {
+			location = table.StorageDescriptor.Location
+		}
+		tableInput := ConvertToGlueTableInput(table, location)
+		// AWS::Glue::Table columns don't have parameters, so the comments of struct members are only in the data dictionary
+		for i := range tableInput.StorageDescriptor.Columns {
+			tableInput.StorageDescriptor.Columns[i].Parameters = nil
+		}
+		template.Resources[cloudFormationLogicalID(table.Name)] = CloudFormationResource{
+			Type: "AWS::Glue::Table",
+			Properties: GlueTableProperties{
+				CatalogId:            map[string]string{"Ref": "AWS::AccountId"},
+				DatabaseName:         map[string]string{"Ref": "Database"},
+				TableInput:           tableInput,
+				OpenTableFormatInput: ConvertToGlueOpenTableFormatInput(table),
+			},
+		}
+	}
+
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(outputPath("cloudformation"), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath("cloudformation", "surithena.json"), append(data, '\n'), 0644)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sheacloud/surithena/pkg/suricata"
+	"github.com/spf13/viper"
+)
+
+// markdownCell escapes a value for a Markdown table cell
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+// dictionaryType shortens types containing structs to their outer type, e.g. array<struct<...>> to array<struct>, as the struct members have their own rows
+func dictionaryType(typeString string) string {
+	index := strings.Index(typeString, "struct<")
+	if index < 0 {
+		return typeString
+	}
+	return typeString[:index] + "struct" + strings.Repeat(">", strings.Count(typeString[:index], "<"))
+}
+
+func dictionaryOptional(optional bool) string {
+	if optional {
+		return "yes"
+	}
+	return ""
+}
+
+// GenerateDataDictionary returns a Markdown document describing every column of the table, along with the members of struct columns and the partition keys
+func GenerateDataDictionary(table GlueCatalogTable) string {
+	doc := &strings.Builder{}
+	fmt.Fprintf(doc, "# %s\n\n", table.Name)
+	if viper.GetString("s3_bucket_name") != "" || TableLocation(table.EventName) != "" {
+		fmt.Fprintf(doc, "Suricata %s events written by eve-processor to `%s`.\n\n", table.EventName, table.StorageDescriptor.Location)
+	} else {
+		fmt.Fprintf(doc, "Suricata %s events written by eve-processor under `%s/` in the events bucket.\n\n", table.EventName, table.EventName)
+	}
+
+	fmt.Fprintf(doc, "## Columns\n\n")
+	fmt.Fprintf(doc, "Optional columns are NULL when the field is absent from the EVE record, rather than 0 or an empty string.\n\n")
+	fmt.Fprintf(doc, "| Column | Type | Optional | Description |\n")
+	fmt.Fprintf(doc, "| --- | --- | --- | --- |\n")
+	for _, column := range table.StorageDescriptor.Columns {
+		fmt.Fprintf(doc, "| `%s` | `%s` | %s | %s |\n", column.Name, dictionaryType(column.Type), dictionaryOptional(column.Optional), markdownCell(column.Comment))
+		for _, member := range column.Members {
+			fmt.Fprintf(doc, "| `%s.%s` | `%s` | %s | %s |\n", column.Name, member.Path, dictionaryType(member.Type), dictionaryOptional(member.Optional), markdownCell(member.Comment))
+		}
+	}
+
+	if len(table.PartitionKeys) > 0 {
+		fmt.Fprintf(doc, "\n## Partition keys\n\n")
+		fmt.Fprintf(doc, "| Column | Type | Projection |\n")
+		fmt.Fprintf(doc, "| --- | --- | --- |\n")
+		for _, key := range table.PartitionKeys {
+			projection := table.Parameters[fmt.Sprintf("projection.%s.type", key.Name)]
+			if projectionRange, ok := table.Parameters[fmt.Sprintf("projection.%s.range", key.Name)]; ok {
+				projection += fmt.Sprintf(", range %s", projectionRange)
+			}
+			if values, ok := table.Parameters[fmt.Sprintf("projection.%s.values", key.Name)]; ok {
+				projection += fmt.Sprintf(", values %s", values)
+			}
+			fmt.Fprintf(doc, "| `%s` | `%s` | %s |\n", key.Name, key.Type, markdownCell(projection))
+		}
+	}
+
+	if model, ok := EventModels[table.EventName].(suricata.VersionedModel); ok {
+		fmt.Fprintf(doc, "\n## Schema history\n\n")
+		fmt.Fprintf(doc, "Files record the version they were written with in the `%s` key-value metadata.\n\n", storage.SchemaVersionMetadataKey)
+		fmt.Fprintf(doc, "| Version | Description | Added columns |\n")
+		fmt.Fprintf(doc, "| --- | --- | --- |\n")
+		for _, revision := range model.SchemaChangelog() {
+			added := []string{}
+			for _, column := range revision.Added {
+				added = append(added, "`"+column+"`")
+			}
+			fmt.Fprintf(doc, "| %d | %s | %s |\n", revision.Version, markdownCell(revision.Description), strings.Join(added, ", "))
+		}
+	}
+	return doc.String()
+}
+
+// WriteDataDictionary writes dictionary/<table>.md per table, documenting the columns from the desc tags of the event models
+func WriteDataDictionary(tables []GlueCatalogTable) error {
+	err := os.MkdirAll(outputPath("dictionary"), 0755)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		err = os.WriteFile(outputPath("dictionary", table.Name+".md"), []byte(GenerateDataDictionary(table)), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
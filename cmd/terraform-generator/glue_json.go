@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// GlueTableInput is a table in the shape of the Glue API's TableInput, which CloudFormation's AWS::Glue::Table uses as well
+type GlueTableInput struct {
+	Name              string                `json:"Name"`
+	TableType         string                `json:"TableType"`
+	Parameters        map[string]string     `json:"Parameters"`
+	PartitionKeys     []GlueColumn          `json:"PartitionKeys,omitempty"`
+	StorageDescriptor GlueStorageDescriptor `json:"StorageDescriptor"`
+}
+
+type GlueStorageDescriptor struct {
+	// Location is a string, or an intrinsic function in CloudFormation
+	Location     interface{}   `json:"Location"`
+	InputFormat  string        `json:"InputFormat"`
+	OutputFormat string        `json:"OutputFormat"`
+	SerdeInfo    GlueSerdeInfo `json:"SerdeInfo"`
+	Columns      []GlueColumn  `json:"Columns"`
+}
+
+type GlueSerdeInfo struct {
+	Name                 string            `json:"Name"`
+	SerializationLibrary string            `json:"SerializationLibrary"`
+	Parameters           map[string]string `json:"Parameters"`
+}
+
+type GlueColumn struct {
+	Name       string            `json:"Name"`
+	Type       string            `json:"Type"`
+	Comment    string            `json:"Comment,omitempty"`
+	Parameters map[string]string `json:"Parameters,omitempty"`
+}
+
+type GlueOpenTableFormatInput struct {
+	IcebergInput GlueIcebergInput `json:"IcebergInput"`
+}
+
+type GlueIcebergInput struct {
+	MetadataOperation string `json:"MetadataOperation"`
+	Version           string `json:"Version"`
+}
+
+// GlueCreateTableInput is the input of glue create-table, which takes the open table format input alongside the table input
+type GlueCreateTableInput struct {
+	DatabaseName         string                    `json:"DatabaseName"`
+	TableInput           GlueTableInput            `json:"TableInput"`
+	OpenTableFormatInput *GlueOpenTableFormatInput `json:"OpenTableFormatInput,omitempty"`
+}
+
+func ConvertToGlueTableInput(table GlueCatalogTable, location interface{}) GlueTableInput {
+	input := GlueTableInput{
+		Name:       table.Name,
+		TableType:  table.TableType,
+		Parameters: table.Parameters,
+		StorageDescriptor: GlueStorageDescriptor{
+			Location:     location,
+			InputFormat:  table.StorageDescriptor.InputFormat,
+			OutputFormat: table.StorageDescriptor.OutputFormat,
+			SerdeInfo: GlueSerdeInfo{
+				Name:                 table.StorageDescriptor.SerDeInfo.Name,
+				SerializationLibrary: table.StorageDescriptor.SerDeInfo.SerializationLibrary,
+				Parameters:           table.StorageDescriptor.SerDeInfo.Parameters,
+			},
+			Columns: []GlueColumn{},
+		},
+	}
+	for _, column := range table.StorageDescriptor.Columns {
+		input.StorageDescriptor.Columns = append(input.StorageDescriptor.Columns, GlueColumn{
+			Name:       column.Name,
+			Type:       column.Type,
+			Comment:    column.Comment,
+			Parameters: ColumnParameters(column),
+		})
+	}
+	for _, key := range table.PartitionKeys {
+		input.PartitionKeys = append(input.PartitionKeys, GlueColumn{
+			Name: key.Name,
+			Type: key.Type,
+		})
+	}
+	return input
+}
+
+func ConvertToGlueOpenTableFormatInput(table GlueCatalogTable) *GlueOpenTableFormatInput {
+	if table.OpenTableFormatInput == nil {
+		return nil
+	}
+	return &GlueOpenTableFormatInput{
+		IcebergInput: GlueIcebergInput{
+			MetadataOperation: table.OpenTableFormatInput.IcebergInput.MetadataOperation,
+			Version:           table.OpenTableFormatInput.IcebergInput.Version,
+		},
+	}
+}
+
+// WriteGlueTableInputs writes glue/<table>.json per table, for aws glue create-table --cli-input-json file://glue/<table>.json
+func WriteGlueTableInputs(tables []GlueCatalogTable) error {
+	if viper.GetString("s3_bucket_name") == "" {
+		return fmt.Errorf("S3_BUCKET_NAME is required for the %s output", OutputModeGlueJSON)
+	}
+	err := os.MkdirAll(outputPath("glue"), 0755)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		input := GlueCreateTableInput{
+			DatabaseName:         viper.GetString("glue_database_name"),
+			TableInput:           ConvertToGlueTableInput(table, table.StorageDescriptor.Location),
+			OpenTableFormatInput: ConvertToGlueOpenTableFormatInput(table),
+		}
+		data, err := json.MarshalIndent(input, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(outputPath("glue", table.Name+".json"), append(data, '\n'), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/fatih/structtag"
@@ -11,26 +15,125 @@ import (
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/sheacloud/surithena/internal/settings"
+	"github.com/sheacloud/surithena/internal/storage"
 	"github.com/sheacloud/surithena/pkg/suricata"
+	"github.com/spf13/viper"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	OutputModeTerraform      = "terraform"
+	OutputModeDDL            = "ddl"
+	OutputModeCloudFormation = "cloudformation"
+	OutputModeGlueJSON       = "glue-json"
+	OutputModeDictionary     = "dictionary"
+
+	// TerraformLayoutRoot writes the tables into a root module alongside the hand written bucket and provider, while TerraformLayoutModule writes
+	// a reusable module which takes the bucket, database and workgroup names as variables, so several environments can instantiate it
+	TerraformLayoutRoot   = "root"
+	TerraformLayoutModule = "module"
 )
 
 var (
-	FieldKindToType = map[reflect.Kind]string{
-		reflect.Bool:    "boolean",
-		reflect.String:  "string",
-		reflect.Int:     "int",
-		reflect.Int32:   "int",
-		reflect.Int64:   "bigint",
-		reflect.Float32: "float",
-		reflect.Float64: "double",
+	EventModels = map[string]interface{}{
+		"alert": suricata.AlertEvent{},
+		"dns":   suricata.DNSEvent{},
+		"flow":  suricata.FlowEvent{},
+		"http":  suricata.HTTPEvent{},
+		"tls":   suricata.TLSEvent{},
+		"stats": suricata.StatsEvent{},
+		"dhcp":  suricata.DHCPEvent{},
 	}
 )
 
+func init() {
+	// parquet settings are shared with eve-processor so the catalog describes the files it writes
+	viper.AutomaticEnv()
+
+	viper.BindEnv("parquet_compression_codec")
+	viper.SetDefault("parquet_compression_codec", storage.DefaultCompressionCodec)
+
+	viper.BindEnv("parquet_row_group_size_bytes")
+	viper.SetDefault("parquet_row_group_size_bytes", storage.DefaultRowGroupSize)
+
+	viper.BindEnv("parquet_page_size_bytes")
+	viper.SetDefault("parquet_page_size_bytes", storage.DefaultPageSize)
+
+	// partition_keys must match eve-processor. Sensor, interface and vlan partitions use enum projection when partition_<key>_values lists their values, e.g. partition_iface_values=eth0,eth1, and injected projection otherwise
+	viper.BindEnv("partition_keys")
+	viper.SetDefault("partition_keys", "")
+
+	viper.BindEnv("partition_minute_interval")
+	viper.SetDefault("partition_minute_interval", 15)
+
+	// table_format must match eve-processor, hive or iceberg
+	viper.BindEnv("table_format")
+	viper.SetDefault("table_format", "hive")
+
+	// partitions older than retention_days are deleted by eve-processor retention, so there's no point projecting them
+	viper.BindEnv("retention_days")
+	viper.SetDefault("retention_days", 0)
+
+	// output_modes is a comma separated list of the definitions to write: terraform into terraform/, ddl for Athena CREATE TABLE statements into athena/,
+	// cloudformation for a template of AWS::Glue::Table resources into cloudformation/, glue-json for aws glue create-table --cli-input-json files into glue/
+	// and dictionary for a Markdown data dictionary per table into dictionary/
+	viper.BindEnv("output_modes")
+	viper.SetDefault("output_modes", OutputModeTerraform+","+OutputModeDictionary)
+
+	// s3_bucket_name and glue_database_name are shared with eve-processor, and used by the ddl and glue-json outputs which can't reference terraform variables
+	viper.BindEnv("s3_bucket_name")
+	viper.SetDefault("s3_bucket_name", "")
+
+	viper.BindEnv("glue_database_name")
+	viper.SetDefault("glue_database_name", "surithena")
+
+	// output_dir is the directory the output directories, e.g. terraform/, are written under, so each environment can be generated into its own directory
+	viper.BindEnv("output_dir")
+	viper.SetDefault("output_dir", ".")
+
+	// terraform_layout is root or module, see TerraformLayoutRoot and TerraformLayoutModule
+	viper.BindEnv("terraform_layout")
+	viper.SetDefault("terraform_layout", TerraformLayoutRoot)
+
+	// table_name_prefix must match eve-processor, it's prepended to every table name, e.g. dev_ for dev_flow_events
+	viper.BindEnv("table_name_prefix")
+	viper.SetDefault("table_name_prefix", "")
+
+	// table_location overrides the location of a table, which is <type>/ in the events bucket, and is usually set per event type, e.g. flow_table_location
+	viper.BindEnv("table_location")
+	viper.SetDefault("table_location", "")
+
+	// projection_event_date_range overrides the range of event_date partitions projected, which is otherwise the last retention_days or the last year
+	viper.BindEnv("projection_event_date_range")
+	viper.SetDefault("projection_event_date_range", "")
+
+	viper.BindEnv("serde_name")
+	viper.SetDefault("serde_name", "my-stream")
+
+	// sse_kms generates a KMS key and a bucket policy which rejects uploads encrypted any other way, eve-processor's s3_sse_kms_key_id must then be set to the kms_key_arn output
+	viper.BindEnv("sse_kms")
+	viper.SetDefault("sse_kms", false)
+
+	// the terraform output creates an Athena workgroup with the named queries and views in queries/, results are written to
+	// athena_output_location, or athena-results/ in the events bucket, and queries scanning more than the cutoff are cancelled
+	viper.BindEnv("athena_workgroup_name")
+	viper.SetDefault("athena_workgroup_name", "surithena")
+
+	viper.BindEnv("athena_output_location")
+	viper.SetDefault("athena_output_location", "")
+
+	viper.BindEnv("athena_bytes_scanned_cutoff_per_query")
+	viper.SetDefault("athena_bytes_scanned_cutoff_per_query", 10*1024*1024*1024)
+}
+
 type BaseConfig struct {
 	Resources []GlueCatalogTable `hcl:"resource,block"`
 }
 
 type GlueCatalogTable struct {
+	// EventName isn't encoded, it's kept so each output can name its files and locations after the event type
+	EventName         string
 	ResourceLabel     string            `hcl:"resource_label,label"`
 	NameLabel         string            `hcl:"name_label,label"`
 	Name              string            `hcl:"name"`
@@ -39,6 +142,17 @@ type GlueCatalogTable struct {
 	Parameters        map[string]string `hcl:"parameters"`
 	StorageDescriptor StorageDescriptor `hcl:"storage_descriptor,block"`
 	PartitionKeys     []PartitionKeys   `hcl:"partition_keys,block"`
+	// OpenTableFormatInput is only set for Iceberg tables
+	OpenTableFormatInput *OpenTableFormatInput `hcl:"open_table_format_input,block"`
+}
+
+type OpenTableFormatInput struct {
+	IcebergInput IcebergInput `hcl:"iceberg_input,block"`
+}
+
+type IcebergInput struct {
+	MetadataOperation string `hcl:"metadata_operation"`
+	Version           string `hcl:"version"`
 }
 
 type StorageDescriptor struct {
@@ -59,6 +173,18 @@ type Columns struct {
 	Name    string `hcl:"name"`
 	Type    string `hcl:"type"`
 	Comment string `hcl:"comment"`
+	// Optional columns are NULL when the field is absent from the EVE record, rather than a zero value
+	Optional bool
+	// Members documents the members of struct columns, which Glue has no comments for, so outputs supporting column parameters set them as comment.<path>
+	Members []ColumnMember
+}
+
+// ColumnMember is a nested member of a column, with its path relative to the column, e.g. answers.rrname
+type ColumnMember struct {
+	Path     string
+	Type     string
+	Comment  string
+	Optional bool
 }
 
 type PartitionKeys struct {
@@ -66,96 +192,193 @@ type PartitionKeys struct {
 	Type string `hcl:"type"`
 }
 
-func GetParquetNameTag(tag reflect.StructTag) (string, error) {
+// GetParquetTag parses the parquet tag of a field. ok is false for fields which aren't written to parquet, and for those opted out of the catalog with catalog:"-"
+func GetParquetTag(tag reflect.StructTag) (parquetTag storage.ParquetTag, ok bool, err error) {
 	tags, err := structtag.Parse(string(tag))
 	if err != nil {
-		return "", err
+		return storage.ParquetTag{}, false, err
 	}
 
-	parquetTag, err := tags.Get("parquet")
+	rawTag, err := tags.Get("parquet")
 	if err != nil {
-		return "", err
+		return storage.ParquetTag{}, false, nil
+	}
+	if catalogTag, err := tags.Get("catalog"); err == nil && catalogTag.Name == "-" {
+		return storage.ParquetTag{}, false, nil
 	}
-	parquetFieldName := strings.Split(parquetTag.Name, "=")[1]
 
-	return parquetFieldName, nil
+	parquetTag, err = storage.ParseParquetTag(rawTag.Value())
+	if err != nil {
+		return storage.ParquetTag{}, false, fmt.Errorf("parquet tag %q: %w", rawTag.Value(), err)
+	}
+	return parquetTag, true, nil
 }
 
-func ParquetFieldIsTimestamp(tag reflect.StructTag) bool {
-	tags, err := structtag.Parse(string(tag))
-	if err != nil {
-		return false
+// GetFieldDescription returns the desc tag of a field, which becomes the comment of its column
+func GetFieldDescription(tag reflect.StructTag) string {
+	return tag.Get("desc")
+}
+
+// GetFieldMembers returns the tagged members of a struct type, and of the structs within them, including those in lists and maps
+func GetFieldMembers(fieldType reflect.Type, prefix string) ([]ColumnMember, error) {
+	for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Array || fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Map {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType.Kind() != reflect.Struct {
+		return nil, nil
 	}
 
-	parquetTag, err := tags.Get("parquet")
-	if err != nil {
-		return false
+	members := []ColumnMember{}
+	for i := 0; i < fieldType.NumField(); i++ {
+		subfieldType := fieldType.Field(i)
+		tag := subfieldType.Tag
+
+		parquetTag, ok, err := GetParquetTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", subfieldType.Name, err)
+		}
+		if !ok {
+			continue
+		}
+
+		typeString, err := GetFieldTypeParquetString(subfieldType.Type, parquetTag)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", subfieldType.Name, err)
+		}
+		member := ColumnMember{
+			Path:     prefix + parquetTag.Name,
+			Type:     typeString,
+			Comment:  GetFieldDescription(tag),
+			Optional: parquetTag.RepetitionType == "OPTIONAL",
+		}
+		subMembers, err := GetFieldMembers(subfieldType.Type, member.Path+".")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", subfieldType.Name, err)
+		}
+		members = append(members, member)
+		members = append(members, subMembers...)
 	}
+	return members, nil
+}
 
-	//FIXME parse the tags better
-	return parquetTag.HasOption(" convertedtype=TIMESTAMP_MILLIS") || parquetTag.HasOption("convertedtype=TIMESTAMP_MILLIS")
+// ColumnParameters returns the comments of the members of a column as Glue column parameters, or nil if it has none
+func ColumnParameters(column Columns) map[string]string {
+	if len(column.Members) == 0 {
+		return nil
+	}
+	parameters := map[string]string{}
+	for _, member := range column.Members {
+		if member.Comment != "" {
+			parameters["comment."+member.Path] = member.Comment
+		}
+	}
+	return parameters
 }
 
-//f should be the structfield corresponding to v
-func GetFieldTypeParquetString(fieldType reflect.Type) string {
+// GetStructTypeParquetString returns the Glue struct type of a struct, from the parquet tags of its fields
+func GetStructTypeParquetString(structType reflect.Type) (string, error) {
+	fields := []string{}
+	for i := 0; i < structType.NumField(); i++ {
+		subfieldType := structType.Field(i)
 
-	if fieldType.Kind() == reflect.Ptr {
-		fieldType = fieldType.Elem()
-	}
+		parquetTag, ok, err := GetParquetTag(subfieldType.Tag)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", subfieldType.Name, err)
+		}
+		if !ok {
+			continue
+		}
 
-	if fieldType.Kind() == reflect.Struct {
-		//for each field of the struct, call GetFieldTypeParquetString
-		parquetString := "struct<"
-		for i := 0; i < fieldType.NumField(); i++ {
-			subfieldType := fieldType.Field(i)
+		typeString, err := GetFieldTypeParquetString(subfieldType.Type, parquetTag)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", subfieldType.Name, err)
+		}
+		fields = append(fields, fmt.Sprintf("%s:%s", parquetTag.Name, typeString))
+	}
+	return fmt.Sprintf("struct<%s>", strings.Join(fields, ",")), nil
+}
 
-			tag := subfieldType.Tag
+// getValueTypeParquetString returns the type of list elements and map values, from the value type of the tag, or the Go type for structs
+func getValueTypeParquetString(valueType reflect.Type, valueTag storage.ParquetTypeTag) (string, error) {
+	if valueTag.Type != "" {
+		return valueTag.GlueType()
+	}
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if valueType.Kind() != reflect.Struct {
+		return "", fmt.Errorf("valuetype is required for %s values", valueType)
+	}
+	return GetStructTypeParquetString(valueType)
+}
 
-			parquetFieldName, err := GetParquetNameTag(tag)
-			if err != nil {
-				continue
-			}
+// GetFieldTypeParquetString returns the Glue type of a field, from its parquet tag, and its Go type for structs and the elements of lists of structs
+func GetFieldTypeParquetString(fieldType reflect.Type, parquetTag storage.ParquetTag) (string, error) {
+	// parquet-go writes nil pointers as NULLs, which only OPTIONAL fields can hold, and always writes a value for fields which aren't pointers
+	optional := parquetTag.RepetitionType == "OPTIONAL"
+	if fieldType.Kind() == reflect.Ptr && !optional {
+		return "", fmt.Errorf("pointer fields should be tagged repetitiontype=OPTIONAL")
+	}
+	if optional && fieldType.Kind() != reflect.Ptr && !parquetTag.IsList() && !parquetTag.IsMap() {
+		return "", fmt.Errorf("OPTIONAL fields should be pointers, not %s", fieldType)
+	}
 
-			var typeString string
-			if ParquetFieldIsTimestamp(tag) {
-				typeString = "timestamp"
-			} else {
-				typeString = GetFieldTypeParquetString(subfieldType.Type)
-			}
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
 
-			parquetString += fmt.Sprintf("%s:%s", parquetFieldName, typeString)
-			if i != fieldType.NumField()-1 {
-				parquetString += ","
+	switch {
+	case parquetTag.IsList():
+		if fieldType.Kind() != reflect.Slice && fieldType.Kind() != reflect.Array {
+			return "", fmt.Errorf("LIST fields should be slices, not %s", fieldType)
+		}
+		elementType, err := getValueTypeParquetString(fieldType.Elem(), parquetTag.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("array<%s>", elementType), nil
+	case parquetTag.IsMap():
+		if fieldType.Kind() != reflect.Map {
+			return "", fmt.Errorf("MAP fields should be maps, not %s", fieldType)
+		}
+		keyType, err := parquetTag.Key.GlueType()
+		if err != nil {
+			return "", fmt.Errorf("map key: %w", err)
+		}
+		valueType, err := getValueTypeParquetString(fieldType.Elem(), parquetTag.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("map<%s,%s>", keyType, valueType), nil
+	case parquetTag.Element.Type == "":
+		// a struct, or a slice of structs which parquet-go writes as a repeated group
+		if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+			elementType, err := getValueTypeParquetString(fieldType.Elem(), storage.ParquetTypeTag{})
+			if err != nil {
+				return "", err
 			}
+			return fmt.Sprintf("array<%s>", elementType), nil
 		}
-		parquetString += ">"
-
-		return parquetString
-	} else if fieldType.Kind() == reflect.Array || fieldType.Kind() == reflect.Slice {
-		parquetString := "array<"
-		arrayType := fieldType.Elem()
-		parquetString += GetFieldTypeParquetString(arrayType)
-		parquetString += ">"
-		return parquetString
-	} else if fieldType.Kind() == reflect.Map {
-		parquetString := "map<"
-		keyType := fieldType.Key()
-		elemType := fieldType.Elem()
-		keyString := GetFieldTypeParquetString(keyType)
-		elemString := GetFieldTypeParquetString(elemType)
-		parquetString += keyString
-		parquetString += ","
-		parquetString += elemString
-		parquetString += ">"
-		return parquetString
-	} else {
-		return FieldKindToType[fieldType.Kind()]
+		if fieldType.Kind() != reflect.Struct {
+			return "", fmt.Errorf("type is required for %s fields", fieldType)
+		}
+		return GetStructTypeParquetString(fieldType)
 	}
+
+	typeString, err := parquetTag.Element.GlueType()
+	if err != nil {
+		return "", err
+	}
+	if parquetTag.IsRepeated() {
+		return fmt.Sprintf("array<%s>", typeString), nil
+	}
+	return typeString, nil
 }
 
 func ConvertStructToGlueTable(obj interface{}, name string) (GlueCatalogTable, error) {
 	tableName := fmt.Sprintf("%s_events", name)
 	table := GlueCatalogTable{
+		EventName:     name,
 		ResourceLabel: "aws_glue_catalog_table",
 		NameLabel:     tableName,
 		Name:          tableName,
@@ -173,11 +396,11 @@ func ConvertStructToGlueTable(obj interface{}, name string) (GlueCatalogTable, e
 			"projection.enabled":             "true",
 		},
 		StorageDescriptor: StorageDescriptor{
-			Location:     "replaceme",
+			Location:     fmt.Sprintf("s3://%s/%s/", viper.GetString("s3_bucket_name"), name),
 			InputFormat:  "org.apache.hadoop.hive.ql.io.parquet.MapredParquetInputFormat",
 			OutputFormat: "org.apache.hadoop.hive.ql.io.parquet.MapredParquetOutputFormat",
 			SerDeInfo: SerDeInfo{
-				Name:                 "my-stream",
+				Name:                 viper.GetString("serde_name"),
 				SerializationLibrary: "org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe",
 				Parameters: map[string]string{
 					"serialization.format": "1",
@@ -206,46 +429,374 @@ func ConvertStructToGlueTable(obj interface{}, name string) (GlueCatalogTable, e
 		typeField := objType.Field(i)
 		tag := typeField.Tag
 
-		parquetFieldName, err := GetParquetNameTag(tag)
+		parquetTag, ok, err := GetParquetTag(tag)
 		if err != nil {
+			return GlueCatalogTable{}, fmt.Errorf("%s.%s: %w", objType.Name(), typeField.Name, err)
+		}
+		if !ok {
 			continue
 		}
 
-		typeString := ""
-
-		if ParquetFieldIsTimestamp(tag) {
-			typeString = "timestamp"
-		} else {
-			typeString = GetFieldTypeParquetString(typeField.Type)
+		typeString, err := GetFieldTypeParquetString(typeField.Type, parquetTag)
+		if err != nil {
+			return GlueCatalogTable{}, fmt.Errorf("%s.%s: %w", objType.Name(), typeField.Name, err)
+		}
+		members, err := GetFieldMembers(typeField.Type, "")
+		if err != nil {
+			return GlueCatalogTable{}, fmt.Errorf("%s.%s: %w", objType.Name(), typeField.Name, err)
 		}
 
 		column := Columns{
-			Name: parquetFieldName,
-			Type: typeString,
+			Name:     parquetTag.Name,
+			Type:     typeString,
+			Comment:  GetFieldDescription(tag),
+			Optional: parquetTag.RepetitionType == "OPTIONAL",
+			Members:  members,
 		}
 		table.StorageDescriptor.Columns = append(table.StorageDescriptor.Columns, column)
 	}
 
+	if versioned, ok := obj.(suricata.VersionedModel); ok {
+		table.Parameters[storage.SchemaVersionMetadataKey] = strconv.Itoa(versioned.SchemaVersion())
+	}
+
 	return table, nil
 }
 
+// ConvertToIcebergTable has Glue create the table as an Iceberg table, which is unpartitioned and doesn't use partition projection.
+// eve-processor updates metadata_location on every commit, so terraform has to ignore changes to the parameters.
+func ConvertToIcebergTable(table *GlueCatalogTable) {
+	parameters := map[string]string{
+		"table_type": "ICEBERG",
+	}
+	if version, ok := table.Parameters[storage.SchemaVersionMetadataKey]; ok {
+		parameters[storage.SchemaVersionMetadataKey] = version
+	}
+	table.Parameters = parameters
+	table.PartitionKeys = []PartitionKeys{}
+	table.OpenTableFormatInput = &OpenTableFormatInput{
+		IcebergInput: IcebergInput{
+			MetadataOperation: "CREATE",
+			Version:           "2",
+		},
+	}
+}
+
+// AddPartitionProjection adds the optional partition keys of the layout to the table, along with the partition projection for each
+func AddPartitionProjection(table *GlueCatalogTable, layout storage.PartitionLayout, eventName string) {
+	for _, key := range layout.Keys {
+		if key == storage.PartitionEventMinute {
+			table.PartitionKeys = append(table.PartitionKeys, PartitionKeys{
+				Name: key,
+				Type: "int",
+			})
+			table.Parameters["projection.event_minute.type"] = "integer"
+			table.Parameters["projection.event_minute.range"] = fmt.Sprintf("0,%d", 60-layout.MinuteInterval)
+			table.Parameters["projection.event_minute.interval"] = fmt.Sprint(layout.MinuteInterval)
+			continue
+		}
+
+		// injected projection only supports string keys
+		table.PartitionKeys = append(table.PartitionKeys, PartitionKeys{
+			Name: key,
+			Type: "string",
+		})
+		values := viper.GetString(settings.EventTypeKey(eventName, fmt.Sprintf("partition_%s_values", key)))
+		if values != "" {
+			table.Parameters[fmt.Sprintf("projection.%s.type", key)] = "enum"
+			table.Parameters[fmt.Sprintf("projection.%s.values", key)] = values
+		} else {
+			table.Parameters[fmt.Sprintf("projection.%s.type", key)] = "injected"
+		}
+	}
+}
+
+// GenerateDatabaseConfig returns the Glue database the tables are created in, named glue_database_name, or the database_name variable of the module
+func GenerateDatabaseConfig(module bool) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	database := file.Body().AppendNewBlock("resource", []string{"aws_glue_catalog_database", "surithena"}).Body()
+	if module {
+		database.SetAttributeRaw("name", rawExpression("var.database_name"))
+	} else {
+		database.SetAttributeValue("name", cty.StringVal(viper.GetString("glue_database_name")))
+	}
+	return file
+}
+
+func addVariable(body *hclwrite.Body, name, description string, defaultValue *cty.Value) {
+	variable := body.AppendNewBlock("variable", []string{name}).Body()
+	variable.SetAttributeRaw("type", rawExpression("string"))
+	variable.SetAttributeValue("description", cty.StringVal(description))
+	if defaultValue != nil {
+		variable.SetAttributeValue("default", *defaultValue)
+	}
+}
+
+// GenerateModuleVariables returns the variables of the module layout, defaulting to the settings it was generated with
+func GenerateModuleVariables() *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+	addVariable(body, "bucket_name", "Bucket eve-processor writes the events to", nil)
+	body.AppendNewline()
+	databaseName := cty.StringVal(viper.GetString("glue_database_name"))
+	addVariable(body, "database_name", "Glue database to create the tables in", &databaseName)
+	body.AppendNewline()
+	workgroupName := cty.StringVal(viper.GetString("athena_workgroup_name"))
+	addVariable(body, "athena_workgroup_name", "Athena workgroup to create for querying the tables", &workgroupName)
+	return file
+}
+
+// GenerateModuleOutputs returns the outputs of the module layout, the database, the table of each event type and the workgroup
+func GenerateModuleOutputs(tables []GlueCatalogTable) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+	body.AppendNewBlock("output", []string{"database_name"}).Body().SetAttributeRaw("value", rawExpression("aws_glue_catalog_database.surithena.name"))
+	body.AppendNewline()
+	tableNames := map[string]cty.Value{}
+	for _, table := range tables {
+		tableNames[table.EventName] = cty.StringVal(table.Name)
+	}
+	body.AppendNewBlock("output", []string{"table_names"}).Body().SetAttributeValue("value", cty.MapVal(tableNames))
+	body.AppendNewline()
+	body.AppendNewBlock("output", []string{"athena_workgroup_name"}).Body().SetAttributeRaw("value", rawExpression("aws_athena_workgroup.surithena.name"))
+	return file
+}
+
+// rawExpression is written to the file as is, for references and function calls hclwrite can't build from values
+func rawExpression(expression string) hclwrite.Tokens {
+	return hclwrite.Tokens{
+		{
+			Type:  hclsyntax.TokenIdent,
+			Bytes: []byte(expression),
+		},
+	}
+}
+
+func addPolicyStatement(document *hclwrite.Body, sid string, actions, resources string, test, variable, values string) {
+	statement := document.AppendNewBlock("statement", nil).Body()
+	statement.SetAttributeValue("sid", cty.StringVal(sid))
+	statement.SetAttributeValue("effect", cty.StringVal("Deny"))
+	statement.SetAttributeRaw("actions", rawExpression(actions))
+	statement.SetAttributeRaw("resources", rawExpression(resources))
+	principals := statement.AppendNewBlock("principals", nil).Body()
+	principals.SetAttributeValue("type", cty.StringVal("*"))
+	principals.SetAttributeRaw("identifiers", rawExpression(`["*"]`))
+	condition := statement.AppendNewBlock("condition", nil).Body()
+	condition.SetAttributeValue("test", cty.StringVal(test))
+	condition.SetAttributeValue("variable", cty.StringVal(variable))
+	condition.SetAttributeRaw("values", rawExpression(values))
+}
+
+// GenerateKMSConfig returns the KMS key eve-processor encrypts objects with and a bucket policy requiring it.
+// The policy only checks the encryption headers when they're present, as the UploadPart calls of multipart uploads never carry them.
+func GenerateKMSConfig(module bool) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+
+	key := body.AppendNewBlock("resource", []string{"aws_kms_key", "surithena"}).Body()
+	key.SetAttributeValue("description", cty.StringVal("Encrypts the Suricata events written by eve-processor"))
+	key.SetAttributeValue("deletion_window_in_days", cty.NumberIntVal(30))
+	key.SetAttributeValue("enable_key_rotation", cty.True)
+	body.AppendNewline()
+
+	alias := body.AppendNewBlock("resource", []string{"aws_kms_alias", "surithena"}).Body()
+	if module {
+		alias.SetAttributeRaw("name", rawExpression(`"alias/${var.database_name}"`))
+	} else {
+		alias.SetAttributeValue("name", cty.StringVal("alias/surithena"))
+	}
+	alias.SetAttributeRaw("target_key_id", rawExpression("aws_kms_key.surithena.key_id"))
+	body.AppendNewline()
+
+	// the root layout has the bucket resource, while the module only has the bucket name
+	bucketARN, objectsARN, bucketID := `aws_s3_bucket.surithena.arn`, `"${aws_s3_bucket.surithena.arn}/*"`, `aws_s3_bucket.surithena.id`
+	if module {
+		bucketARN, objectsARN, bucketID = `"arn:aws:s3:::${var.bucket_name}"`, `"arn:aws:s3:::${var.bucket_name}/*"`, `var.bucket_name`
+	}
+
+	document := body.AppendNewBlock("data", []string{"aws_iam_policy_document", "surithena_bucket"}).Body()
+	addPolicyStatement(document, "DenyUnencryptedObjectUploads", `["s3:PutObject"]`, "["+objectsARN+"]", "StringNotEqualsIfExists", "s3:x-amz-server-side-encryption", `["aws:kms"]`)
+	addPolicyStatement(document, "DenyOtherKMSKeys", `["s3:PutObject"]`, "["+objectsARN+"]", "StringNotEqualsIfExists", "s3:x-amz-server-side-encryption-aws-kms-key-id", `[aws_kms_key.surithena.arn]`)
+	addPolicyStatement(document, "DenyInsecureTransport", `["s3:*"]`, "["+bucketARN+", "+objectsARN+"]", "Bool", "aws:SecureTransport", `["false"]`)
+	body.AppendNewline()
+
+	policy := body.AppendNewBlock("resource", []string{"aws_s3_bucket_policy", "surithena"}).Body()
+	policy.SetAttributeRaw("bucket", rawExpression(bucketID))
+	policy.SetAttributeRaw("policy", rawExpression("data.aws_iam_policy_document.surithena_bucket.json"))
+	body.AppendNewline()
+
+	output := body.AppendNewBlock("output", []string{"kms_key_arn"}).Body()
+	output.SetAttributeRaw("value", rawExpression("aws_kms_key.surithena.arn"))
+
+	return file
+}
+
 func main() {
-	EventModels := map[string]interface{}{
-		"alert": suricata.AlertEvent{},
-		"dns":   suricata.DNSEvent{},
-		"flow":  suricata.FlowEvent{},
-		"http":  suricata.HTTPEvent{},
-		"tls":   suricata.TLSEvent{},
-		"stats": suricata.StatsEvent{},
-		"dhcp":  suricata.DHCPEvent{},
+	command := "generate"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch command {
+	case "generate":
+		generateCommand(args)
+	case "schema":
+		if len(os.Args) < 3 || os.Args[2] != "check" {
+			fmt.Fprintln(os.Stderr, "usage: terraform-generator schema check [flags] [files]")
+			os.Exit(2)
+		}
+		schemaCheckCommand(os.Args[3:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s, expected one of generate, schema check\n", command)
+		os.Exit(2)
+	}
+}
+
+// readConfigFile reads settings from a YAML, JSON or TOML file, e.g. one per environment. Keys are the same as the environment variables in lower case,
+// with event type overrides as flat keys such as flow_table_location. Environment variables still take precedence.
+func readConfigFile(filename string) {
+	if filename == "" {
+		return
+	}
+	viper.SetConfigFile(filename)
+	err := viper.ReadInConfig()
+	if err != nil {
+		fatalf("failed to read %s, %v", filename, err)
+	}
+}
+
+func generateCommand(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	configFile := flags.String("config", "", "settings file for the environment to generate, with the same keys as the environment variables")
+	outputDir := flags.String("output-dir", "", "directory to write the outputs under, overriding output_dir")
+	layout := flags.String("layout", "", "terraform layout, root or module, overriding terraform_layout")
+	migrate := flags.Bool("migrate", false, "generate changes to the tables which aren't additive, once the existing data has been migrated to the new schema")
+	flags.Parse(args)
+	readConfigFile(*configFile)
+	if *outputDir != "" {
+		viper.Set("output_dir", *outputDir)
+	}
+	if *layout != "" {
+		viper.Set("terraform_layout", *layout)
+	}
+
+	modes := []string{}
+	for _, mode := range strings.Split(viper.GetString("output_modes"), ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case OutputModeTerraform, OutputModeDDL, OutputModeCloudFormation, OutputModeGlueJSON, OutputModeDictionary:
+			modes = append(modes, mode)
+		default:
+			panic(fmt.Sprintf("unknown output mode %s, expected one of %s, %s, %s, %s, %s", mode, OutputModeTerraform, OutputModeDDL, OutputModeCloudFormation, OutputModeGlueJSON, OutputModeDictionary))
+		}
+	}
+
+	tables, err := BuildGlueTables()
+	if err != nil {
+		panic(err)
+	}
+	err = CheckSchemaEvolution(tables, *migrate)
+	if err != nil {
+		fatalf("%v", err)
 	}
 
-	for eventName, eventModel := range EventModels {
-		tableName := fmt.Sprintf("%s_events", eventName)
-		table, err := ConvertStructToGlueTable(eventModel, eventName)
+	for _, mode := range modes {
+		var err error
+		switch mode {
+		case OutputModeTerraform:
+			err = WriteTerraform(tables)
+		case OutputModeDDL:
+			err = WriteAthenaDDL(tables)
+		case OutputModeCloudFormation:
+			err = WriteCloudFormationTemplate(tables)
+		case OutputModeGlueJSON:
+			err = WriteGlueTableInputs(tables)
+		case OutputModeDictionary:
+			err = WriteDataDictionary(tables)
+		}
 		if err != nil {
 			panic(err)
 		}
+	}
+}
+
+// TableLocation returns the table_location of the event type, or an empty string if the table is in <type>/ of the events bucket
+func TableLocation(eventName string) string {
+	return viper.GetString(settings.EventTypeKey(eventName, "table_location"))
+}
+
+// outputPath returns the path of an output file under output_dir
+func outputPath(elem ...string) string {
+	return filepath.Join(append([]string{viper.GetString("output_dir")}, elem...)...)
+}
+
+// BuildGlueTables reflects over every event model, returning the tables sorted by event type with the settings for each applied
+func BuildGlueTables() ([]GlueCatalogTable, error) {
+	eventNames := []string{}
+	for eventName := range EventModels {
+		eventNames = append(eventNames, eventName)
+	}
+	sort.Strings(eventNames)
+
+	tables := []GlueCatalogTable{}
+	for _, eventName := range eventNames {
+		table, err := ConvertStructToGlueTable(EventModels[eventName], eventName)
+		if err != nil {
+			return nil, err
+		}
+		table.Name = viper.GetString("table_name_prefix") + table.Name
+		if location := TableLocation(eventName); location != "" {
+			table.StorageDescriptor.Location = location
+		}
+
+		codec, err := storage.ParseCompressionCodec(viper.GetString(settings.EventTypeKey(eventName, "parquet_compression_codec")))
+		if err != nil {
+			return nil, err
+		}
+		table.Parameters["parquet.compression"] = codec.String()
+		table.Parameters["parquet.block.size"] = viper.GetString(settings.EventTypeKey(eventName, "parquet_row_group_size_bytes"))
+		table.Parameters["parquet.page.size"] = viper.GetString(settings.EventTypeKey(eventName, "parquet_page_size_bytes"))
+		partitionLayout, err := storage.ParsePartitionLayout(viper.GetString(settings.EventTypeKey(eventName, "partition_keys")), viper.GetInt(settings.EventTypeKey(eventName, "partition_minute_interval")), "")
+		if err != nil {
+			return nil, err
+		}
+		AddPartitionProjection(&table, partitionLayout, eventName)
+
+		if dateRange := viper.GetString(settings.EventTypeKey(eventName, "projection_event_date_range")); dateRange != "" {
+			table.Parameters["projection.event_date.range"] = dateRange
+		} else if retentionDays := viper.GetInt(settings.EventTypeKey(eventName, "retention_days")); retentionDays > 0 {
+			table.Parameters["projection.event_date.range"] = fmt.Sprintf("NOW-%dDAYS,NOW", retentionDays)
+		}
+
+		if viper.GetString(settings.EventTypeKey(eventName, "table_format")) == "iceberg" {
+			ConvertToIcebergTable(&table)
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// WriteTerraform writes an aws_glue_catalog_table resource per table into terraform/<event type>.tf, the database into terraform/glue.tf, the Athena workgroup,
+// named queries and views into terraform/athena.tf, along with the KMS resources when sse_kms is set and the variables and outputs of the module layout
+func WriteTerraform(tables []GlueCatalogTable) error {
+	var module bool
+	switch viper.GetString("terraform_layout") {
+	case TerraformLayoutRoot:
+	case TerraformLayoutModule:
+		module = true
+	default:
+		return fmt.Errorf("unknown terraform layout %s, expected one of %s, %s", viper.GetString("terraform_layout"), TerraformLayoutRoot, TerraformLayoutModule)
+	}
+	err := os.MkdirAll(outputPath("terraform"), 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		eventName := table.EventName
+		iceberg := table.OpenTableFormatInput != nil
 
 		config := BaseConfig{
 			Resources: []GlueCatalogTable{table},
@@ -256,7 +807,7 @@ func main() {
 
 		//update database name to be variable reference
 		rootBody := hclFile.Body()
-		tableBlock := rootBody.FirstMatchingBlock("resource", []string{"aws_glue_catalog_table", tableName})
+		tableBlock := rootBody.FirstMatchingBlock("resource", []string{"aws_glue_catalog_table", table.NameLabel})
 		tableBlock.Body().SetAttributeTraversal("database_name", hcl.Traversal{
 			hcl.TraverseRoot{
 				Name: "aws_glue_catalog_database",
@@ -309,13 +860,85 @@ func main() {
 				Bytes: []byte("\""),
 			},
 		}
-		storageDescriptor.Body().SetAttributeRaw("location", locationTokens)
+		if location := TableLocation(eventName); location != "" {
+			storageDescriptor.Body().SetAttributeValue("location", cty.StringVal(location))
+		} else {
+			storageDescriptor.Body().SetAttributeRaw("location", locationTokens)
+		}
 
-		filename := fmt.Sprintf("terraform/%s.tf", eventName)
-		err = os.WriteFile(filename, hclFile.Bytes(), 0755)
+		//document the members of struct columns in their parameters, as their types can't carry comments
+		columnIndex := 0
+		for _, block := range storageDescriptor.Body().Blocks() {
+			if block.Type() != "columns" {
+				continue
+			}
+			parameters := ColumnParameters(table.StorageDescriptor.Columns[columnIndex])
+			columnIndex++
+			if len(parameters) == 0 {
+				continue
+			}
+			values := map[string]cty.Value{}
+			for key, value := range parameters {
+				values[key] = cty.StringVal(value)
+			}
+			block.Body().SetAttributeValue("parameters", cty.MapVal(values))
+		}
+
+		if iceberg {
+			lifecycle := tableBlock.Body().AppendNewBlock("lifecycle", nil)
+			lifecycle.Body().SetAttributeRaw("ignore_changes", hclwrite.Tokens{
+				{
+					Type:  hclsyntax.TokenOBrack,
+					Bytes: []byte("["),
+				},
+				{
+					Type:  hclsyntax.TokenIdent,
+					Bytes: []byte("parameters"),
+				},
+				{
+					Type:  hclsyntax.TokenCBrack,
+					Bytes: []byte("]"),
+				},
+			})
+		}
+
+		filename := outputPath("terraform", fmt.Sprintf("%s.tf", eventName))
+		err := os.WriteFile(filename, hclFile.Bytes(), 0755)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 
+	err = os.WriteFile(outputPath("terraform", "glue.tf"), GenerateDatabaseConfig(module).Bytes(), 0755)
+	if err != nil {
+		return err
+	}
+	if module {
+		err = os.WriteFile(outputPath("terraform", "variables.tf"), GenerateModuleVariables().Bytes(), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(outputPath("terraform", "outputs.tf"), GenerateModuleOutputs(tables).Bytes(), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	athenaConfig, err := GenerateAthenaConfig(tables, module)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(outputPath("terraform", "athena.tf"), athenaConfig.Bytes(), 0755)
+	if err != nil {
+		return err
+	}
+
+	if viper.GetBool("sse_kms") {
+		return os.WriteFile(outputPath("terraform", "kms.tf"), GenerateKMSConfig(module).Bytes(), 0755)
+	}
+	err = os.Remove(outputPath("terraform", "kms.tf"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,48 @@
+-- description: Alerts joined to the flow they fired on by flow_id, with the flow's packet and byte counts
+-- view: true
+-- column: event_time timestamp
+-- column: flow_id bigint
+-- column: src_ip string
+-- column: src_port int
+-- column: dest_ip string
+-- column: dest_port int
+-- column: proto string
+-- column: app_proto string
+-- column: signature_id int
+-- column: signature string
+-- column: severity int
+-- column: action string
+-- column: pkts_toserver bigint
+-- column: pkts_toclient bigint
+-- column: bytes_toserver bigint
+-- column: bytes_toclient bigint
+-- column: flow_start string
+-- column: flow_end string
+-- column: flow_state string
+SELECT
+  a.event_time,
+  a.flow_id,
+  a.src_ip,
+  a.src_port,
+  a.dest_ip,
+  a.dest_port,
+  a.proto,
+  a.app_proto,
+  a.alert.signature_id AS signature_id,
+  a.alert.signature AS signature,
+  a.alert.severity AS severity,
+  a.alert.action AS action,
+  f.flow.pkts_toserver AS pkts_toserver,
+  f.flow.pkts_toclient AS pkts_toclient,
+  f.flow.bytes_toserver AS bytes_toserver,
+  f.flow.bytes_toclient AS bytes_toclient,
+  f.flow.start AS flow_start,
+  f.flow."end" AS flow_end,
+  f.flow.state AS flow_state
+FROM {{ table "alert" }} a
+LEFT JOIN {{ table "flow" }} f
+  ON f.flow_id = a.flow_id
+{{- if partitioned "flow" }}
+  -- flows are logged when they end, which can be a while after the alert
+  AND f.event_date BETWEEN a.event_date AND a.event_date + INTERVAL '1' DAY
+{{- end }}
@@ -0,0 +1,35 @@
+-- description: Hours in the last week where a client's NXDOMAIN answers were well above its hourly average, a sign of domain generation algorithms or misconfiguration
+WITH hourly AS (
+  SELECT
+    src_ip,
+    date_trunc('hour', event_time) AS hour,
+    count(*) AS nxdomains,
+    count(DISTINCT domain_data.registered_domain) AS registered_domains
+  FROM {{ table "dns" }}
+  WHERE dns.type = 'answer'
+    AND dns.rcode = 'NXDOMAIN'
+    AND event_time >= current_timestamp - INTERVAL '7' DAY
+{{- if partitioned "dns" }}
+    AND event_date >= current_date - INTERVAL '7' DAY
+{{- end }}
+  GROUP BY src_ip, date_trunc('hour', event_time)
+),
+baseline AS (
+  SELECT
+    src_ip,
+    avg(nxdomains) AS average_nxdomains,
+    stddev_pop(nxdomains) AS stddev_nxdomains
+  FROM hourly
+  GROUP BY src_ip
+)
+SELECT
+  h.src_ip,
+  h.hour,
+  h.nxdomains,
+  h.registered_domains,
+  b.average_nxdomains
+FROM hourly h
+JOIN baseline b ON b.src_ip = h.src_ip
+WHERE h.nxdomains >= 20
+  AND h.nxdomains > b.average_nxdomains + 3 * b.stddev_nxdomains
+ORDER BY h.nxdomains DESC
@@ -0,0 +1,31 @@
+-- description: Server certificates seen in the last week which expire within 30 days, or already have
+-- view: true
+-- column: fingerprint string
+-- column: subject string
+-- column: issuerdn string
+-- column: sni string
+-- column: not_after timestamp
+-- column: days_to_expiry bigint
+-- column: self_signed boolean
+-- column: servers bigint
+-- column: connections bigint
+-- column: last_seen timestamp
+SELECT
+  tls.fingerprint AS fingerprint,
+  arbitrary(tls.subject) AS subject,
+  arbitrary(tls.issuerdn) AS issuerdn,
+  arbitrary(tls.sni) AS sni,
+  max(certificate_data.not_after) AS not_after,
+  date_diff('day', CAST(current_timestamp AS timestamp), max(certificate_data.not_after)) AS days_to_expiry,
+  bool_or(certificate_data.self_signed) AS self_signed,
+  count(DISTINCT dest_ip) AS servers,
+  count(*) AS connections,
+  max(event_time) AS last_seen
+FROM {{ table "tls" }}
+WHERE certificate_data.not_after <= CAST(current_timestamp + INTERVAL '30' DAY AS timestamp)
+  AND tls.fingerprint <> ''
+  AND event_time >= current_timestamp - INTERVAL '7' DAY
+{{- if partitioned "tls" }}
+  AND event_date >= current_date - INTERVAL '7' DAY
+{{- end }}
+GROUP BY tls.fingerprint
@@ -0,0 +1,16 @@
+-- description: Source addresses sending the most bytes over the last day
+SELECT
+  src_ip,
+  count(*) AS flows,
+  count(DISTINCT dest_ip) AS destinations,
+  sum(flow.bytes_toserver) AS bytes_sent,
+  sum(flow.bytes_toclient) AS bytes_received,
+  sum(flow.bytes_toserver + flow.bytes_toclient) AS bytes_total
+FROM {{ table "flow" }}
+WHERE event_time >= current_timestamp - INTERVAL '1' DAY
+{{- if partitioned "flow" }}
+  AND event_date >= current_date - INTERVAL '1' DAY
+{{- end }}
+GROUP BY src_ip
+ORDER BY bytes_total DESC
+LIMIT 50
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	SchemaSourceTerraform = "terraform"
+	SchemaSourceGlue      = "glue"
+	SchemaSourceParquet   = "parquet"
+)
+
+var (
+	// the types each type can be widened to without breaking Athena reads of existing files
+	typeWidenings = map[string][]string{
+		"tinyint":  {"smallint", "int", "bigint"},
+		"smallint": {"int", "bigint"},
+		"int":      {"bigint"},
+		"float":    {"double"},
+	}
+)
+
+// SchemaChange is a difference between a deployed schema, or the schema of a file, and the schema reflected from the models
+type SchemaChange struct {
+	Table    string
+	Column   string
+	Change   string
+	Deployed string
+	Model    string
+	// Breaking changes stop Athena reading data written with the deployed schema
+	Breaking bool
+}
+
+// GlueType is a parsed Hive type string such as struct<name:string,tags:array<string>>
+type GlueType struct {
+	// Kind is primitive, struct, array or map
+	Kind   string
+	Name   string
+	Fields []GlueField
+	Elem   *GlueType
+	Key    *GlueType
+	Value  *GlueType
+}
+
+type GlueField struct {
+	Name string
+	Type *GlueType
+}
+
+func (t *GlueType) String() string {
+	switch t.Kind {
+	case "struct":
+		fields := []string{}
+		for _, field := range t.Fields {
+			fields = append(fields, fmt.Sprintf("%s:%s", field.Name, field.Type))
+		}
+		return fmt.Sprintf("struct<%s>", strings.Join(fields, ","))
+	case "array":
+		return fmt.Sprintf("array<%s>", t.Elem)
+	case "map":
+		return fmt.Sprintf("map<%s,%s>", t.Key, t.Value)
+	}
+	return t.Name
+}
+
+type glueTypeParser struct {
+	input    string
+	position int
+}
+
+func ParseGlueType(input string) (*GlueType, error) {
+	parser := &glueTypeParser{
+		input: strings.ReplaceAll(input, " ", ""),
+	}
+	t, err := parser.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position != len(parser.input) {
+		return nil, fmt.Errorf("unexpected %s at the end of %s", parser.input[parser.position:], input)
+	}
+	return t, nil
+}
+
+// identifier reads up to the next delimiter
+func (p *glueTypeParser) identifier() string {
+	start := p.position
+	for p.position < len(p.input) && !strings.ContainsRune("<>,:(", rune(p.input[p.position])) {
+		p.position++
+	}
+	return strings.ToLower(p.input[start:p.position])
+}
+
+func (p *glueTypeParser) expect(delimiter byte) error {
+	if p.position >= len(p.input) || p.input[p.position] != delimiter {
+		return fmt.Errorf("expected %c at position %d of %s", delimiter, p.position, p.input)
+	}
+	p.position++
+	return nil
+}
+
+func (p *glueTypeParser) next(delimiter byte) bool {
+	if p.position < len(p.input) && p.input[p.position] == delimiter {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func (p *glueTypeParser) parseType() (*GlueType, error) {
+	name := p.identifier()
+	if name == "" {
+		return nil, fmt.Errorf("expected a type at position %d of %s", p.position, p.input)
+	}
+	switch name {
+	case "struct":
+		t := &GlueType{Kind: "struct"}
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		if p.next('>') {
+			return t, nil
+		}
+		for {
+			fieldName := p.identifier()
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			fieldType, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			t.Fields = append(t.Fields, GlueField{
+				Name: fieldName,
+				Type: fieldType,
+			})
+			if p.next('>') {
+				return t, nil
+			}
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+	case "array":
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &GlueType{Kind: "array", Elem: elem}, p.expect('>')
+	case "map":
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		key, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		value, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &GlueType{Kind: "map", Key: key, Value: value}, p.expect('>')
+	}
+	if p.next('(') {
+		// the parameters of types such as decimal(10,2) and varchar(255) are part of the type, so changing them is a retype
+		end := strings.IndexByte(p.input[p.position:], ')')
+		if end <= 0 {
+			return nil, fmt.Errorf("expected the parameters of %s to end with ) at position %d of %s", name, p.position, p.input)
+		}
+		name += "(" + p.input[p.position:p.position+end] + ")"
+		p.position += end + 1
+	}
+	return &GlueType{Kind: "primitive", Name: name}, nil
+}
+
+func widens(from, to string) bool {
+	for _, widened := range typeWidenings[from] {
+		if widened == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareTypes returns the changes from the deployed type to the model's. Members are matched by name, and struct members which are in both but in a different order break reads.
+func CompareTypes(table, column string, deployed, model *GlueType) []SchemaChange {
+	change := SchemaChange{
+		Table:    table,
+		Column:   column,
+		Deployed: deployed.String(),
+		Model:    model.String(),
+	}
+	if deployed.Kind != model.Kind {
+		change.Change = "retyped"
+		change.Breaking = true
+		return []SchemaChange{change}
+	}
+
+	switch deployed.Kind {
+	case "primitive":
+		switch {
+		case deployed.Name == model.Name:
+			return nil
+		case widens(deployed.Name, model.Name):
+			change.Change = "widened"
+		case widens(model.Name, deployed.Name):
+			change.Change = "narrowed"
+			change.Breaking = true
+		default:
+			change.Change = "retyped"
+			change.Breaking = true
+		}
+		return []SchemaChange{change}
+	case "array":
+		return CompareTypes(table, column+"[]", deployed.Elem, model.Elem)
+	case "map":
+		changes := CompareTypes(table, column+"{key}", deployed.Key, model.Key)
+		return append(changes, CompareTypes(table, column+"{value}", deployed.Value, model.Value)...)
+	}
+
+	changes := []SchemaChange{}
+	deployedFields := map[string]*GlueType{}
+	deployedOrder := []string{}
+	for _, field := range deployed.Fields {
+		deployedFields[field.Name] = field.Type
+	}
+	modelFields := map[string]*GlueType{}
+	modelOrder := []string{}
+	for _, field := range model.Fields {
+		modelFields[field.Name] = field.Type
+		if _, ok := deployedFields[field.Name]; ok {
+			modelOrder = append(modelOrder, field.Name)
+		} else {
+			changes = append(changes, SchemaChange{
+				Table:  table,
+				Column: column + "." + field.Name,
+				Change: "added",
+				Model:  field.Type.String(),
+			})
+		}
+	}
+	for _, field := range deployed.Fields {
+		if _, ok := modelFields[field.Name]; ok {
+			deployedOrder = append(deployedOrder, field.Name)
+		} else {
+			changes = append(changes, SchemaChange{
+				Table:    table,
+				Column:   column + "." + field.Name,
+				Change:   "removed",
+				Deployed: field.Type.String(),
+			})
+		}
+	}
+	if strings.Join(deployedOrder, ",") != strings.Join(modelOrder, ",") {
+		changes = append(changes, SchemaChange{
+			Table:    table,
+			Column:   column,
+			Change:   "reordered",
+			Deployed: strings.Join(deployedOrder, ","),
+			Model:    strings.Join(modelOrder, ","),
+			Breaking: true,
+		})
+	}
+	for _, name := range modelOrder {
+		changes = append(changes, CompareTypes(table, column+"."+name, deployedFields[name], modelFields[name])...)
+	}
+	return changes
+}
+
+// CompareColumns compares columns by name, as Athena reads parquet columns by name. Partition keys can't be added or removed without breaking the projection of existing partitions.
+func CompareColumns(table, kind string, deployed, model []Columns) ([]SchemaChange, error) {
+	changes := []SchemaChange{}
+	deployedTypes := map[string]string{}
+	for _, column := range deployed {
+		deployedTypes[column.Name] = column.Type
+	}
+	modelTypes := map[string]string{}
+	for _, column := range model {
+		modelTypes[column.Name] = column.Type
+		deployedType, ok := deployedTypes[column.Name]
+		if !ok {
+			changes = append(changes, SchemaChange{
+				Table:    table,
+				Column:   column.Name,
+				Change:   kind + " added",
+				Model:    column.Type,
+				Breaking: kind == "partition key",
+			})
+			continue
+		}
+		deployedParsed, err := ParseGlueType(deployedType)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", table, column.Name, err)
+		}
+		modelParsed, err := ParseGlueType(column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", table, column.Name, err)
+		}
+		typeChanges := CompareTypes(table, column.Name, deployedParsed, modelParsed)
+		if kind == "partition key" {
+			for i := range typeChanges {
+				typeChanges[i].Breaking = true
+			}
+		}
+		changes = append(changes, typeChanges...)
+	}
+	for _, column := range deployed {
+		if _, ok := modelTypes[column.Name]; !ok {
+			changes = append(changes, SchemaChange{
+				Table:    table,
+				Column:   column.Name,
+				Change:   kind + " removed",
+				Deployed: column.Type,
+				Breaking: kind == "partition key",
+			})
+		}
+	}
+	return changes, nil
+}
+
+// CompareTables compares each deployed table with the model of the same name, and reports model tables with no deployed table when reportMissing is set
+func CompareTables(models, deployed []GlueCatalogTable, comparePartitions, reportMissing bool) ([]SchemaChange, error) {
+	modelTables := map[string]GlueCatalogTable{}
+	for _, table := range models {
+		modelTables[table.Name] = table
+	}
+	deployedTables := map[string]bool{}
+
+	changes := []SchemaChange{}
+	for _, table := range deployed {
+		deployedTables[table.Name] = true
+		model, ok := modelTables[table.Name]
+		if !ok {
+			changes = append(changes, SchemaChange{
+				Table:  table.Name,
+				Change: "table has no model",
+			})
+			continue
+		}
+		columnChanges, err := CompareColumns(table.Name, "column", table.StorageDescriptor.Columns, model.StorageDescriptor.Columns)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, columnChanges...)
+		if comparePartitions {
+			deployedKeys := []Columns{}
+			for _, key := range table.PartitionKeys {
+				deployedKeys = append(deployedKeys, Columns{Name: key.Name, Type: key.Type})
+			}
+			modelKeys := []Columns{}
+			for _, key := range model.PartitionKeys {
+				modelKeys = append(modelKeys, Columns{Name: key.Name, Type: key.Type})
+			}
+			keyChanges, err := CompareColumns(table.Name, "partition key", deployedKeys, modelKeys)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, keyChanges...)
+		}
+	}
+	if reportMissing {
+		for _, table := range models {
+			if !deployedTables[table.Name] {
+				changes = append(changes, SchemaChange{
+					Table:  table.Name,
+					Change: "table not deployed",
+				})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// LoadTerraformTables reads the aws_glue_catalog_table resources from terraform files
+func LoadTerraformTables(filenames []string) ([]GlueCatalogTable, error) {
+	parser := hclparse.NewParser()
+	tables := []GlueCatalogTable{}
+	for _, filename := range filenames {
+		file, diags := parser.ParseHCLFile(filename)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type != "resource" || len(block.Labels) != 2 || block.Labels[0] != "aws_glue_catalog_table" {
+				continue
+			}
+			// views over the tables, such as those from queries/, have no model to compare with
+			if tableType, diags := hclStringAttribute(block.Body, "table_type"); !diags.HasErrors() && tableType == "VIRTUAL_VIEW" {
+				continue
+			}
+			table := GlueCatalogTable{}
+			table.Name, diags = hclStringAttribute(block.Body, "name")
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			table.Parameters, diags = hclStringMapAttribute(block.Body, "parameters")
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			for _, child := range block.Body.Blocks {
+				switch child.Type {
+				case "storage_descriptor":
+					for _, columnBlock := range child.Body.Blocks {
+						if columnBlock.Type != "columns" {
+							continue
+						}
+						column := Columns{}
+						column.Name, diags = hclStringAttribute(columnBlock.Body, "name")
+						if diags.HasErrors() {
+							return nil, diags
+						}
+						column.Type, diags = hclStringAttribute(columnBlock.Body, "type")
+						if diags.HasErrors() {
+							return nil, diags
+						}
+						table.StorageDescriptor.Columns = append(table.StorageDescriptor.Columns, column)
+					}
+				case "partition_keys":
+					key := PartitionKeys{}
+					key.Name, diags = hclStringAttribute(child.Body, "name")
+					if diags.HasErrors() {
+						return nil, diags
+					}
+					key.Type, diags = hclStringAttribute(child.Body, "type")
+					if diags.HasErrors() {
+						return nil, diags
+					}
+					table.PartitionKeys = append(table.PartitionKeys, key)
+				}
+			}
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+func hclStringAttribute(body *hclsyntax.Body, name string) (string, hcl.Diagnostics) {
+	attribute, ok := body.Attributes[name]
+	if !ok {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("missing %s attribute", name),
+			Subject:  body.SrcRange.Ptr(),
+		}}
+	}
+	value, diags := attribute.Expr.Value(nil)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	return value.AsString(), nil
+}
+
+// hclStringMapAttribute returns the values of a map attribute which are strings, or an empty map if the attribute isn't set
+func hclStringMapAttribute(body *hclsyntax.Body, name string) (map[string]string, hcl.Diagnostics) {
+	values := map[string]string{}
+	attribute, ok := body.Attributes[name]
+	if !ok {
+		return values, nil
+	}
+	value, diags := attribute.Expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if !value.CanIterateElements() {
+		return values, nil
+	}
+	for key, element := range value.AsValueMap() {
+		if element.Type() == cty.String && element.IsKnown() && !element.IsNull() {
+			values[key] = element.AsString()
+		}
+	}
+	return values, nil
+}
+
+// LoadGlueJSONTables reads tables from the output of aws glue get-table, the glue-json output, or a bare TableInput
+func LoadGlueJSONTables(filenames []string) ([]GlueCatalogTable, error) {
+	tables := []GlueCatalogTable{}
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		wrapper := struct {
+			Table      *GlueTableInput
+			TableInput *GlueTableInput
+		}{}
+		err = json.Unmarshal(data, &wrapper)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		input := wrapper.Table
+		if input == nil {
+			input = wrapper.TableInput
+		}
+		if input == nil {
+			input = &GlueTableInput{}
+			err = json.Unmarshal(data, input)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+		if input.Name == "" {
+			return nil, fmt.Errorf("%s doesn't contain a Glue table", filename)
+		}
+
+		table := GlueCatalogTable{
+			Name:       input.Name,
+			Parameters: input.Parameters,
+		}
+		for _, column := range input.StorageDescriptor.Columns {
+			table.StorageDescriptor.Columns = append(table.StorageDescriptor.Columns, Columns{
+				Name: column.Name,
+				Type: column.Type,
+			})
+		}
+		for _, key := range input.PartitionKeys {
+			table.PartitionKeys = append(table.PartitionKeys, PartitionKeys{
+				Name: key.Name,
+				Type: key.Type,
+			})
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// LoadParquetTables reads the footer schema of each parquet file, a local path or s3://bucket/key, as a table of the event type, in the order of the files
+func LoadParquetTables(locations []string, eventType string) ([]GlueCatalogTable, error) {
+	var s3Client *s3.Client
+	tables := []GlueCatalogTable{}
+	for _, location := range locations {
+		if strings.HasPrefix(location, "s3://") && s3Client == nil {
+			cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
+			if err != nil {
+				return nil, err
+			}
+			s3Client = s3.NewFromConfig(cfg)
+		}
+		store, key, err := storage.OpenObjectStore(location, s3Client, storage.UploadOptions{})
+		if err != nil {
+			return nil, err
+		}
+		_, schema, err := storage.ReadParquetFooter(store, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read footer of %s: %w", location, err)
+		}
+		columns, err := storage.ParquetColumnTypes(schema)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		table := GlueCatalogTable{
+			Name: fmt.Sprintf("%s_events", eventType),
+		}
+		for _, column := range columns {
+			table.StorageDescriptor.Columns = append(table.StorageDescriptor.Columns, Columns{
+				Name: column.Name,
+				Type: column.Type,
+			})
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func schemaCheckCommand(args []string) {
+	flags := flag.NewFlagSet("schema check", flag.ExitOnError)
+	against := flags.String("against", SchemaSourceTerraform, "what to compare the models with: terraform for .tf files, defaulting to terraform/*.tf under output_dir, glue for Glue table JSON, or parquet for the footers of parquet files")
+	eventType := flags.String("event-type", "", "event type of the parquet files")
+	strict := flags.Bool("strict", false, "exit with an error on any drift, not only on changes which break Athena reads")
+	configFile := flags.String("config", "", "settings file the tables were generated with")
+	flags.Parse(args)
+	readConfigFile(*configFile)
+	files := flags.Args()
+
+	models, err := BuildGlueTables()
+	if err != nil {
+		panic(err)
+	}
+
+	var changes []SchemaChange
+	switch *against {
+	case SchemaSourceTerraform:
+		// every model should have a table when checking all of the generated files
+		reportMissing := len(files) == 0
+		if len(files) == 0 {
+			files, err = filepath.Glob(outputPath("terraform", "*.tf"))
+			if err != nil {
+				panic(err)
+			}
+		}
+		deployed, err := LoadTerraformTables(files)
+		if err != nil {
+			fatalf("failed to read terraform, %v", err)
+		}
+		changes, err = CompareTables(models, deployed, true, reportMissing)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	case SchemaSourceGlue:
+		if len(files) == 0 {
+			fatalf("the Glue table JSON files to check are required")
+		}
+		deployed, err := LoadGlueJSONTables(files)
+		if err != nil {
+			fatalf("failed to read Glue tables, %v", err)
+		}
+		changes, err = CompareTables(models, deployed, true, false)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	case SchemaSourceParquet:
+		if len(files) == 0 || *eventType == "" {
+			fatalf("-event-type and the parquet files to check are required")
+		}
+		if _, ok := EventModels[*eventType]; !ok {
+			fatalf("unknown event type %s", *eventType)
+		}
+		deployed, err := LoadParquetTables(files, *eventType)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for i, table := range deployed {
+			fileChanges, err := CompareTables(models, []GlueCatalogTable{table}, false, false)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			// name the file rather than the table, as every file is of the same table
+			for j := range fileChanges {
+				fileChanges[j].Table = files[i]
+			}
+			changes = append(changes, fileChanges...)
+		}
+	default:
+		fatalf("unknown schema source %s, expected one of %s, %s, %s", *against, SchemaSourceTerraform, SchemaSourceGlue, SchemaSourceParquet)
+	}
+
+	breaking := 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, change := range changes {
+		severity := "drift"
+		if change.Breaking {
+			severity = "BREAKING"
+			breaking++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s -> %s\n", severity, change.Table, change.Column, change.Change, valueOrDash(change.Deployed), valueOrDash(change.Model))
+	}
+	writer.Flush()
+	fmt.Printf("%d changes, %d breaking\n", len(changes), breaking)
+
+	if breaking > 0 || (*strict && len(changes) > 0) {
+		os.Exit(1)
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(2)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// summarizeChanges describes each change as column: change, noting the breaking ones
+func summarizeChanges(changes []SchemaChange) []string {
+	summaries := []string{}
+	for _, change := range changes {
+		summary := change.Column + ": " + change.Change
+		if change.Breaking {
+			summary += " (breaking)"
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestParseGlueType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{input: "string", expected: "string"},
+		{input: "STRUCT<Name: STRING, tags: ARRAY<string>>", expected: "struct<name:string,tags:array<string>>"},
+		{input: "struct<>", expected: "struct<>"},
+		{input: "map<string,array<struct<a:int,b:map<string,bigint>>>>", expected: "map<string,array<struct<a:int,b:map<string,bigint>>>>"},
+		{input: "decimal(10,2)", expected: "decimal(10,2)"},
+		{input: "struct<price:decimal(10, 2),name:varchar(255)>", expected: "struct<price:decimal(10,2),name:varchar(255)>"},
+		{input: "map<decimal(38,0),char(1)>", expected: "map<decimal(38,0),char(1)>"},
+		{input: "", err: "expected a type at position 0"},
+		{input: "array<int", err: "expected > at position 9"},
+		{input: "map<string>", err: "expected , at position 10"},
+		{input: "struct<a:int>x", err: "unexpected x at the end"},
+		{input: "decimal(10,2", err: "expected the parameters of decimal to end with )"},
+		{input: "decimal()", err: "expected the parameters of decimal to end with )"},
+		{input: "array(int)", err: "expected < at position 5"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			parsed, err := ParseGlueType(test.input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("error is %v, expected it to contain %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.String() != test.expected {
+				t.Errorf("parsed as %s, expected %s", parsed, test.expected)
+			}
+		})
+	}
+}
+
+func TestCompareTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		deployed string
+		model    string
+		expected []string
+	}{
+		{name: "unchanged", deployed: "struct<a:int,b:array<string>>", model: "struct<a:int,b:array<string>>"},
+		{name: "widened", deployed: "int", model: "bigint", expected: []string{"c: widened"}},
+		{name: "widened float", deployed: "float", model: "double", expected: []string{"c: widened"}},
+		{name: "narrowed", deployed: "bigint", model: "smallint", expected: []string{"c: narrowed (breaking)"}},
+		{name: "retyped", deployed: "int", model: "string", expected: []string{"c: retyped (breaking)"}},
+		{name: "decimal precision changed", deployed: "decimal(10,2)", model: "decimal(12,2)", expected: []string{"c: retyped (breaking)"}},
+		{name: "kind changed", deployed: "int", model: "array<int>", expected: []string{"c: retyped (breaking)"}},
+		{name: "member added", deployed: "struct<a:int>", model: "struct<a:int,b:string>", expected: []string{"c.b: added"}},
+		{name: "member removed", deployed: "struct<a:int,b:string>", model: "struct<a:int>", expected: []string{"c.b: removed"}},
+		{
+			name:     "members reordered",
+			deployed: "struct<a:int,b:string,c:double>",
+			model:    "struct<b:string,a:int,c:double>",
+			expected: []string{"c: reordered (breaking)"},
+		},
+		{
+			// a member added in between doesn't change the order of the others
+			name:     "member added in between",
+			deployed: "struct<a:int,c:double>",
+			model:    "struct<a:int,b:string,c:double>",
+			expected: []string{"c.b: added"},
+		},
+		{
+			name:     "nested member widened",
+			deployed: "array<struct<a:int,b:struct<d:int>>>",
+			model:    "array<struct<a:bigint,b:struct<d:int,e:string>>>",
+			expected: []string{"c[].a: widened", "c[].b.e: added"},
+		},
+		{
+			name:     "nested members reordered",
+			deployed: "struct<x:array<struct<a:int,b:int>>>",
+			model:    "struct<x:array<struct<b:int,a:int>>>",
+			expected: []string{"c.x[]: reordered (breaking)"},
+		},
+		{
+			name:     "map key and value changed",
+			deployed: "map<int,struct<a:bigint>>",
+			model:    "map<string,struct<a:int>>",
+			expected: []string{"c{key}: retyped (breaking)", "c{value}.a: narrowed (breaking)"},
+		},
+		{name: "map to array", deployed: "map<string,int>", model: "array<int>", expected: []string{"c: retyped (breaking)"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployed, err := ParseGlueType(test.deployed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			model, err := ParseGlueType(test.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := test.expected
+			if expected == nil {
+				expected = []string{}
+			}
+			if changes := summarizeChanges(CompareTypes("test_events", "c", deployed, model)); !reflect.DeepEqual(changes, expected) {
+				t.Errorf("changes are %q, expected %q", changes, expected)
+			}
+		})
+	}
+}
+
+func TestCompareColumns(t *testing.T) {
+	deployed := []Columns{{Name: "a", Type: "int"}, {Name: "b", Type: "string"}}
+	tests := []struct {
+		name     string
+		kind     string
+		model    []Columns
+		expected []string
+		err      string
+	}{
+		{name: "unchanged", kind: "column", model: deployed},
+		{name: "reordered", kind: "column", model: []Columns{{Name: "b", Type: "string"}, {Name: "a", Type: "int"}}},
+		{name: "column added", kind: "column", model: append(deployed, Columns{Name: "c", Type: "string"}), expected: []string{"c: column added"}},
+		{name: "column removed", kind: "column", model: deployed[:1], expected: []string{"b: column removed"}},
+		{name: "column widened", kind: "column", model: []Columns{{Name: "a", Type: "bigint"}, {Name: "b", Type: "string"}}, expected: []string{"a: widened"}},
+		{name: "partition key added", kind: "partition key", model: append(deployed, Columns{Name: "c", Type: "string"}), expected: []string{"c: partition key added (breaking)"}},
+		{name: "partition key removed", kind: "partition key", model: deployed[:1], expected: []string{"b: partition key removed (breaking)"}},
+		{name: "partition key widened", kind: "partition key", model: []Columns{{Name: "a", Type: "bigint"}, {Name: "b", Type: "string"}}, expected: []string{"a: widened (breaking)"}},
+		{name: "invalid type", kind: "column", model: []Columns{{Name: "a", Type: "array<int"}}, err: "test_events.a: expected >"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := CompareColumns("test_events", test.kind, deployed, test.model)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("error is %v, expected it to contain %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := test.expected
+			if expected == nil {
+				expected = []string{}
+			}
+			if summaries := summarizeChanges(changes); !reflect.DeepEqual(summaries, expected) {
+				t.Errorf("changes are %q, expected %q", summaries, expected)
+			}
+		})
+	}
+}
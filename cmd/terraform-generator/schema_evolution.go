@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sheacloud/surithena/pkg/suricata"
+)
+
+var (
+	// the changes Athena can read existing files through, as old files read new columns as NULL and widened types are promoted
+	additiveChanges = map[string]bool{
+		"column added": true,
+		"added":        true,
+		"widened":      true,
+	}
+)
+
+// Additive returns whether the table can still read every file written with the deployed schema after the change
+func (c SchemaChange) Additive() bool {
+	return additiveChanges[c.Change]
+}
+
+// changelogPath converts a column as schema check reports it to the name the changelog records it under, e.g. answers[].ttl to answers.ttl
+func changelogPath(column string) string {
+	for _, suffix := range []string{"[]", "{key}", "{value}"} {
+		column = strings.ReplaceAll(column, suffix, "")
+	}
+	return column
+}
+
+// TableSchemaVersion returns the schema version a table was generated with, or 0 for tables generated before models were versioned
+func TableSchemaVersion(table GlueCatalogTable) int {
+	version, _ := strconv.Atoi(table.Parameters[storage.SchemaVersionMetadataKey])
+	return version
+}
+
+// ValidateSchemaChangelog checks the changelog of a model starts at version 1, increases by one with each entry, ends at the model's schema version and only lists columns the table has
+func ValidateSchemaChangelog(model suricata.VersionedModel, table GlueCatalogTable) error {
+	changelog := model.SchemaChangelog()
+	if len(changelog) == 0 {
+		return fmt.Errorf("%s: the schema changelog is empty", table.Name)
+	}
+
+	paths := map[string]bool{}
+	for _, column := range table.StorageDescriptor.Columns {
+		paths[column.Name] = true
+		for _, member := range column.Members {
+			paths[column.Name+"."+member.Path] = true
+		}
+	}
+	for i, revision := range changelog {
+		if revision.Version != i+1 {
+			return fmt.Errorf("%s: schema changelog entry %d is version %d, expected %d", table.Name, i, revision.Version, i+1)
+		}
+		for _, column := range revision.Added {
+			if !paths[column] {
+				return fmt.Errorf("%s: schema version %d adds %s, which the model doesn't have", table.Name, revision.Version, column)
+			}
+		}
+	}
+	if latest := changelog[len(changelog)-1].Version; latest != model.SchemaVersion() {
+		return fmt.Errorf("%s: the model is schema version %d but its changelog ends at version %d", table.Name, model.SchemaVersion(), latest)
+	}
+	return nil
+}
+
+// addedSince returns the columns the changelog records as added after the given version
+func addedSince(changelog []suricata.SchemaRevision, version int) map[string]bool {
+	added := map[string]bool{}
+	for _, revision := range changelog {
+		if revision.Version <= version {
+			continue
+		}
+		for _, column := range revision.Added {
+			added[column] = true
+		}
+	}
+	return added
+}
+
+// CheckSchemaEvolution compares the models with the tables previously generated into terraform/, so a generation only ever adds columns to what's deployed.
+// Every change has to be additive and recorded in the changelog of a new schema version, unless migrate is set, in which case other changes are only logged.
+func CheckSchemaEvolution(models []GlueCatalogTable, migrate bool) error {
+	for _, table := range models {
+		model, ok := EventModels[table.EventName].(suricata.VersionedModel)
+		if !ok {
+			continue
+		}
+		err := ValidateSchemaChangelog(model, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	filenames, err := filepath.Glob(outputPath("terraform", "*.tf"))
+	if err != nil {
+		return err
+	}
+	deployed, err := LoadTerraformTables(filenames)
+	if err != nil {
+		return fmt.Errorf("failed to read the previously generated terraform, %w", err)
+	}
+	deployedTables := map[string]GlueCatalogTable{}
+	for _, table := range deployed {
+		deployedTables[table.Name] = table
+	}
+
+	breaking := []string{}
+	unrecorded := []string{}
+	for _, table := range models {
+		deployedTable, ok := deployedTables[table.Name]
+		if !ok {
+			continue
+		}
+		changes, err := CompareTables([]GlueCatalogTable{table}, []GlueCatalogTable{deployedTable}, true, false)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		model, versioned := EventModels[table.EventName].(suricata.VersionedModel)
+		deployedVersion := TableSchemaVersion(deployedTable)
+		if versioned && deployedVersion > 0 && model.SchemaVersion() <= deployedVersion {
+			unrecorded = append(unrecorded, fmt.Sprintf("%s: the schema changed but is still version %d", table.Name, deployedVersion))
+		}
+		var added map[string]bool
+		if versioned {
+			added = addedSince(model.SchemaChangelog(), deployedVersion)
+		}
+
+		for _, change := range changes {
+			description := fmt.Sprintf("%s: %s %s (%s -> %s)", table.Name, change.Column, change.Change, valueOrDash(change.Deployed), valueOrDash(change.Model))
+			if !change.Additive() {
+				if migrate {
+					fmt.Fprintf(os.Stderr, "migrating %s\n", description)
+					continue
+				}
+				breaking = append(breaking, description)
+				continue
+			}
+			if change.Change != "widened" && versioned && deployedVersion > 0 && !added[changelogPath(change.Column)] {
+				unrecorded = append(unrecorded, fmt.Sprintf("%s: %s isn't in the changelog", table.Name, changelogPath(change.Column)))
+			}
+		}
+	}
+	if len(breaking) > 0 {
+		return fmt.Errorf("refusing to generate changes which aren't additive, run with -migrate once the existing data has been migrated:\n%s", strings.Join(breaking, "\n"))
+	}
+	if len(unrecorded) > 0 {
+		return fmt.Errorf("the models changed without a new schema version, bump the version and list the added columns in the changelog of the model:\n%s", strings.Join(unrecorded, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sheacloud/surithena/internal/storage"
+	"github.com/sheacloud/surithena/pkg/suricata"
+	"github.com/spf13/viper"
+)
+
+// testModel is a versioned model with a changelog set by each test
+type testModel struct {
+	version   int
+	changelog []suricata.SchemaRevision
+}
+
+func (m testModel) SchemaVersion() int {
+	return m.version
+}
+
+func (m testModel) SchemaChangelog() []suricata.SchemaRevision {
+	return m.changelog
+}
+
+func testChangelog(added ...[]string) []suricata.SchemaRevision {
+	changelog := []suricata.SchemaRevision{{Version: 1}}
+	for i, columns := range added {
+		changelog = append(changelog, suricata.SchemaRevision{Version: i + 2, Added: columns})
+	}
+	return changelog
+}
+
+func testTable(version int, columns ...Columns) GlueCatalogTable {
+	return GlueCatalogTable{
+		EventName: "test",
+		Name:      "test_events",
+		Parameters: map[string]string{
+			storage.SchemaVersionMetadataKey: fmt.Sprint(version),
+		},
+		StorageDescriptor: StorageDescriptor{
+			Columns: columns,
+		},
+	}
+}
+
+// writeDeployedTable writes the table as a previous run of the generator would have into terraform/ under dir
+func writeDeployedTable(t *testing.T, dir string, table GlueCatalogTable) {
+	t.Helper()
+	config := &strings.Builder{}
+	fmt.Fprintf(config, "resource \"aws_glue_catalog_table\" \"%s\" {\n", table.Name)
+	fmt.Fprintf(config, "  name = \"%s\"\n", table.Name)
+	fmt.Fprintf(config, "  parameters = {\n    \"%s\" = \"%s\"\n  }\n", storage.SchemaVersionMetadataKey, table.Parameters[storage.SchemaVersionMetadataKey])
+	fmt.Fprintf(config, "  storage_descriptor {\n")
+	for _, column := range table.StorageDescriptor.Columns {
+		fmt.Fprintf(config, "    columns {\n      name = \"%s\"\n      type = \"%s\"\n    }\n", column.Name, column.Type)
+	}
+	fmt.Fprintf(config, "  }\n}\n")
+
+	err := os.MkdirAll(filepath.Join(dir, "terraform"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "terraform", "test.tf"), []byte(config.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateSchemaChangelog(t *testing.T) {
+	table := testTable(2,
+		Columns{Name: "a", Type: "int"},
+		Columns{Name: "b", Type: "struct<c:int>", Members: []ColumnMember{{Path: "c", Type: "int"}}},
+	)
+	tests := []struct {
+		name  string
+		model testModel
+		err   string
+	}{
+		{name: "valid", model: testModel{version: 2, changelog: testChangelog([]string{"a", "b.c"})}},
+		{name: "empty", model: testModel{version: 1}, err: "the schema changelog is empty"},
+		{name: "skipped version", model: testModel{version: 3, changelog: []suricata.SchemaRevision{{Version: 1}, {Version: 3}}}, err: "entry 1 is version 3, expected 2"},
+		{name: "unknown column", model: testModel{version: 2, changelog: testChangelog([]string{"d"})}, err: "schema version 2 adds d, which the model doesn't have"},
+		{name: "version ahead of changelog", model: testModel{version: 3, changelog: testChangelog(nil)}, err: "the model is schema version 3 but its changelog ends at version 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSchemaChangelog(test.model, table)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error is %v, expected it to contain %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCheckSchemaEvolution(t *testing.T) {
+	deployedColumns := []Columns{{Name: "a", Type: "int"}, {Name: "b", Type: "string"}}
+	tests := []struct {
+		name     string
+		deployed GlueCatalogTable
+		model    testModel
+		columns  []Columns
+		migrate  bool
+		err      string
+	}{
+		{
+			name:     "unchanged",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 1, changelog: testChangelog()},
+			columns:  deployedColumns,
+		},
+		{
+			name:     "column added and recorded",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog([]string{"c"})},
+			columns:  append(deployedColumns, Columns{Name: "c", Type: "string"}),
+		},
+		{
+			name:     "column added without a new version",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 1, changelog: testChangelog()},
+			columns:  append(deployedColumns, Columns{Name: "c", Type: "string"}),
+			err:      "the schema changed but is still version 1",
+		},
+		{
+			name:     "column added without a changelog entry",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog(nil)},
+			columns:  append(deployedColumns, Columns{Name: "c", Type: "string"}),
+			err:      "c isn't in the changelog",
+		},
+		{
+			name:     "column added to a table from before versioning",
+			deployed: testTable(0, deployedColumns...),
+			model:    testModel{version: 1, changelog: testChangelog()},
+			columns:  append(deployedColumns, Columns{Name: "c", Type: "string"}),
+		},
+		{
+			name:     "column widened",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog(nil)},
+			columns:  []Columns{{Name: "a", Type: "bigint"}, {Name: "b", Type: "string"}},
+		},
+		{
+			name:     "column removed",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog(nil)},
+			columns:  deployedColumns[:1],
+			err:      "refusing to generate changes which aren't additive",
+		},
+		{
+			name:     "column removed with migrate",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog(nil)},
+			columns:  deployedColumns[:1],
+			migrate:  true,
+		},
+		{
+			name:     "type changed",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog(nil)},
+			columns:  []Columns{{Name: "a", Type: "string"}, {Name: "b", Type: "string"}},
+			err:      "refusing to generate changes which aren't additive",
+		},
+		{
+			name:     "invalid changelog",
+			deployed: testTable(1, deployedColumns...),
+			model:    testModel{version: 2, changelog: testChangelog()},
+			columns:  deployedColumns,
+			err:      "the model is schema version 2 but its changelog ends at version 1",
+		},
+	}
+
+	previousModels := EventModels
+	previousOutputDir := viper.GetString("output_dir")
+	defer func() {
+		EventModels = previousModels
+		viper.Set("output_dir", previousOutputDir)
+	}()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			viper.Set("output_dir", dir)
+			writeDeployedTable(t, dir, test.deployed)
+			EventModels = map[string]interface{}{"test": test.model}
+
+			err := CheckSchemaEvolution([]GlueCatalogTable{testTable(test.model.version, test.columns...)}, test.migrate)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error is %v, expected it to contain %s", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package settings
+
+import (
+	"github.com/spf13/viper"
+)
+
+// EventTypeKey returns the event type specific override of a setting, e.g. flow_parquet_compression_codec for parquet_compression_codec, if it is set, otherwise the setting itself
+func EventTypeKey(eventType, key string) string {
+	overrideKey := eventType + "_" + key
+	if viper.IsSet(overrideKey) {
+		return overrideKey
+	}
+	return key
+}
@@ -0,0 +1,487 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A minimal implementation of Avro object container files, enough to read and write Iceberg manifests and manifest lists.
+// Records decode to map[string]interface{}, arrays to []interface{}, int and long to int64, float and double to float64 and bytes and fixed to []byte.
+
+var (
+	avroMagic = []byte{'O', 'b', 'j', 1}
+)
+
+type avroSchema struct {
+	Type     string
+	Name     string
+	Fields   []avroField
+	Items    *avroSchema
+	Values   *avroSchema
+	Branches []*avroSchema
+	Size     int
+	Symbols  []string
+}
+
+type avroField struct {
+	Name   string
+	Schema *avroSchema
+}
+
+func parseAvroSchema(schemaJSON []byte) (*avroSchema, error) {
+	var raw interface{}
+	err := json.Unmarshal(schemaJSON, &raw)
+	if err != nil {
+		return nil, err
+	}
+	return parseAvroSchemaValue(raw, map[string]*avroSchema{})
+}
+
+func parseAvroSchemaValue(raw interface{}, named map[string]*avroSchema) (*avroSchema, error) {
+	switch v := raw.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{Type: v}, nil
+		}
+		if s, ok := named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown avro type %s", v)
+	case []interface{}:
+		s := &avroSchema{Type: "union"}
+		for _, branch := range v {
+			b, err := parseAvroSchemaValue(branch, named)
+			if err != nil {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, b)
+		}
+		return s, nil
+	case map[string]interface{}:
+		t, _ := v["type"].(string)
+		name, _ := v["name"].(string)
+		switch t {
+		case "record":
+			s := &avroSchema{Type: t, Name: name}
+			named[name] = s
+			fields, _ := v["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				fieldName, _ := field["name"].(string)
+				fieldSchema, err := parseAvroSchemaValue(field["type"], named)
+				if err != nil {
+					return nil, err
+				}
+				s.Fields = append(s.Fields, avroField{Name: fieldName, Schema: fieldSchema})
+			}
+			return s, nil
+		case "array":
+			items, err := parseAvroSchemaValue(v["items"], named)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{Type: t, Items: items}, nil
+		case "map":
+			values, err := parseAvroSchemaValue(v["values"], named)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{Type: t, Values: values}, nil
+		case "fixed":
+			size, _ := v["size"].(float64)
+			s := &avroSchema{Type: t, Name: name, Size: int(size)}
+			named[name] = s
+			return s, nil
+		case "enum":
+			s := &avroSchema{Type: t, Name: name}
+			symbols, _ := v["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				symbolString, _ := symbol.(string)
+				s.Symbols = append(s.Symbols, symbolString)
+			}
+			named[name] = s
+			return s, nil
+		default:
+			// a primitive with attributes such as a logicalType
+			return parseAvroSchemaValue(v["type"], named)
+		}
+	}
+	return nil, fmt.Errorf("invalid avro schema %v", raw)
+}
+
+func avroInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf("expected an integer but got %T", value)
+}
+
+func writeAvroLong(buf *bytes.Buffer, v int64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(b, v)
+	buf.Write(b[:n])
+}
+
+func writeAvroBytes(buf *bytes.Buffer, b []byte) {
+	writeAvroLong(buf, int64(len(b)))
+	buf.Write(b)
+}
+
+func encodeAvro(buf *bytes.Buffer, s *avroSchema, value interface{}) error {
+	switch s.Type {
+	case "null":
+		return nil
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a bool but got %T", value)
+		}
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		v, err := avroInt64(value)
+		if err != nil {
+			return err
+		}
+		writeAvroLong(buf, v)
+	case "float":
+		v, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected a float64 but got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, float32(v))
+	case "double":
+		v, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected a float64 but got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, v)
+	case "bytes":
+		b, ok := value.([]byte)
+		if !ok {
+			return fmt.Errorf("expected bytes but got %T", value)
+		}
+		writeAvroBytes(buf, b)
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string but got %T", value)
+		}
+		writeAvroBytes(buf, []byte(str))
+	case "fixed":
+		b, ok := value.([]byte)
+		if !ok || len(b) != s.Size {
+			return fmt.Errorf("expected %d fixed bytes but got %T", s.Size, value)
+		}
+		buf.Write(b)
+	case "enum":
+		str, _ := value.(string)
+		for i, symbol := range s.Symbols {
+			if symbol == str {
+				writeAvroLong(buf, int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown enum symbol %v", value)
+	case "record":
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a record for %s but got %T", s.Name, value)
+		}
+		for _, field := range s.Fields {
+			err := encodeAvro(buf, field.Schema, record[field.Name])
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", s.Name, field.Name, err)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok && value != nil {
+			return fmt.Errorf("expected an array but got %T", value)
+		}
+		if len(items) > 0 {
+			writeAvroLong(buf, int64(len(items)))
+			for _, item := range items {
+				err := encodeAvro(buf, s.Items, item)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+	case "map":
+		values, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return fmt.Errorf("expected a map but got %T", value)
+		}
+		if len(values) > 0 {
+			writeAvroLong(buf, int64(len(values)))
+			for k, v := range values {
+				writeAvroBytes(buf, []byte(k))
+				err := encodeAvro(buf, s.Values, v)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+	case "union":
+		// unions are only used for optional values, so pick null for nil and the first other branch for anything else
+		for i, branch := range s.Branches {
+			if (value == nil) == (branch.Type == "null") {
+				writeAvroLong(buf, int64(i))
+				return encodeAvro(buf, branch, value)
+			}
+		}
+		return fmt.Errorf("no union branch for %T", value)
+	default:
+		return fmt.Errorf("unsupported avro type %s", s.Type)
+	}
+	return nil
+}
+
+func readAvroLong(r *bytes.Reader) (int64, error) {
+	return binary.ReadVarint(r)
+}
+
+func readAvroBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readAvroLong(r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > int64(r.Len()) {
+		return nil, errors.New("invalid avro length")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func decodeAvro(r *bytes.Reader, s *avroSchema) (interface{}, error) {
+	switch s.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.ReadByte()
+		return b != 0, err
+	case "int", "long":
+		return readAvroLong(r)
+	case "float":
+		var v float32
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return float64(v), err
+	case "double":
+		var v uint64
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return math.Float64frombits(v), err
+	case "bytes":
+		return readAvroBytes(r)
+	case "string":
+		b, err := readAvroBytes(r)
+		return string(b), err
+	case "fixed":
+		b := make([]byte, s.Size)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	case "enum":
+		i, err := readAvroLong(r)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.Symbols) {
+			return nil, errors.New("invalid avro enum index")
+		}
+		return s.Symbols[i], nil
+	case "record":
+		record := map[string]interface{}{}
+		for _, field := range s.Fields {
+			v, err := decodeAvro(r, field.Schema)
+			if err != nil {
+				return nil, err
+			}
+			record[field.Name] = v
+		}
+		return record, nil
+	case "array", "map":
+		items := []interface{}{}
+		values := map[string]interface{}{}
+		for {
+			count, err := readAvroLong(r)
+			if err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				break
+			}
+			if count < 0 {
+				// a negative count is followed by the size of the block in bytes
+				count = -count
+				_, err = readAvroLong(r)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for i := int64(0); i < count; i++ {
+				if s.Type == "array" {
+					v, err := decodeAvro(r, s.Items)
+					if err != nil {
+						return nil, err
+					}
+					items = append(items, v)
+				} else {
+					k, err := readAvroBytes(r)
+					if err != nil {
+						return nil, err
+					}
+					v, err := decodeAvro(r, s.Values)
+					if err != nil {
+						return nil, err
+					}
+					values[string(k)] = v
+				}
+			}
+		}
+		if s.Type == "array" {
+			return items, nil
+		}
+		return values, nil
+	case "union":
+		i, err := readAvroLong(r)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.Branches) {
+			return nil, errors.New("invalid avro union index")
+		}
+		return decodeAvro(r, s.Branches[i])
+	}
+	return nil, fmt.Errorf("unsupported avro type %s", s.Type)
+}
+
+// writeAvroFile writes the records as a single, uncompressed, block
+func writeAvroFile(w io.Writer, schemaJSON string, metadata map[string]string, records []interface{}) error {
+	schema, err := parseAvroSchema([]byte(schemaJSON))
+	if err != nil {
+		return err
+	}
+
+	header := &bytes.Buffer{}
+	header.Write(avroMagic)
+	headerMetadata := map[string]interface{}{
+		"avro.schema": []byte(schemaJSON),
+		"avro.codec":  []byte("null"),
+	}
+	for k, v := range metadata {
+		headerMetadata[k] = []byte(v)
+	}
+	err = encodeAvro(header, &avroSchema{Type: "map", Values: &avroSchema{Type: "bytes"}}, headerMetadata)
+	if err != nil {
+		return err
+	}
+	sync := make([]byte, 16)
+	_, err = rand.Read(sync)
+	if err != nil {
+		return err
+	}
+	header.Write(sync)
+
+	block := &bytes.Buffer{}
+	for _, record := range records {
+		err = encodeAvro(block, schema, record)
+		if err != nil {
+			return err
+		}
+	}
+	if len(records) > 0 {
+		writeAvroLong(header, int64(len(records)))
+		writeAvroLong(header, int64(block.Len()))
+		header.Write(block.Bytes())
+		header.Write(sync)
+	}
+
+	_, err = w.Write(header.Bytes())
+	return err
+}
+
+// readAvroFile returns the records and header metadata of an object container file
+func readAvroFile(data []byte) ([]interface{}, map[string][]byte, error) {
+	if !bytes.HasPrefix(data, avroMagic) {
+		return nil, nil, errors.New("not an avro file")
+	}
+	r := bytes.NewReader(data[len(avroMagic):])
+
+	rawMetadata, err := decodeAvro(r, &avroSchema{Type: "map", Values: &avroSchema{Type: "bytes"}})
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := map[string][]byte{}
+	for k, v := range rawMetadata.(map[string]interface{}) {
+		metadata[k] = v.([]byte)
+	}
+	schema, err := parseAvroSchema(metadata["avro.schema"])
+	if err != nil {
+		return nil, nil, err
+	}
+	codec := string(metadata["avro.codec"])
+	if codec != "" && codec != "null" && codec != "deflate" {
+		return nil, nil, fmt.Errorf("unsupported avro codec %s", codec)
+	}
+	sync := make([]byte, 16)
+	_, err = io.ReadFull(r, sync)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := []interface{}{}
+	for r.Len() > 0 {
+		count, err := readAvroLong(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		block, err := readAvroBytes(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		if codec == "deflate" {
+			block, err = io.ReadAll(flate.NewReader(bytes.NewReader(block)))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		blockReader := bytes.NewReader(block)
+		for i := int64(0); i < count; i++ {
+			record, err := decodeAvro(blockReader, schema)
+			if err != nil {
+				return nil, nil, err
+			}
+			records = append(records, record)
+		}
+		blockSync := make([]byte, 16)
+		_, err = io.ReadFull(r, blockSync)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(sync, blockSync) {
+			return nil, nil, errors.New("avro sync marker mismatch")
+		}
+	}
+	return records, metadata, nil
+}
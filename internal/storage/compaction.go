@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+const (
+	EventTimeColumn = "event_time"
+)
+
+type CompactionOptions struct {
+	TargetSize      int64
+	SortByEventTime bool
+	DryRun          bool
+	ParquetOptions  ParquetOptions
+	// SensorName names the merged files and the manifest compaction keeps in each partition, as the RotatingWriter names its own
+	SensorName string
+}
+
+type parquetFileInfo struct {
+	ObjectInfo
+	rows     int64
+	schema   []*parquet.SchemaElement
+	metadata []*parquet.KeyValue
+}
+
+// CompactionGroup is a set of files in one partition which are merged into a single file
+type CompactionGroup struct {
+	Partition string
+	Inputs    []string
+	InputSize int64
+	Rows      int64
+	Output    string
+	schema    []*parquet.SchemaElement
+	// metadata is the key-value metadata of the inputs, such as their schema version, which the merged file keeps
+	metadata []*parquet.KeyValue
+}
+
+// ReadParquetFooter returns the row count and schema of a parquet file, with the schema names as written rather than as renamed by the reader
+func ReadParquetFooter(store ObjectStore, key string) (int64, []*parquet.SchemaElement, error) {
+	info, err := readParquetFileInfo(store, ObjectInfo{Key: key})
+	return info.rows, info.schema, err
+}
+
+func readParquetFileInfo(store ObjectStore, object ObjectInfo) (parquetFileInfo, error) {
+	file, err := store.Open(object.Key)
+	if err != nil {
+		return parquetFileInfo{}, err
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		return parquetFileInfo{}, err
+	}
+	return parquetFileInfo{
+		ObjectInfo: object,
+		rows:       pr.GetNumRows(),
+		schema:     writerSchema(pr),
+		metadata:   pr.Footer.KeyValueMetadata,
+	}, nil
+}
+
+// writerSchema copies the schema of a file opened without a model, restoring the original column names the reader replaces with Go field names
+func writerSchema(pr *reader.ParquetReader) []*parquet.SchemaElement {
+	schema := make([]*parquet.SchemaElement, len(pr.Footer.Schema))
+	for i, element := range pr.Footer.Schema {
+		elementCopy := *element
+		elementCopy.Name = pr.SchemaHandler.Infos[i].ExName
+		schema[i] = &elementCopy
+	}
+	return schema
+}
+
+func schemaFingerprint(schema []*parquet.SchemaElement) string {
+	parts := make([]string, len(schema))
+	for i, element := range schema {
+		parts[i] = fmt.Sprintf("%s:%v:%v:%v:%d", element.Name, element.Type, element.ConvertedType, element.RepetitionType, element.GetNumChildren())
+	}
+	return strings.Join(parts, ";")
+}
+
+// PlanCompaction lists the parquet files under prefix and bin-packs the files of each partition into groups no larger than the target size.
+// Files are only grouped with files of an identical schema and schema version, and groups of a single file are left alone.
+func PlanCompaction(store ObjectStore, prefix string, targetSize int64) ([]*CompactionGroup, error) {
+	objects, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := map[string]map[string][]parquetFileInfo{}
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, ".parquet") || hiddenKey(object.Key) {
+			continue
+		}
+		info, err := readParquetFileInfo(store, object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read footer of %s: %w", store.URL(object.Key), err)
+		}
+		partition := path.Dir(object.Key)
+		fingerprint := schemaFingerprint(info.schema) + "|" + metadataFingerprint(info.metadata)
+		if _, ok := partitions[partition]; !ok {
+			partitions[partition] = map[string][]parquetFileInfo{}
+		}
+		partitions[partition][fingerprint] = append(partitions[partition][fingerprint], info)
+	}
+
+	groups := []*CompactionGroup{}
+	for partition, schemas := range partitions {
+		for _, files := range schemas {
+			sort.Slice(files, func(i, j int) bool {
+				return files[i].Size < files[j].Size
+			})
+
+			var group *CompactionGroup
+			for _, file := range files {
+				if group == nil || group.InputSize+file.Size > targetSize {
+					if group != nil && len(group.Inputs) > 1 {
+						groups = append(groups, group)
+					}
+					group = &CompactionGroup{
+						Partition: partition,
+						schema:    file.schema,
+						metadata:  file.metadata,
+					}
+				}
+				group.Inputs = append(group.Inputs, file.Key)
+				group.InputSize += file.Size
+				group.Rows += file.rows
+			}
+			if group != nil && len(group.Inputs) > 1 {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Partition < groups[j].Partition
+	})
+	return groups, nil
+}
+
+// Compact merges every group of small files under prefix. Merged files are written under a hidden key, their row count verified, and only then moved into place,
+// added to the partition manifest along with the originals they replace, and the originals deleted.
+// There is still a short window between the move and the delete where readers may see both.
+func Compact(store ObjectStore, prefix string, options CompactionOptions) ([]*CompactionGroup, error) {
+	groups, err := PlanCompaction(store, prefix, options.TargetSize)
+	if err != nil {
+		return nil, err
+	}
+
+	namer := newObjectNamer(options.SensorName, time.Now())
+	for _, group := range groups {
+		group.Output = path.Join(group.Partition, namer.next(".parquet"))
+
+		logrus.WithFields(logrus.Fields{
+			"partition":  group.Partition,
+			"inputs":     len(group.Inputs),
+			"input_size": group.InputSize,
+			"rows":       group.Rows,
+			"output":     group.Output,
+			"dry_run":    options.DryRun,
+		}).Info("compacting parquet files")
+
+		if options.DryRun {
+			continue
+		}
+
+		err = compactGroup(store, group, namer, options)
+		if err != nil {
+			return groups, fmt.Errorf("failed to compact %s: %w", group.Partition, err)
+		}
+	}
+
+	return groups, nil
+}
+
+func readAllRows(store ObjectStore, key string) ([]interface{}, error) {
+	file, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+
+	return pr.ReadByNumber(int(pr.GetNumRows()))
+}
+
+func sortRowsByEventTime(rows []interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	fieldName := common.StringToVariableName(EventTimeColumn)
+	if _, ok := reflect.TypeOf(rows[0]).FieldByName(fieldName); !ok {
+		return fmt.Errorf("rows have no %s column", EventTimeColumn)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return reflect.ValueOf(rows[i]).FieldByName(fieldName).Int() < reflect.ValueOf(rows[j]).FieldByName(fieldName).Int()
+	})
+	return nil
+}
+
+// eventTimeRange returns the earliest and latest event_time of the rows, or zero times if they have no event_time column
+func eventTimeRange(rows []interface{}) (time.Time, time.Time) {
+	if len(rows) == 0 {
+		return time.Time{}, time.Time{}
+	}
+	fieldName := common.StringToVariableName(EventTimeColumn)
+	if field, ok := reflect.TypeOf(rows[0]).FieldByName(fieldName); !ok || field.Type.Kind() != reflect.Int64 {
+		return time.Time{}, time.Time{}
+	}
+	min := reflect.ValueOf(rows[0]).FieldByName(fieldName).Int()
+	max := min
+	for _, row := range rows[1:] {
+		eventTime := reflect.ValueOf(row).FieldByName(fieldName).Int()
+		if eventTime < min {
+			min = eventTime
+		}
+		if eventTime > max {
+			max = eventTime
+		}
+	}
+	return time.UnixMilli(min).UTC(), time.UnixMilli(max).UTC()
+}
+
+func compactGroup(store ObjectStore, group *CompactionGroup, namer *objectNamer, options CompactionOptions) error {
+	rows := []interface{}{}
+	for _, input := range group.Inputs {
+		inputRows, err := readAllRows(store, input)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, inputRows...)
+	}
+	if int64(len(rows)) != group.Rows {
+		return fmt.Errorf("read %d rows but the footers list %d", len(rows), group.Rows)
+	}
+
+	if options.SortByEventTime {
+		err := sortRowsByEventTime(rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	tempKey := path.Join(group.Partition, "_compacting-"+path.Base(group.Output))
+	checksum, err := writeRows(store, tempKey, group.schema, group.metadata, rows, options.ParquetOptions)
+	if err != nil {
+		store.Delete([]string{tempKey})
+		return err
+	}
+	err = verifyUpload(store, tempKey, checksum)
+	if err != nil {
+		store.Delete([]string{tempKey})
+		return err
+	}
+
+	writtenRows, _, err := ReadParquetFooter(store, tempKey)
+	if err != nil {
+		store.Delete([]string{tempKey})
+		return err
+	}
+	if writtenRows != group.Rows {
+		store.Delete([]string{tempKey})
+		return fmt.Errorf("verification failed, merged file has %d rows but the inputs have %d", writtenRows, group.Rows)
+	}
+
+	err = store.Move(tempKey, group.Output)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	minEventTime, maxEventTime := eventTimeRange(rows)
+	entries := []ManifestEntry{
+		{
+			Key:          group.Output,
+			Format:       OutputFormatParquet,
+			Records:      group.Rows,
+			Size:         checksum.size,
+			SHA256:       checksum.SHA256(),
+			MinEventTime: minEventTime,
+			MaxEventTime: maxEventTime,
+			WrittenAt:    now,
+		},
+	}
+	for _, input := range group.Inputs {
+		entries = append(entries, ManifestEntry{
+			Key:        input,
+			Format:     OutputFormatParquet,
+			WrittenAt:  now,
+			ReplacedBy: group.Output,
+		})
+	}
+	err = appendManifest(store, path.Join(group.Partition, namer.manifestName()), entries...)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to the partition manifest, leaving the inputs in place: %w", group.Output, err)
+	}
+
+	return store.Delete(group.Inputs)
+}
+
+// writeRows writes the rows to a new parquet file, returning the checksums of what was written
+func writeRows(store ObjectStore, key string, schema []*parquet.SchemaElement, metadata []*parquet.KeyValue, rows []interface{}, options ParquetOptions) (*checksumFile, error) {
+	created, err := store.Create(key)
+	if err != nil {
+		return nil, err
+	}
+	file := newChecksumFile(created)
+
+	pw, err := newParquetWriter(file, schema, options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	pw.Footer.KeyValueMetadata = metadata
+	for _, row := range rows {
+		err = pw.Write(row)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	err = pw.WriteStop()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, file.Close()
+}
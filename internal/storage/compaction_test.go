@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEvent is a minimal versioned model for writing parquet files in tests
+type testEvent struct {
+	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Name      string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Port      *int32 `parquet:"name=port, type=INT32, repetitiontype=OPTIONAL"`
+}
+
+func (e testEvent) GetDateHourKey() DateHourKey {
+	eventTime := time.UnixMilli(e.EventTime).UTC()
+	return DateHourKey{Date: eventTime.Format(eventDateLayout), Hour: eventTime.Hour()}
+}
+
+func (e testEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+func (e testEvent) UpdateFields() error {
+	return nil
+}
+
+func (e testEvent) SchemaVersion() int {
+	return 2
+}
+
+// readManifests returns the entries of every manifest in the partition
+func readManifests(t *testing.T, store ObjectStore, partition string) []ManifestEntry {
+	t.Helper()
+	objects, err := store.List(partition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []ManifestEntry{}
+	for _, object := range objects {
+		if !strings.HasPrefix(path.Base(object.Key), manifestPrefix) {
+			continue
+		}
+		data, err := ReadObject(store, object.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			entry := ManifestEntry{}
+			err = json.Unmarshal(scanner.Bytes(), &entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestCompactUpdatesManifests(t *testing.T) {
+	store := NewLocalObjectStore(t.TempDir())
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	namer := newObjectNamer("sensor-a", start)
+	sample := testEvent{EventTime: start.UnixMilli()}
+	writer, err := NewS3FileWriter(store, "flow", namer, sample.GetDateHourKey(), PartitionLayout{}, &testEvent{}, ParquetFormat{Options: DefaultParquetOptions()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		err = writer.Write(testEvent{EventTime: start.Add(time.Duration(i) * time.Minute).UnixMilli(), Name: "event"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 1 && i < 5 {
+			err = writer.RotateFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	partition := "flow/event_date=2024-01-02/event_hour=3"
+	if written := readManifests(t, store, partition); len(written) != 3 {
+		t.Fatalf("the writer's manifest has %d entries, expected 3", len(written))
+	}
+
+	groups, err := Compact(store, "flow", CompactionOptions{
+		TargetSize:     1 << 30,
+		ParquetOptions: DefaultParquetOptions(),
+		SensorName:     "compactor",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Inputs) != 3 {
+		t.Fatalf("planned %d groups, expected 1 of 3 files", len(groups))
+	}
+	output := groups[0].Output
+	if !regexp.MustCompile(`^compactor-\d{8}T\d{6}Z-[0-9a-f]{8}-000001\.parquet$`).MatchString(path.Base(output)) {
+		t.Errorf("merged file is named %s, expected it named by the object namer", output)
+	}
+
+	// every key the manifests list and no manifest marks replaced should exist, and be the merged file
+	entries := readManifests(t, store, partition)
+	replaced := map[string]string{}
+	for _, entry := range entries {
+		if entry.ReplacedBy != "" {
+			replaced[entry.Key] = entry.ReplacedBy
+		}
+	}
+	live := []ManifestEntry{}
+	for _, entry := range entries {
+		if entry.ReplacedBy == "" && replaced[entry.Key] == "" {
+			live = append(live, entry)
+		}
+	}
+	if len(live) != 1 || live[0].Key != output {
+		t.Fatalf("manifests list %v, expected only %s", live, output)
+	}
+	for _, input := range groups[0].Inputs {
+		if replaced[input] != output {
+			t.Errorf("%s isn't marked replaced by %s", input, output)
+		}
+		if _, err := store.Stat(input); !IsNotFound(err) {
+			t.Errorf("%s wasn't deleted", input)
+		}
+	}
+
+	entry := live[0]
+	data, err := ReadObject(store, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if entry.Records != 6 || entry.Size != int64(len(data)) || entry.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("manifest entry %+v doesn't match the merged file", entry)
+	}
+	if !entry.MinEventTime.Equal(start) || !entry.MaxEventTime.Equal(start.Add(5*time.Minute)) {
+		t.Errorf("manifest entry covers %s to %s", entry.MinEventTime, entry.MaxEventTime)
+	}
+
+	info, err := readParquetFileInfo(store, ObjectInfo{Key: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, ok := ParquetSchemaVersion(info.metadata); !ok || version != 2 {
+		t.Errorf("merged file has schema version %d, expected 2", version)
+	}
+}
+
+func TestEventTimeRange(t *testing.T) {
+	type noEventTime struct {
+		Name string
+	}
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		rows []interface{}
+		min  time.Time
+		max  time.Time
+	}{
+		{name: "no rows", rows: []interface{}{}},
+		{name: "no event_time", rows: []interface{}{noEventTime{Name: "a"}}},
+		{
+			name: "unsorted",
+			rows: []interface{}{
+				struct{ Event_time int64 }{base.Add(time.Hour).UnixMilli()},
+				struct{ Event_time int64 }{base.UnixMilli()},
+				struct{ Event_time int64 }{base.Add(time.Minute).UnixMilli()},
+			},
+			min: base,
+			max: base.Add(time.Hour),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			min, max := eventTimeRange(test.rows)
+			if !min.Equal(test.min) || !max.Equal(test.max) {
+				t.Errorf("range is %s to %s, expected %s to %s", min, max, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestAppendManifest(t *testing.T) {
+	store := NewLocalObjectStore(t.TempDir())
+	key := "flow/event_date=2024-01-02/_manifest-a.ndjson"
+	batches := [][]ManifestEntry{
+		{{Key: "a.parquet", Records: 1}},
+		{{Key: "b.parquet", Records: 2}, {Key: "a.parquet", ReplacedBy: "b.parquet"}},
+	}
+	for _, batch := range batches {
+		err := appendManifest(store, key, batch...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := readManifests(t, store, "flow/event_date=2024-01-02")
+	keys := []string{}
+	for _, entry := range entries {
+		keys = append(keys, entry.Key+">"+entry.ReplacedBy)
+	}
+	sort.Strings(keys)
+	if expected := []string{"a.parquet>", "a.parquet>b.parquet", "b.parquet>"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("manifest has %v, expected %v", keys, expected)
+	}
+	data, err := ReadObject(store, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), "replaced_by") != 1 {
+		t.Errorf("replaced_by should only be written for replaced files:\n%s", data)
+	}
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	OutputFormatParquet = "parquet"
+	OutputFormatNDJSON  = "ndjson"
+)
+
+// FileEncoder encodes records into a single file
+type FileEncoder interface {
+	Write(obj interface{}) error
+	// Size returns roughly how many bytes the file will be if closed now
+	Size() int64
+	// Close flushes anything buffered by the encoder, but doesn't close the underlying file
+	Close() error
+}
+
+// OutputFormat creates the encoders for files of one format
+type OutputFormat interface {
+	Name() string
+	Extension() string
+	NewEncoder(file source.ParquetFile, sampleObj interface{}) (FileEncoder, error)
+}
+
+type ParquetFormat struct {
+	Options ParquetOptions
+}
+
+func (f ParquetFormat) Name() string {
+	return OutputFormatParquet
+}
+
+func (f ParquetFormat) Extension() string {
+	return ".parquet"
+}
+
+func (f ParquetFormat) NewEncoder(file source.ParquetFile, sampleObj interface{}) (FileEncoder, error) {
+	counter := &countingParquetFile{
+		ParquetFile: file,
+	}
+	w, err := newParquetWriter(counter, sampleObj, f.Options)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetEncoder{
+		writer:  w,
+		counter: counter,
+	}, nil
+}
+
+type countingParquetFile struct {
+	source.ParquetFile
+	count int64
+}
+
+func (f *countingParquetFile) Write(p []byte) (int, error) {
+	n, err := f.ParquetFile.Write(p)
+	f.count += int64(n)
+	return n, err
+}
+
+type parquetEncoder struct {
+	writer  *writer.ParquetWriter
+	counter *countingParquetFile
+	closed  bool
+}
+
+func (e *parquetEncoder) Write(obj interface{}) error {
+	return e.writer.Write(obj)
+}
+
+// Size returns the bytes already written to the underlying file plus the compressed pages buffered for the current row group, or the exact file size once closed.
+// Records which haven't been encoded into pages yet aren't counted; the parquet writer encodes them once roughly parallelism * page size * columns bytes are buffered.
+func (e *parquetEncoder) Size() int64 {
+	if e.closed {
+		return e.counter.count
+	}
+	return e.writer.Offset + e.writer.Size
+}
+
+func (e *parquetEncoder) Close() error {
+	err := e.writer.WriteStop()
+	if err != nil {
+		return err
+	}
+	e.closed = true
+	return nil
+}
+
+// NDJSONFormat writes one JSON object per line, using the same field names as the EVE input
+type NDJSONFormat struct {
+	Compression string
+}
+
+// ParseNDJSONCompression accepts the compression NDJSON files can be written with
+func ParseNDJSONCompression(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "gzip":
+		return "gzip", nil
+	case "zstd":
+		return "zstd", nil
+	case "none", "":
+		return "none", nil
+	}
+	return "", fmt.Errorf("unsupported ndjson compression %s, expected one of gzip, zstd, none", name)
+}
+
+func (f NDJSONFormat) Name() string {
+	return OutputFormatNDJSON
+}
+
+func (f NDJSONFormat) Extension() string {
+	switch f.Compression {
+	case "gzip":
+		return ".json.gz"
+	case "zstd":
+		return ".json.zst"
+	}
+	return ".json"
+}
+
+func (f NDJSONFormat) NewEncoder(file source.ParquetFile, sampleObj interface{}) (FileEncoder, error) {
+	counter := &countingWriter{
+		writer: file,
+	}
+	e := &ndjsonEncoder{
+		counter: counter,
+	}
+	switch f.Compression {
+	case "gzip":
+		e.compressor = gzip.NewWriter(counter)
+	case "zstd":
+		zstdWriter, err := zstd.NewWriter(counter)
+		if err != nil {
+			return nil, err
+		}
+		e.compressor = zstdWriter
+	case "none", "":
+		e.compressor = nopWriteCloser{counter}
+	default:
+		return nil, fmt.Errorf("unsupported ndjson compression %s", f.Compression)
+	}
+	e.encoder = json.NewEncoder(e.compressor)
+	return e, nil
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type ndjsonEncoder struct {
+	counter    *countingWriter
+	compressor io.WriteCloser
+	encoder    *json.Encoder
+}
+
+func (e *ndjsonEncoder) Write(obj interface{}) error {
+	return e.encoder.Encode(obj)
+}
+
+// Size returns the compressed bytes written so far, which lags behind by whatever the compressor has buffered until it's closed
+func (e *ndjsonEncoder) Size() int64 {
+	return e.counter.count
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return e.compressor.Close()
+}
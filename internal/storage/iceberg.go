@@ -0,0 +1,690 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+const (
+	OutputFormatIceberg = "iceberg"
+
+	icebergFormatVersion  = 2
+	icebergCommitAttempts = 5
+
+	icebergManifestEntrySchema = `{"type":"record","name":"manifest_entry","fields":[` +
+		`{"name":"status","type":"int","field-id":0},` +
+		`{"name":"snapshot_id","type":["null","long"],"default":null,"field-id":1},` +
+		`{"name":"sequence_number","type":["null","long"],"default":null,"field-id":3},` +
+		`{"name":"file_sequence_number","type":["null","long"],"default":null,"field-id":4},` +
+		`{"name":"data_file","type":{"type":"record","name":"r2","fields":[` +
+		`{"name":"content","type":"int","field-id":134},` +
+		`{"name":"file_path","type":"string","field-id":100},` +
+		`{"name":"file_format","type":"string","field-id":101},` +
+		`{"name":"partition","type":{"type":"record","name":"r102","fields":[]},"field-id":102},` +
+		`{"name":"record_count","type":"long","field-id":103},` +
+		`{"name":"file_size_in_bytes","type":"long","field-id":104}]},"field-id":2}]}`
+
+	icebergManifestFileSchema = `{"type":"record","name":"manifest_file","fields":[` +
+		`{"name":"manifest_path","type":"string","field-id":500},` +
+		`{"name":"manifest_length","type":"long","field-id":501},` +
+		`{"name":"partition_spec_id","type":"int","field-id":502},` +
+		`{"name":"content","type":"int","field-id":517},` +
+		`{"name":"sequence_number","type":"long","field-id":515},` +
+		`{"name":"min_sequence_number","type":"long","field-id":516},` +
+		`{"name":"added_snapshot_id","type":"long","field-id":503},` +
+		`{"name":"added_files_count","type":"int","field-id":504},` +
+		`{"name":"existing_files_count","type":"int","field-id":505},` +
+		`{"name":"deleted_files_count","type":"int","field-id":506},` +
+		`{"name":"added_rows_count","type":"long","field-id":512},` +
+		`{"name":"existing_rows_count","type":"long","field-id":513},` +
+		`{"name":"deleted_rows_count","type":"long","field-id":514},` +
+		`{"name":"partitions","type":["null",{"type":"array","items":{"type":"record","name":"r508","fields":[` +
+		`{"name":"contains_null","type":"boolean","field-id":509},` +
+		`{"name":"contains_nan","type":["null","boolean"],"default":null,"field-id":518},` +
+		`{"name":"lower_bound","type":["null","bytes"],"default":null,"field-id":510},` +
+		`{"name":"upper_bound","type":["null","bytes"],"default":null,"field-id":511}]},"element-id":508}],"default":null,"field-id":507},` +
+		`{"name":"key_metadata","type":["null","bytes"],"default":null,"field-id":519}]}`
+)
+
+var (
+	ErrIcebergCommitConflict = errors.New("iceberg table was updated by another writer")
+
+	// names of manifest list fields in format version 1, which are renamed in version 2
+	icebergV1ManifestFileFields = map[string]string{
+		"added_files_count":    "added_data_files_count",
+		"existing_files_count": "existing_data_files_count",
+		"deleted_files_count":  "deleted_data_files_count",
+	}
+)
+
+// WrittenFile describes a completed file
+type WrittenFile struct {
+	Key     string
+	Records int64
+	Size    int64
+}
+
+// FileCommitter is implemented by output formats which need to be told about each completed file
+type FileCommitter interface {
+	Commit(file WrittenFile) error
+}
+
+// IcebergCatalog tracks the current metadata file of a single Iceberg table
+type IcebergCatalog interface {
+	// CurrentMetadataLocation returns the URL and version of the table's current metadata file, or "" if the table has no metadata yet
+	CurrentMetadataLocation() (string, int, error)
+	// MetadataKey returns the key to write a version of the metadata to
+	MetadataKey(version int) string
+	// Commit points the table at the next metadata file, failing with ErrIcebergCommitConflict if it no longer points at previous
+	Commit(previous, next string, version int) error
+}
+
+// IcebergTable is an output format which writes Parquet files with Iceberg field ids under <prefix>/data and commits each completed file to an unpartitioned Iceberg table at prefix.
+// Each commit is an append snapshot adding one manifest, so the table should be maintained with Athena's OPTIMIZE and VACUUM.
+// Files which fail to commit are kept and retried with the next commit, so they're only orphaned if the process exits first.
+// Field ids are matched to the table's current schema by column name, and columns the table doesn't have yet are added to its schema on commit.
+type IcebergTable struct {
+	store    ObjectStore
+	prefix   string
+	catalog  IcebergCatalog
+	options  ParquetOptions
+	lock     sync.Mutex
+	loaded   bool
+	fieldIDs map[string]int
+	lastID   int
+	schema   map[string]interface{}
+	// pending holds files which failed to commit, to be added with the next one
+	pending []WrittenFile
+}
+
+func NewIcebergTable(store ObjectStore, prefix string, catalog IcebergCatalog, options ParquetOptions) *IcebergTable {
+	return &IcebergTable{
+		store:    store,
+		prefix:   prefix,
+		catalog:  catalog,
+		options:  options,
+		fieldIDs: map[string]int{},
+	}
+}
+
+// DataPrefix is the prefix data files should be written under
+func (t *IcebergTable) DataPrefix() string {
+	return path.Join(t.prefix, "data")
+}
+
+func (t *IcebergTable) MetadataPrefix() string {
+	return path.Join(t.prefix, "metadata")
+}
+
+func (t *IcebergTable) Name() string {
+	return OutputFormatIceberg
+}
+
+func (t *IcebergTable) Extension() string {
+	return ".parquet"
+}
+
+func (t *IcebergTable) NewEncoder(file source.ParquetFile, sampleObj interface{}) (FileEncoder, error) {
+	encoder, err := ParquetFormat{Options: t.options}.NewEncoder(file, sampleObj)
+	if err != nil {
+		return nil, err
+	}
+	pw := encoder.(*parquetEncoder).writer
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.loaded {
+		metadata, _, _, err := t.loadMetadata()
+		if err != nil {
+			return nil, err
+		}
+		if metadata != nil {
+			t.useSchema(metadata)
+		}
+		t.loaded = true
+	}
+
+	// the writer keeps Go field names in the footer until it's closed, so take the column names from the schema handler
+	names := make([]string, len(pw.Footer.Schema))
+	for i := range pw.Footer.Schema {
+		names[i] = pw.SchemaHandler.Infos[i].ExName
+	}
+	schema, _ := t.assignFieldIDs(pw.Footer.Schema, names, 0, "")
+	t.schema = schema.(map[string]interface{})
+
+	return encoder, nil
+}
+
+func (t *IcebergTable) fieldID(columnPath string) int {
+	if id, ok := t.fieldIDs[columnPath]; ok {
+		return id
+	}
+	t.lastID++
+	t.fieldIDs[columnPath] = t.lastID
+	return t.lastID
+}
+
+func setFieldID(element *parquet.SchemaElement, id int) {
+	fieldID := int32(id)
+	element.FieldID = &fieldID
+}
+
+// assignFieldIDs sets the field id of every column below the element at index i, returning its Iceberg type and the index of the next sibling
+func (t *IcebergTable) assignFieldIDs(elements []*parquet.SchemaElement, names []string, i int, columnPath string) (interface{}, int) {
+	element := elements[i]
+	if element.GetNumChildren() == 0 {
+		return icebergPrimitiveType(element), i + 1
+	}
+
+	switch element.GetConvertedType() {
+	case parquet.ConvertedType_LIST:
+		// a repeated group containing the element
+		elementIndex := i + 2
+		id := t.fieldID(columnPath + ".element")
+		setFieldID(elements[elementIndex], id)
+		elementType, next := t.assignFieldIDs(elements, names, elementIndex, columnPath+".element")
+		return map[string]interface{}{
+			"type":             "list",
+			"element-id":       id,
+			"element-required": false,
+			"element":          elementType,
+		}, next
+	case parquet.ConvertedType_MAP, parquet.ConvertedType_MAP_KEY_VALUE:
+		// a repeated group containing the key and value
+		keyIndex := i + 2
+		keyID := t.fieldID(columnPath + ".key")
+		setFieldID(elements[keyIndex], keyID)
+		keyType, valueIndex := t.assignFieldIDs(elements, names, keyIndex, columnPath+".key")
+		valueID := t.fieldID(columnPath + ".value")
+		setFieldID(elements[valueIndex], valueID)
+		valueType, next := t.assignFieldIDs(elements, names, valueIndex, columnPath+".value")
+		return map[string]interface{}{
+			"type":           "map",
+			"key-id":         keyID,
+			"key":            keyType,
+			"value-id":       valueID,
+			"value-required": false,
+			"value":          valueType,
+		}, next
+	}
+
+	fields := []interface{}{}
+	next := i + 1
+	for c := int32(0); c < element.GetNumChildren(); c++ {
+		childPath := strings.TrimPrefix(columnPath+"."+names[next], ".")
+		id := t.fieldID(childPath)
+		setFieldID(elements[next], id)
+		var childType interface{}
+		childIndex := next
+		childType, next = t.assignFieldIDs(elements, names, childIndex, childPath)
+		fields = append(fields, map[string]interface{}{
+			"id":       id,
+			"name":     names[childIndex],
+			"required": false,
+			"type":     childType,
+		})
+	}
+	return map[string]interface{}{
+		"type":   "struct",
+		"fields": fields,
+	}, next
+}
+
+func icebergPrimitiveType(element *parquet.SchemaElement) string {
+	switch element.GetType() {
+	case parquet.Type_BOOLEAN:
+		return "boolean"
+	case parquet.Type_INT32:
+		if element.GetConvertedType() == parquet.ConvertedType_DATE {
+			return "date"
+		}
+		return "int"
+	case parquet.Type_INT64:
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS, parquet.ConvertedType_TIMESTAMP_MICROS:
+			return "timestamp"
+		}
+		return "long"
+	case parquet.Type_FLOAT:
+		return "float"
+	case parquet.Type_DOUBLE:
+		return "double"
+	case parquet.Type_BYTE_ARRAY:
+		if element.GetConvertedType() == parquet.ConvertedType_UTF8 {
+			return "string"
+		}
+		return "binary"
+	case parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		return fmt.Sprintf("fixed[%d]", element.GetTypeLength())
+	}
+	return "binary"
+}
+
+// collectFieldIDs records the id of every field below an Iceberg type, keyed by its dotted column path
+func collectFieldIDs(icebergType interface{}, columnPath string, ids map[string]int) {
+	t, ok := icebergType.(map[string]interface{})
+	if !ok {
+		return
+	}
+	switch t["type"] {
+	case "struct":
+		fields, _ := t["fields"].([]interface{})
+		for _, f := range fields {
+			field, _ := f.(map[string]interface{})
+			name, _ := field["name"].(string)
+			childPath := strings.TrimPrefix(columnPath+"."+name, ".")
+			ids[childPath] = int(jsonInt64(field["id"]))
+			collectFieldIDs(field["type"], childPath, ids)
+		}
+	case "list":
+		ids[columnPath+".element"] = int(jsonInt64(t["element-id"]))
+		collectFieldIDs(t["element"], columnPath+".element", ids)
+	case "map":
+		ids[columnPath+".key"] = int(jsonInt64(t["key-id"]))
+		collectFieldIDs(t["key"], columnPath+".key", ids)
+		ids[columnPath+".value"] = int(jsonInt64(t["value-id"]))
+		collectFieldIDs(t["value"], columnPath+".value", ids)
+	}
+}
+
+func jsonInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	}
+	return 0
+}
+
+func currentSchema(metadata map[string]interface{}) map[string]interface{} {
+	schemas, _ := metadata["schemas"].([]interface{})
+	for _, s := range schemas {
+		schema, _ := s.(map[string]interface{})
+		if jsonInt64(schema["schema-id"]) == jsonInt64(metadata["current-schema-id"]) {
+			return schema
+		}
+	}
+	return nil
+}
+
+// useSchema replaces the field ids with those of the table's current schema
+func (t *IcebergTable) useSchema(metadata map[string]interface{}) {
+	t.fieldIDs = map[string]int{}
+	collectFieldIDs(currentSchema(metadata), "", t.fieldIDs)
+	t.lastID = int(jsonInt64(metadata["last-column-id"]))
+}
+
+// loadMetadata returns the table's current metadata, or nil if it doesn't have any yet
+func (t *IcebergTable) loadMetadata() (map[string]interface{}, string, int, error) {
+	location, version, err := t.catalog.CurrentMetadataLocation()
+	if err != nil || location == "" {
+		return nil, location, version, err
+	}
+	data, err := ReadObject(t.store, t.keyFromURL(location))
+	if err != nil {
+		return nil, location, version, fmt.Errorf("failed to read %s: %w", location, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// snapshot ids use the full range of a long
+	decoder.UseNumber()
+	metadata := map[string]interface{}{}
+	err = decoder.Decode(&metadata)
+	return metadata, location, version, err
+}
+
+func (t *IcebergTable) keyFromURL(location string) string {
+	root := strings.TrimSuffix(t.store.URL(""), "/")
+	return strings.TrimPrefix(strings.TrimPrefix(location, root), "/")
+}
+
+func (t *IcebergTable) newMetadata() map[string]interface{} {
+	return map[string]interface{}{
+		"format-version":        icebergFormatVersion,
+		"table-uuid":            uuid.New().String(),
+		"location":              t.store.URL(t.prefix),
+		"last-sequence-number":  0,
+		"last-updated-ms":       time.Now().UnixMilli(),
+		"last-column-id":        0,
+		"current-schema-id":     0,
+		"schemas":               []interface{}{},
+		"default-spec-id":       0,
+		"partition-specs":       []interface{}{map[string]interface{}{"spec-id": 0, "fields": []interface{}{}}},
+		"last-partition-id":     999,
+		"default-sort-order-id": 0,
+		"sort-orders":           []interface{}{map[string]interface{}{"order-id": 0, "fields": []interface{}{}}},
+		"properties": map[string]interface{}{
+			"write.format.default":            "parquet",
+			"write.parquet.compression-codec": strings.ToLower(t.options.CompressionCodec.String()),
+		},
+		"snapshots":    []interface{}{},
+		"snapshot-log": []interface{}{},
+		"metadata-log": []interface{}{},
+		"refs":         map[string]interface{}{},
+	}
+}
+
+// evolveSchema adds the schema files are being written with to the metadata, if it has columns the current schema doesn't
+func (t *IcebergTable) evolveSchema(metadata map[string]interface{}) {
+	current := currentSchema(metadata)
+	currentIDs := map[string]int{}
+	collectFieldIDs(current, "", currentIDs)
+	writtenIDs := map[string]int{}
+	collectFieldIDs(t.schema, "", writtenIDs)
+
+	changed := current == nil
+	for columnPath, id := range writtenIDs {
+		if currentIDs[columnPath] != id {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	schemaID := int64(0)
+	schemas, _ := metadata["schemas"].([]interface{})
+	for _, s := range schemas {
+		schema, _ := s.(map[string]interface{})
+		if id := jsonInt64(schema["schema-id"]); id >= schemaID {
+			schemaID = id + 1
+		}
+	}
+	schema := map[string]interface{}{
+		"type":      "struct",
+		"schema-id": schemaID,
+		"fields":    t.schema["fields"],
+	}
+	metadata["schemas"] = append(schemas, schema)
+	metadata["current-schema-id"] = schemaID
+	if int64(t.lastID) > jsonInt64(metadata["last-column-id"]) {
+		metadata["last-column-id"] = t.lastID
+	}
+}
+
+func newSnapshotID() (int64, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b) & (1<<63 - 1)), nil
+}
+
+// Commit appends the file, along with any which failed to commit before, to the table, retrying if another writer commits first.
+// If every attempt fails the file is kept for the next commit.
+func (t *IcebergTable) Commit(file WrittenFile) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.schema == nil {
+		return errors.New("no schema, files must be written with this table's encoder")
+	}
+
+	files := append(t.pending, file)
+	err := t.commitFiles(files)
+	if err != nil {
+		t.pending = files
+		logrus.WithFields(logrus.Fields{
+			"prefix":  t.prefix,
+			"pending": len(t.pending),
+		}).Warn("keeping files which failed to commit to retry with the next commit")
+		return err
+	}
+	t.pending = nil
+	return nil
+}
+
+func (t *IcebergTable) commitFiles(files []WrittenFile) error {
+	snapshotID, err := newSnapshotID()
+	if err != nil {
+		return err
+	}
+	manifestKey := path.Join(t.MetadataPrefix(), fmt.Sprintf("%s-m0.avro", uuid.New().String()))
+	manifestLength, err := t.writeManifest(manifestKey, snapshotID, files)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = t.commitManifest(manifestKey, manifestLength, snapshotID, files)
+		if err == nil {
+			return nil
+		}
+		if err != ErrIcebergCommitConflict || attempt == icebergCommitAttempts {
+			// the manifest isn't referenced by the table, and is written again with the next commit
+			t.store.Delete([]string{manifestKey})
+			return err
+		}
+		logrus.WithFields(logrus.Fields{
+			"prefix":  t.prefix,
+			"attempt": attempt,
+		}).Warn("retrying iceberg commit after conflict")
+	}
+}
+
+func (t *IcebergTable) writeManifest(key string, snapshotID int64, files []WrittenFile) (int64, error) {
+	schemaJSON, err := json.Marshal(t.schema)
+	if err != nil {
+		return 0, err
+	}
+	entries := make([]interface{}, len(files))
+	for i, file := range files {
+		entries[i] = map[string]interface{}{
+			"status":      int64(1),
+			"snapshot_id": snapshotID,
+			// sequence numbers of added files are inherited from the manifest list
+			"sequence_number":      nil,
+			"file_sequence_number": nil,
+			"data_file": map[string]interface{}{
+				"content":            int64(0),
+				"file_path":          t.store.URL(file.Key),
+				"file_format":        "PARQUET",
+				"partition":          map[string]interface{}{},
+				"record_count":       file.Records,
+				"file_size_in_bytes": file.Size,
+			},
+		}
+	}
+	buf := &bytes.Buffer{}
+	err = writeAvroFile(buf, icebergManifestEntrySchema, map[string]string{
+		"schema":            string(schemaJSON),
+		"schema-id":         "0",
+		"partition-spec":    "[]",
+		"partition-spec-id": "0",
+		"format-version":    strconv.Itoa(icebergFormatVersion),
+		"content":           "data",
+	}, entries)
+	if err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), WriteObject(t.store, key, buf.Bytes())
+}
+
+// readManifestList returns the manifests of a snapshot, converted to the version 2 field names
+func (t *IcebergTable) readManifestList(location string) ([]interface{}, error) {
+	data, err := ReadObject(t.store, t.keyFromURL(location))
+	if err != nil {
+		return nil, err
+	}
+	records, _, err := readAvroFile(data)
+	if err != nil {
+		return nil, err
+	}
+	manifests := []interface{}{}
+	for _, r := range records {
+		record := r.(map[string]interface{})
+		for v2Name, v1Name := range icebergV1ManifestFileFields {
+			if _, ok := record[v2Name]; !ok {
+				record[v2Name] = record[v1Name]
+			}
+		}
+		for _, name := range []string{"content", "sequence_number", "min_sequence_number", "added_files_count", "existing_files_count", "deleted_files_count", "added_rows_count", "existing_rows_count", "deleted_rows_count"} {
+			if record[name] == nil {
+				record[name] = int64(0)
+			}
+		}
+		manifests = append(manifests, record)
+	}
+	return manifests, nil
+}
+
+func (t *IcebergTable) commitManifest(manifestKey string, manifestLength int64, snapshotID int64, files []WrittenFile) error {
+	metadata, previousLocation, version, err := t.loadMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		metadata = t.newMetadata()
+	}
+	t.evolveSchema(metadata)
+
+	records, size := int64(0), int64(0)
+	for _, file := range files {
+		records += file.Records
+		size += file.Size
+	}
+
+	now := time.Now().UnixMilli()
+	sequenceNumber := jsonInt64(metadata["last-sequence-number"]) + 1
+	parentSnapshotID := jsonInt64(metadata["current-snapshot-id"])
+	snapshots, _ := metadata["snapshots"].([]interface{})
+
+	manifests := []interface{}{
+		map[string]interface{}{
+			"manifest_path":        t.store.URL(manifestKey),
+			"manifest_length":      manifestLength,
+			"partition_spec_id":    int64(0),
+			"content":              int64(0),
+			"sequence_number":      sequenceNumber,
+			"min_sequence_number":  sequenceNumber,
+			"added_snapshot_id":    snapshotID,
+			"added_files_count":    int64(len(files)),
+			"existing_files_count": int64(0),
+			"deleted_files_count":  int64(0),
+			"added_rows_count":     records,
+			"existing_rows_count":  int64(0),
+			"deleted_rows_count":   int64(0),
+			"partitions":           []interface{}{},
+			"key_metadata":         nil,
+		},
+	}
+	for _, s := range snapshots {
+		snapshot, _ := s.(map[string]interface{})
+		if jsonInt64(snapshot["snapshot-id"]) != parentSnapshotID {
+			continue
+		}
+		manifestList, _ := snapshot["manifest-list"].(string)
+		previous, err := t.readManifestList(manifestList)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest list %s: %w", manifestList, err)
+		}
+		manifests = append(manifests, previous...)
+	}
+
+	parentHeader := "null"
+	if parentSnapshotID > 0 {
+		parentHeader = strconv.FormatInt(parentSnapshotID, 10)
+	}
+	manifestListKey := path.Join(t.MetadataPrefix(), fmt.Sprintf("snap-%d-1-%s.avro", snapshotID, uuid.New().String()))
+	buf := &bytes.Buffer{}
+	err = writeAvroFile(buf, icebergManifestFileSchema, map[string]string{
+		"snapshot-id":        strconv.FormatInt(snapshotID, 10),
+		"parent-snapshot-id": parentHeader,
+		"sequence-number":    strconv.FormatInt(sequenceNumber, 10),
+		"format-version":     strconv.Itoa(icebergFormatVersion),
+	}, manifests)
+	if err != nil {
+		return err
+	}
+	err = WriteObject(t.store, manifestListKey, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	snapshot := map[string]interface{}{
+		"snapshot-id":     snapshotID,
+		"sequence-number": sequenceNumber,
+		"timestamp-ms":    now,
+		"manifest-list":   t.store.URL(manifestListKey),
+		"schema-id":       metadata["current-schema-id"],
+		"summary": map[string]interface{}{
+			"operation":        "append",
+			"added-data-files": strconv.Itoa(len(files)),
+			"added-records":    strconv.FormatInt(records, 10),
+			"added-files-size": strconv.FormatInt(size, 10),
+		},
+	}
+	if parentSnapshotID > 0 {
+		snapshot["parent-snapshot-id"] = parentSnapshotID
+	}
+	metadata["snapshots"] = append(snapshots, snapshot)
+	snapshotLog, _ := metadata["snapshot-log"].([]interface{})
+	metadata["snapshot-log"] = append(snapshotLog, map[string]interface{}{
+		"timestamp-ms": now,
+		"snapshot-id":  snapshotID,
+	})
+	if previousLocation != "" {
+		metadataLog, _ := metadata["metadata-log"].([]interface{})
+		metadata["metadata-log"] = append(metadataLog, map[string]interface{}{
+			"timestamp-ms":  jsonInt64(metadata["last-updated-ms"]),
+			"metadata-file": previousLocation,
+		})
+	}
+	metadata["current-snapshot-id"] = snapshotID
+	metadata["refs"] = map[string]interface{}{
+		"main": map[string]interface{}{
+			"snapshot-id": snapshotID,
+			"type":        "branch",
+		},
+	}
+	metadata["last-sequence-number"] = sequenceNumber
+	metadata["last-updated-ms"] = now
+
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	metadataKey := t.catalog.MetadataKey(version + 1)
+	err = WriteObject(t.store, metadataKey, metadataJSON)
+	if err != nil {
+		return err
+	}
+
+	err = t.catalog.Commit(previousLocation, t.store.URL(metadataKey), version+1)
+	if err != nil {
+		// neither file is referenced by the table, so they're safe to remove
+		t.store.Delete([]string{manifestListKey, metadataKey})
+		return err
+	}
+
+	t.useSchema(metadata)
+	logrus.WithFields(logrus.Fields{
+		"prefix":      t.prefix,
+		"files":       len(files),
+		"records":     records,
+		"snapshot_id": snapshotID,
+	}).Info("committed file to iceberg table")
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	icebergVersionHintFile = "version-hint.text"
+)
+
+var (
+	icebergMetadataVersionRegex = regexp.MustCompile(`^v?(\d+)[.-]`)
+
+	// the table fields Glue accepts back in UpdateTable
+	glueTableInputFields = []string{"Name", "Description", "Owner", "Retention", "StorageDescriptor", "PartitionKeys", "ViewOriginalText", "ViewExpandedText", "TableType", "Parameters", "TargetTable"}
+)
+
+// FileCatalog keeps the current metadata version in metadata/version-hint.text, the layout used by Iceberg's Hadoop catalog.
+// Commits aren't atomic, so only one eve-processor may write to each table.
+type FileCatalog struct {
+	store          ObjectStore
+	metadataPrefix string
+}
+
+func NewFileCatalog(store ObjectStore, metadataPrefix string) *FileCatalog {
+	return &FileCatalog{
+		store:          store,
+		metadataPrefix: metadataPrefix,
+	}
+}
+
+func (c *FileCatalog) currentVersion() (int, error) {
+	data, err := ReadObject(c.store, path.Join(c.metadataPrefix, icebergVersionHintFile))
+	if IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func (c *FileCatalog) CurrentMetadataLocation() (string, int, error) {
+	version, err := c.currentVersion()
+	if err != nil || version == 0 {
+		return "", 0, err
+	}
+	return c.store.URL(c.MetadataKey(version)), version, nil
+}
+
+func (c *FileCatalog) MetadataKey(version int) string {
+	return path.Join(c.metadataPrefix, fmt.Sprintf("v%d.metadata.json", version))
+}
+
+func (c *FileCatalog) Commit(previous, next string, version int) error {
+	current, err := c.currentVersion()
+	if err != nil {
+		return err
+	}
+	if current != version-1 {
+		return ErrIcebergCommitConflict
+	}
+	return WriteObject(c.store, path.Join(c.metadataPrefix, icebergVersionHintFile), []byte(strconv.Itoa(version)))
+}
+
+// GlueCatalog keeps the current metadata location in the metadata_location parameter of a Glue table, as Athena expects.
+// The table must already exist, e.g. created by the terraform-generator, and commits use the table's version id so concurrent writers don't overwrite each other.
+// Glue is called through its JSON API directly as the SDK's Glue client isn't a dependency.
+type GlueCatalog struct {
+	config         aws.Config
+	httpClient     *http.Client
+	database       string
+	table          string
+	metadataPrefix string
+}
+
+func NewGlueCatalog(config aws.Config, database, table, metadataPrefix string) *GlueCatalog {
+	return &GlueCatalog{
+		config:         config,
+		httpClient:     &http.Client{Timeout: time.Minute},
+		database:       database,
+		table:          table,
+		metadataPrefix: metadataPrefix,
+	}
+}
+
+type glueError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (c *GlueCatalog) call(operation string, input interface{}, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("https://glue.%s.amazonaws.com/", c.config.Region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSGlue."+operation)
+
+	credentials, err := c.config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	payloadHash := sha256.Sum256(body)
+	err = v4.NewSigner().SignHTTP(ctx, credentials, req, hex.EncodeToString(payloadHash[:]), "glue", c.config.Region, time.Now())
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := glueError{}
+		json.Unmarshal(respBody, &e)
+		if strings.HasSuffix(e.Type, "ConcurrentModificationException") {
+			return ErrIcebergCommitConflict
+		}
+		return fmt.Errorf("glue %s failed with %d %s: %s", operation, resp.StatusCode, e.Type, e.Message)
+	}
+	return json.Unmarshal(respBody, output)
+}
+
+func (c *GlueCatalog) getTable() (map[string]interface{}, error) {
+	output := struct {
+		Table map[string]interface{}
+	}{}
+	err := c.call("GetTable", map[string]string{
+		"DatabaseName": c.database,
+		"Name":         c.table,
+	}, &output)
+	return output.Table, err
+}
+
+func glueMetadataLocation(table map[string]interface{}) string {
+	parameters, _ := table["Parameters"].(map[string]interface{})
+	location, _ := parameters["metadata_location"].(string)
+	return location
+}
+
+func (c *GlueCatalog) CurrentMetadataLocation() (string, int, error) {
+	table, err := c.getTable()
+	if err != nil {
+		return "", 0, err
+	}
+	location := glueMetadataLocation(table)
+	version := 0
+	if match := icebergMetadataVersionRegex.FindStringSubmatch(path.Base(location)); match != nil {
+		version, _ = strconv.Atoi(match[1])
+	}
+	return location, version, nil
+}
+
+func (c *GlueCatalog) MetadataKey(version int) string {
+	return path.Join(c.metadataPrefix, fmt.Sprintf("%05d-%s.metadata.json", version, uuid.New().String()))
+}
+
+func (c *GlueCatalog) Commit(previous, next string, version int) error {
+	table, err := c.getTable()
+	if err != nil {
+		return err
+	}
+	if glueMetadataLocation(table) != previous {
+		return ErrIcebergCommitConflict
+	}
+
+	tableInput := map[string]interface{}{}
+	for _, field := range glueTableInputFields {
+		if value, ok := table[field]; ok {
+			tableInput[field] = value
+		}
+	}
+	parameters, _ := table["Parameters"].(map[string]interface{})
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+	parameters["table_type"] = "ICEBERG"
+	parameters["metadata_location"] = next
+	parameters["previous_metadata_location"] = previous
+	tableInput["Parameters"] = parameters
+
+	input := map[string]interface{}{
+		"DatabaseName": c.database,
+		"TableInput":   tableInput,
+	}
+	if versionID, ok := table["VersionId"]; ok {
+		input["VersionId"] = versionID
+	}
+	return c.call("UpdateTable", input, &map[string]interface{}{})
+}
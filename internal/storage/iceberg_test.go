@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// conflictingCatalog fails the first conflicts commits as if another writer had committed first
+type conflictingCatalog struct {
+	*FileCatalog
+	conflicts int
+	commits   int
+}
+
+func (c *conflictingCatalog) Commit(previous, next string, version int) error {
+	c.commits++
+	if c.conflicts > 0 {
+		c.conflicts--
+		return ErrIcebergCommitConflict
+	}
+	return c.FileCatalog.Commit(previous, next, version)
+}
+
+func newTestIcebergTable(t *testing.T) (*LocalObjectStore, *conflictingCatalog, *IcebergTable) {
+	store := NewLocalObjectStore(t.TempDir())
+	catalog := &conflictingCatalog{
+		FileCatalog: NewFileCatalog(store, "flow/metadata"),
+	}
+	return store, catalog, NewIcebergTable(store, "flow", catalog, DefaultParquetOptions())
+}
+
+func writeIcebergTestFile(t *testing.T, store ObjectStore, table *IcebergTable, name string, records int) WrittenFile {
+	t.Helper()
+	key := path.Join(table.DataPrefix(), name)
+	file, err := store.Create(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder, err := table.NewEncoder(file, &testEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < records; i++ {
+		err = encoder.Write(testEvent{EventTime: int64(i), Name: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = encoder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WrittenFile{Key: key, Records: int64(records), Size: encoder.Size()}
+}
+
+// currentDataFiles returns the paths of the data files of the table's current snapshot, with their record counts
+func currentDataFiles(t *testing.T, table *IcebergTable) map[string]int64 {
+	t.Helper()
+	metadata, _, _, err := table.loadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int64{}
+	for _, s := range metadata["snapshots"].([]interface{}) {
+		snapshot := s.(map[string]interface{})
+		if jsonInt64(snapshot["snapshot-id"]) != jsonInt64(metadata["current-snapshot-id"]) {
+			continue
+		}
+		manifests, err := table.readManifestList(snapshot["manifest-list"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range manifests {
+			data, err := ReadObject(table.store, table.keyFromURL(m.(map[string]interface{})["manifest_path"].(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, _, err := readAvroFile(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				dataFile := e.(map[string]interface{})["data_file"].(map[string]interface{})
+				files[dataFile["file_path"].(string)] = dataFile["record_count"].(int64)
+			}
+		}
+	}
+	return files
+}
+
+func TestAvroFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		metadata map[string]string
+		records  []interface{}
+	}{
+		{
+			name:     "manifest entries",
+			schema:   icebergManifestEntrySchema,
+			metadata: map[string]string{"format-version": "2", "content": "data"},
+			records: []interface{}{
+				map[string]interface{}{
+					"status":               int64(1),
+					"snapshot_id":          int64(1234567890123),
+					"sequence_number":      nil,
+					"file_sequence_number": nil,
+					"data_file": map[string]interface{}{
+						"content":            int64(0),
+						"file_path":          "s3://bucket/flow/data/a.parquet",
+						"file_format":        "PARQUET",
+						"partition":          map[string]interface{}{},
+						"record_count":       int64(42),
+						"file_size_in_bytes": int64(4096),
+					},
+				},
+			},
+		},
+		{
+			name:     "manifest list",
+			schema:   icebergManifestFileSchema,
+			metadata: map[string]string{"snapshot-id": "1", "parent-snapshot-id": "null"},
+			records: []interface{}{
+				map[string]interface{}{
+					"manifest_path":        "s3://bucket/flow/metadata/a-m0.avro",
+					"manifest_length":      int64(512),
+					"partition_spec_id":    int64(0),
+					"content":              int64(0),
+					"sequence_number":      int64(3),
+					"min_sequence_number":  int64(3),
+					"added_snapshot_id":    int64(-1),
+					"added_files_count":    int64(2),
+					"existing_files_count": int64(0),
+					"deleted_files_count":  int64(0),
+					"added_rows_count":     int64(84),
+					"existing_rows_count":  int64(0),
+					"deleted_rows_count":   int64(0),
+					"partitions":           []interface{}{},
+					"key_metadata":         nil,
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := writeAvroFile(buf, test.schema, test.metadata, test.records)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records, metadata, err := readAvroFile(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, test.records) {
+				t.Errorf("records are %#v, expected %#v", records, test.records)
+			}
+			for key, value := range test.metadata {
+				if string(metadata[key]) != value {
+					t.Errorf("metadata %s is %q, expected %q", key, metadata[key], value)
+				}
+			}
+			if string(metadata["avro.schema"]) != test.schema {
+				t.Errorf("avro.schema is %s, expected %s", metadata["avro.schema"], test.schema)
+			}
+		})
+	}
+}
+
+func TestIcebergTableCommit(t *testing.T) {
+	store, _, table := newTestIcebergTable(t)
+
+	first := writeIcebergTestFile(t, store, table, "a.parquet", 3)
+	err := table.Commit(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := writeIcebergTestFile(t, store, table, "b.parquet", 5)
+	err = table.Commit(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hint, err := ReadObject(store, "flow/metadata/"+icebergVersionHintFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hint) != "2" {
+		t.Errorf("version hint is %s, expected 2", hint)
+	}
+
+	metadata, location, _, err := table.loadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != store.URL("flow/metadata/v2.metadata.json") {
+		t.Errorf("current metadata is %s", location)
+	}
+	checks := map[string]int64{
+		"format-version":       icebergFormatVersion,
+		"last-sequence-number": 2,
+		"last-column-id":       3,
+	}
+	for key, expected := range checks {
+		if actual := jsonInt64(metadata[key]); actual != expected {
+			t.Errorf("%s is %d, expected %d", key, actual, expected)
+		}
+	}
+	if snapshots := metadata["snapshots"].([]interface{}); len(snapshots) != 2 {
+		t.Fatalf("%d snapshots, expected 2", len(snapshots))
+	}
+	current := metadata["snapshots"].([]interface{})[1].(map[string]interface{})
+	if jsonInt64(current["parent-snapshot-id"]) != jsonInt64(metadata["snapshots"].([]interface{})[0].(map[string]interface{})["snapshot-id"]) {
+		t.Error("the second snapshot's parent isn't the first")
+	}
+	if summary := current["summary"].(map[string]interface{}); summary["operation"] != "append" || summary["added-records"] != "5" {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	if len(metadata["metadata-log"].([]interface{})) != 1 {
+		t.Error("the first metadata file isn't in the metadata log")
+	}
+
+	schema := currentSchema(metadata)
+	names := []string{}
+	for _, f := range schema["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		names = append(names, fmt.Sprintf("%d:%s:%v", jsonInt64(field["id"]), field["name"], field["type"]))
+	}
+	if expected := "1:event_time:timestamp,2:name:string,3:port:int"; strings.Join(names, ",") != expected {
+		t.Errorf("schema fields are %s, expected %s", strings.Join(names, ","), expected)
+	}
+
+	files := currentDataFiles(t, table)
+	expected := map[string]int64{
+		store.URL(first.Key):  3,
+		store.URL(second.Key): 5,
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("data files are %v, expected %v", files, expected)
+	}
+}
+
+func TestIcebergTableCommitConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		conflicts int
+		committed bool
+	}{
+		{name: "no conflict", conflicts: 0, committed: true},
+		{name: "retried", conflicts: icebergCommitAttempts - 1, committed: true},
+		{name: "out of attempts", conflicts: icebergCommitAttempts, committed: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, catalog, table := newTestIcebergTable(t)
+			catalog.conflicts = test.conflicts
+
+			file := writeIcebergTestFile(t, store, table, "a.parquet", 2)
+			err := table.Commit(file)
+			if test.committed != (err == nil) {
+				t.Fatalf("commit returned %v", err)
+			}
+			if catalog.commits != test.conflicts+1 && test.committed {
+				t.Errorf("%d commits to the catalog, expected %d", catalog.commits, test.conflicts+1)
+			}
+			if test.committed {
+				if len(table.pending) != 0 {
+					t.Errorf("%d files pending after a successful commit", len(table.pending))
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(table.pending, []WrittenFile{file}) {
+				t.Fatalf("pending files are %v, expected the failed file", table.pending)
+			}
+			objects, err := store.List("flow/metadata")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objects) != 0 {
+				t.Errorf("failed commits left %d metadata objects", len(objects))
+			}
+
+			// the next commit adds the file which failed along with the new one
+			next := writeIcebergTestFile(t, store, table, "b.parquet", 4)
+			err = table.Commit(next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(table.pending) != 0 {
+				t.Errorf("%d files still pending", len(table.pending))
+			}
+			expected := map[string]int64{
+				store.URL(file.Key): 2,
+				store.URL(next.Key): 4,
+			}
+			if files := currentDataFiles(t, table); !reflect.DeepEqual(files, expected) {
+				t.Errorf("data files are %v, expected %v", files, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go-source/s3v2"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+const (
+	s3DeleteBatchSize = 1000
+)
+
+var (
+	ErrObjectExists = errors.New("object already exists")
+)
+
+// S3API is the set of S3 operations needed to manage objects after they've been written
+type S3API interface {
+	s3v2.S3API
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// ETag is only set when it's the MD5 based ETag S3 computes, which it isn't for SSE-KMS objects or local files
+	ETag string
+}
+
+// ObjectStore abstracts the location parquet files are written to, so maintenance commands work against S3 or a local directory. Keys are slash separated and relative to the root of the store.
+type ObjectStore interface {
+	List(prefix string) ([]ObjectInfo, error)
+	ListDirectories(prefix string) ([]string, error)
+	Stat(key string) (ObjectInfo, error)
+	Open(key string) (source.ParquetFile, error)
+	Create(key string) (source.ParquetFile, error)
+	// Move returns an error wrapping ErrObjectExists rather than overwrite an existing object
+	Move(from, to string) error
+	Delete(keys []string) error
+	URL(key string) string
+}
+
+// OpenObjectStore parses a location of the form s3://bucket/prefix or a local directory path, returning the store and the prefix within it
+func OpenObjectStore(location string, api S3API, options UploadOptions) (ObjectStore, string, error) {
+	if strings.HasPrefix(location, "s3://") {
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, "", err
+		}
+		if parsed.Host == "" {
+			return nil, "", fmt.Errorf("missing bucket in %s", location)
+		}
+		return &S3ObjectStore{
+			api:     api,
+			bucket:  parsed.Host,
+			options: options,
+		}, strings.TrimPrefix(parsed.Path, "/"), nil
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, "", err
+	}
+	if !info.IsDir() {
+		return &LocalObjectStore{
+			root: filepath.Dir(location),
+		}, filepath.Base(location), nil
+	}
+	return &LocalObjectStore{
+		root: location,
+	}, "", nil
+}
+
+// ReadObject reads a whole, small, object such as a metadata file
+func ReadObject(store ObjectStore, key string) ([]byte, error) {
+	file, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func WriteObject(store ObjectStore, key string, data []byte) error {
+	file, err := store.Create(key)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// IsNotFound reports whether err means the object doesn't exist
+func IsNotFound(err error) bool {
+	if os.IsNotExist(err) {
+		return true
+	}
+	var responseError interface{ HTTPStatusCode() int }
+	return errors.As(err, &responseError) && responseError.HTTPStatusCode() == 404
+}
+
+// hiddenKey reports whether Athena ignores the object, which it does for any file name starting with _ or .
+func hiddenKey(key string) bool {
+	name := path.Base(key)
+	return strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+}
+
+type S3ObjectStore struct {
+	api     S3API
+	bucket  string
+	options UploadOptions
+}
+
+func NewS3ObjectStore(api S3API, bucket string, options UploadOptions) *S3ObjectStore {
+	return &S3ObjectStore{
+		api:     api,
+		bucket:  bucket,
+		options: options,
+	}
+}
+
+func (s *S3ObjectStore) List(prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+	for {
+		output, err := s.api.ListObjectsV2(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range output.Contents {
+			info := ObjectInfo{
+				Key:  aws.ToString(object.Key),
+				Size: object.Size,
+			}
+			if object.LastModified != nil {
+				info.LastModified = *object.LastModified
+			}
+			objects = append(objects, info)
+		}
+		if !output.IsTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+	return objects, nil
+}
+
+// ListDirectories returns the common prefixes directly below prefix, each ending in a slash
+func (s *S3ObjectStore) ListDirectories(prefix string) ([]string, error) {
+	directories := []string{}
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}
+	for {
+		output, err := s.api.ListObjectsV2(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+		for _, commonPrefix := range output.CommonPrefixes {
+			directories = append(directories, aws.ToString(commonPrefix.Prefix))
+		}
+		if !output.IsTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+	return directories, nil
+}
+
+func (s *S3ObjectStore) Stat(key string) (ObjectInfo, error) {
+	output, err := s.api.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info := ObjectInfo{
+		Key:  key,
+		Size: output.ContentLength,
+	}
+	if output.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		info.ETag = strings.Trim(aws.ToString(output.ETag), `"`)
+	}
+	if output.LastModified != nil {
+		info.LastModified = *output.LastModified
+	}
+	return info, nil
+}
+
+func (s *S3ObjectStore) Open(key string) (source.ParquetFile, error) {
+	return s3v2.NewS3FileReaderWithClient(context.TODO(), s.api, s.bucket, key)
+}
+
+func (s *S3ObjectStore) Create(key string) (source.ParquetFile, error) {
+	return s3v2.NewS3FileWriterWithClient(context.TODO(), s.api, s.bucket, key, []func(*manager.Uploader){
+		func(u *manager.Uploader) {
+			u.PartSize = uploadPartSize
+			u.ClientOptions = append(u.ClientOptions, func(o *s3.Options) {
+				o.APIOptions = append(o.APIOptions, s.options.addToStack)
+			})
+		},
+	})
+}
+
+// Move copies the object to its new key and then deletes the original, as S3 has no rename
+func (s *S3ObjectStore) Move(from, to string) error {
+	// CopyObject can't be made conditional on the destination, so it's checked first. Keys are unique per writer, so nothing else should be racing to create it.
+	_, err := s.Stat(to)
+	if err == nil {
+		return fmt.Errorf("%s: %w", s.URL(to), ErrObjectExists)
+	}
+	if !IsNotFound(err) {
+		return err
+	}
+
+	// the copy doesn't inherit the original's encryption, so it's set again. Tags are copied from the original.
+	encryption, keyID := s.options.serverSideEncryption()
+	_, err = s.api.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(to),
+		CopySource:           aws.String(url.PathEscape(s.bucket + "/" + from)),
+		ServerSideEncryption: encryption,
+		SSEKMSKeyId:          keyID,
+		BucketKeyEnabled:     s.options.BucketKeyEnabled && keyID != nil,
+	})
+	if err != nil {
+		return err
+	}
+	return s.Delete([]string{from})
+}
+
+func (s *S3ObjectStore) Delete(keys []string) error {
+	for start := 0; start < len(keys); start += s3DeleteBatchSize {
+		end := start + s3DeleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		identifiers := []types.ObjectIdentifier{}
+		for _, key := range keys[start:end] {
+			identifiers = append(identifiers, types.ObjectIdentifier{
+				Key: aws.String(key),
+			})
+		}
+		output, err := s.api.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{
+				Objects: identifiers,
+				Quiet:   true,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if len(output.Errors) > 0 {
+			return fmt.Errorf("failed to delete %s: %s", aws.ToString(output.Errors[0].Key), aws.ToString(output.Errors[0].Message))
+		}
+	}
+	return nil
+}
+
+func (s *S3ObjectStore) URL(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key)
+}
+
+type LocalObjectStore struct {
+	root string
+}
+
+func NewLocalObjectStore(root string) *LocalObjectStore {
+	return &LocalObjectStore{
+		root: root,
+	}
+}
+
+func (l *LocalObjectStore) path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(key))
+}
+
+func (l *LocalObjectStore) List(prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := filepath.Walk(l.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		key, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key = filepath.ToSlash(key)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{
+				Key:          key,
+				Size:         info.Size(),
+				LastModified: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return objects, nil
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, err
+}
+
+// ListDirectories returns the directories directly below prefix, which must name a directory, each ending in a slash
+func (l *LocalObjectStore) ListDirectories(prefix string) ([]string, error) {
+	directories := []string{}
+	entries, err := os.ReadDir(l.path(prefix))
+	if os.IsNotExist(err) {
+		return directories, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			directories = append(directories, path.Join(prefix, entry.Name())+"/")
+		}
+	}
+	return directories, nil
+}
+
+func (l *LocalObjectStore) Stat(key string) (ObjectInfo, error) {
+	info, err := os.Stat(l.path(key))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (l *LocalObjectStore) Open(key string) (source.ParquetFile, error) {
+	return local.NewLocalFileReader(l.path(key))
+}
+
+func (l *LocalObjectStore) Create(key string) (source.ParquetFile, error) {
+	err := os.MkdirAll(filepath.Dir(l.path(key)), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return local.NewLocalFileWriter(l.path(key))
+}
+
+func (l *LocalObjectStore) Move(from, to string) error {
+	err := os.MkdirAll(filepath.Dir(l.path(to)), 0755)
+	if err != nil {
+		return err
+	}
+	// linking fails rather than replace an existing file, unlike renaming
+	err = os.Link(l.path(from), l.path(to))
+	if os.IsExist(err) {
+		return fmt.Errorf("%s: %w", l.URL(to), ErrObjectExists)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(l.path(from))
+}
+
+func (l *LocalObjectStore) Delete(keys []string) error {
+	for _, key := range keys {
+		err := os.Remove(l.path(key))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LocalObjectStore) URL(key string) string {
+	return l.path(key)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	DefaultCompressionCodec = "SNAPPY"
+	DefaultRowGroupSize     = 128 * 1024 * 1024
+	DefaultPageSize         = 8 * 1024
+	DefaultParallelism      = 4
+)
+
+type ParquetOptions struct {
+	CompressionCodec parquet.CompressionCodec
+	RowGroupSize     int64
+	PageSize         int64
+	Parallelism      int64
+}
+
+func DefaultParquetOptions() ParquetOptions {
+	codec, _ := ParseCompressionCodec(DefaultCompressionCodec)
+	return ParquetOptions{
+		CompressionCodec: codec,
+		RowGroupSize:     DefaultRowGroupSize,
+		PageSize:         DefaultPageSize,
+		Parallelism:      DefaultParallelism,
+	}
+}
+
+// ParseCompressionCodec accepts the codecs the parquet writer can produce. "NONE" is accepted as an alias of UNCOMPRESSED.
+func ParseCompressionCodec(name string) (parquet.CompressionCodec, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "SNAPPY":
+		return parquet.CompressionCodec_SNAPPY, nil
+	case "GZIP":
+		return parquet.CompressionCodec_GZIP, nil
+	case "ZSTD":
+		return parquet.CompressionCodec_ZSTD, nil
+	case "LZ4":
+		return parquet.CompressionCodec_LZ4, nil
+	case "NONE", "UNCOMPRESSED":
+		return parquet.CompressionCodec_UNCOMPRESSED, nil
+	}
+	return parquet.CompressionCodec_UNCOMPRESSED, fmt.Errorf("unsupported compression codec %s", name)
+}
+
+func (o ParquetOptions) Validate() error {
+	if o.RowGroupSize <= 0 {
+		return fmt.Errorf("row group size must be positive, got %d", o.RowGroupSize)
+	}
+	if o.PageSize <= 0 {
+		return fmt.Errorf("page size must be positive, got %d", o.PageSize)
+	}
+	if o.Parallelism <= 0 {
+		return fmt.Errorf("parallelism must be positive, got %d", o.Parallelism)
+	}
+	return nil
+}
+
+func newParquetWriter(file source.ParquetFile, sampleObj interface{}, options ParquetOptions) (*writer.ParquetWriter, error) {
+	w, err := writer.NewParquetWriter(file, sampleObj, options.Parallelism)
+	if err != nil {
+		return nil, err
+	}
+	w.CompressionType = options.CompressionCodec
+	w.RowGroupSize = options.RowGroupSize
+	w.PageSize = options.PageSize
+	w.Footer.KeyValueMetadata = SchemaVersionMetadata(sampleObj)
+	return w, nil
+}
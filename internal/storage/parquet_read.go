@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// ParquetRecord is a row of a parquet file read without a model, keyed by the column names as written and keeping the order of the schema
+type ParquetRecord struct {
+	Keys   []string
+	Values map[string]interface{}
+}
+
+func newParquetRecord() *ParquetRecord {
+	return &ParquetRecord{
+		Values: map[string]interface{}{},
+	}
+}
+
+// Set sets the value of a key, adding it after the existing keys if it's new
+func (r *ParquetRecord) Set(key string, value interface{}) {
+	if _, ok := r.Values[key]; !ok {
+		r.Keys = append(r.Keys, key)
+	}
+	r.Values[key] = value
+}
+
+// Prepend sets the value of a key, moving it before the existing keys
+func (r *ParquetRecord) Prepend(key string, value interface{}) {
+	keys := []string{key}
+	for _, existing := range r.Keys {
+		if existing != key {
+			keys = append(keys, existing)
+		}
+	}
+	r.Keys = keys
+	r.Values[key] = value
+}
+
+// Lookup returns the values at a dotted path such as http.hostname, with every element of the lists along the path, e.g. each rrname for dns.answers.rrname
+func (r *ParquetRecord) Lookup(path string) []interface{} {
+	values := []interface{}{r}
+	for _, key := range strings.Split(path, ".") {
+		next := []interface{}{}
+		for _, value := range values {
+			for _, element := range flattenList(value) {
+				record, ok := element.(*ParquetRecord)
+				if !ok {
+					continue
+				}
+				if child, ok := record.Values[key]; ok {
+					next = append(next, child)
+				}
+			}
+		}
+		values = next
+	}
+	flattened := []interface{}{}
+	for _, value := range values {
+		flattened = append(flattened, flattenList(value)...)
+	}
+	return flattened
+}
+
+func flattenList(value interface{}) []interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return []interface{}{value}
+	}
+	return list
+}
+
+func (r *ParquetRecord) MarshalJSON() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('{')
+	for i, key := range r.Keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		valueJSON, err := json.Marshal(r.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(keyJSON)
+		buffer.WriteByte(':')
+		buffer.Write(valueJSON)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// ParquetFileReader reads the footer and rows of a parquet file without knowing its model, such as files written by older versions of a model
+type ParquetFileReader struct {
+	file   source.ParquetFile
+	reader *reader.ParquetReader
+	// names maps the Go field names parquet-go reads columns into back to the column names
+	names map[string]string
+}
+
+// OpenParquetFile opens a parquet file, reading its footer
+func OpenParquetFile(store ObjectStore, key string) (*ParquetFileReader, error) {
+	file, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, info := range pr.SchemaHandler.Infos {
+		names[info.InName] = info.ExName
+	}
+	return &ParquetFileReader{
+		file:   file,
+		reader: pr,
+		names:  names,
+	}, nil
+}
+
+// NumRows returns the number of rows in the file
+func (r *ParquetFileReader) NumRows() int64 {
+	return r.reader.GetNumRows()
+}
+
+// Footer returns the footer of the file, with its row groups and key-value metadata. The paths of its column chunks are named as read, see ColumnPath.
+func (r *ParquetFileReader) Footer() *parquet.FileMetaData {
+	return r.reader.Footer
+}
+
+// Schema returns the schema of the file, with the schema names as written
+func (r *ParquetFileReader) Schema() []*parquet.SchemaElement {
+	return writerSchema(r.reader)
+}
+
+// ColumnPath returns the dotted path of a column chunk as written, e.g. tls.sni, along with the schema element of the column
+func (r *ParquetFileReader) ColumnPath(chunk *parquet.ColumnChunk) (string, *parquet.SchemaElement) {
+	handler := r.reader.SchemaHandler
+	inPath := common.PathToStr(append([]string{handler.GetRootInName()}, chunk.MetaData.PathInSchema...))
+	names := []string{}
+	for _, name := range chunk.MetaData.PathInSchema {
+		names = append(names, r.names[name])
+	}
+	var element *parquet.SchemaElement
+	if index, ok := handler.MapIndex[inPath]; ok {
+		element = handler.SchemaElements[index]
+	}
+	return strings.Join(names, "."), element
+}
+
+// Read returns up to count of the next rows, or none once every row has been read
+func (r *ParquetFileReader) Read(count int) ([]*ParquetRecord, error) {
+	rows, err := r.reader.ReadByNumber(count)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*ParquetRecord, len(rows))
+	for i, row := range rows {
+		record, ok := r.exportValue(reflect.ValueOf(row)).(*ParquetRecord)
+		if !ok {
+			return nil, fmt.Errorf("row %d isn't a struct", i)
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// exportValue converts a value read by parquet-go to JSON values and records. NULLs of OPTIONAL columns are left out of records, as Suricata leaves out absent fields.
+func (r *ParquetFileReader) exportValue(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return r.exportValue(value.Elem())
+	case reflect.Struct:
+		record := newParquetRecord()
+		for i := 0; i < value.NumField(); i++ {
+			fieldValue := r.exportValue(value.Field(i))
+			if fieldValue == nil {
+				continue
+			}
+			record.Set(r.names[value.Type().Field(i).Name], fieldValue)
+		}
+		return record
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, value.Len())
+		for i := range list {
+			list[i] = r.exportValue(value.Index(i))
+		}
+		return list
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		record := newParquetRecord()
+		iterator := value.MapRange()
+		for iterator.Next() {
+			record.Set(fmt.Sprint(iterator.Key().Interface()), r.exportValue(iterator.Value()))
+		}
+		return record
+	}
+	return value.Interface()
+}
+
+// Close stops the reader and closes the file
+func (r *ParquetFileReader) Close() error {
+	r.reader.ReadStop()
+	return r.file.Close()
+}
+
+// ParquetStatisticValue decodes the min or max value of a column chunk's statistics for printing, e.g. timestamps as RFC 3339
+func ParquetStatisticValue(element *parquet.SchemaElement, value []byte) string {
+	if element == nil || element.Type == nil {
+		return fmt.Sprintf("%x", value)
+	}
+	switch *element.Type {
+	case parquet.Type_BOOLEAN:
+		if len(value) < 1 {
+			break
+		}
+		return fmt.Sprint(value[0] != 0)
+	case parquet.Type_INT32:
+		if len(value) < 4 {
+			break
+		}
+		return fmt.Sprint(int32(binary.LittleEndian.Uint32(value)))
+	case parquet.Type_INT64:
+		if len(value) < 8 {
+			break
+		}
+		number := int64(binary.LittleEndian.Uint64(value))
+		switch element.GetConvertedType() {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return time.UnixMilli(number).UTC().Format(time.RFC3339Nano)
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			return time.UnixMicro(number).UTC().Format(time.RFC3339Nano)
+		}
+		return fmt.Sprint(number)
+	case parquet.Type_FLOAT:
+		if len(value) < 4 {
+			break
+		}
+		return fmt.Sprint(math.Float32frombits(binary.LittleEndian.Uint32(value)))
+	case parquet.Type_DOUBLE:
+		if len(value) < 8 {
+			break
+		}
+		return fmt.Sprint(math.Float64frombits(binary.LittleEndian.Uint64(value)))
+	case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+		if element.GetConvertedType() == parquet.ConvertedType_UTF8 || (element.LogicalType != nil && element.LogicalType.IsSetSTRING()) {
+			return fmt.Sprintf("%q", string(value))
+		}
+	}
+	return fmt.Sprintf("%x", value)
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+// ColumnType is a top level column of a parquet file, with its type in the Hive syntax Glue and Athena use, e.g. struct<name:string,tags:array<string>>
+type ColumnType struct {
+	Name string
+	Type string
+}
+
+// ParquetColumnTypes converts the footer schema of a parquet file, as returned by ReadParquetFooter, to the Glue types of its top level columns
+func ParquetColumnTypes(schema []*parquet.SchemaElement) ([]ColumnType, error) {
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("empty schema")
+	}
+	columns := []ColumnType{}
+	index := 1
+	for i := int32(0); i < schema[0].GetNumChildren(); i++ {
+		if index >= len(schema) {
+			return nil, fmt.Errorf("schema ends before all of the columns of the root")
+		}
+		name := schema[index].Name
+		typeString, next, err := parquetElementType(schema, index)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		columns = append(columns, ColumnType{
+			Name: name,
+			Type: typeString,
+		})
+		index = next
+	}
+	return columns, nil
+}
+
+// parquetElementType returns the type of the element at index, along with the index of the element following it and its children
+func parquetElementType(schema []*parquet.SchemaElement, index int) (string, int, error) {
+	element := schema[index]
+	typeString, next, err := parquetElementValueType(schema, index)
+	if err != nil {
+		return "", 0, err
+	}
+	// a repeated field without a LIST annotation is a list of its values
+	if element.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+		typeString = fmt.Sprintf("array<%s>", typeString)
+	}
+	return typeString, next, nil
+}
+
+func parquetElementValueType(schema []*parquet.SchemaElement, index int) (string, int, error) {
+	element := schema[index]
+	if element.Type != nil {
+		return parquetPrimitiveType(element), index + 1, nil
+	}
+
+	children := int(element.GetNumChildren())
+	if element.ConvertedType != nil && (*element.ConvertedType == parquet.ConvertedType_LIST || *element.ConvertedType == parquet.ConvertedType_MAP || *element.ConvertedType == parquet.ConvertedType_MAP_KEY_VALUE) {
+		if children != 1 || index+1 >= len(schema) {
+			return "", 0, fmt.Errorf("%s should have a single repeated child", element.Name)
+		}
+		repeated := schema[index+1]
+		if *element.ConvertedType == parquet.ConvertedType_LIST {
+			// group (LIST) > repeated group > element, or the legacy group (LIST) > repeated element
+			if repeated.Type != nil || repeated.GetNumChildren() != 1 {
+				typeString, next, err := parquetElementValueType(schema, index+1)
+				return fmt.Sprintf("array<%s>", typeString), next, err
+			}
+			typeString, next, err := parquetElementType(schema, index+2)
+			return fmt.Sprintf("array<%s>", typeString), next, err
+		}
+		// group (MAP) > repeated group > key, value
+		if repeated.GetNumChildren() != 2 {
+			return "", 0, fmt.Errorf("%s should have a key and a value", element.Name)
+		}
+		keyType, next, err := parquetElementType(schema, index+2)
+		if err != nil {
+			return "", 0, err
+		}
+		valueType, next, err := parquetElementType(schema, next)
+		return fmt.Sprintf("map<%s,%s>", keyType, valueType), next, err
+	}
+
+	fields := []string{}
+	next := index + 1
+	for i := 0; i < children; i++ {
+		if next >= len(schema) {
+			return "", 0, fmt.Errorf("schema ends before all of the fields of %s", element.Name)
+		}
+		name := schema[next].Name
+		typeString, after, err := parquetElementType(schema, next)
+		if err != nil {
+			return "", 0, err
+		}
+		fields = append(fields, fmt.Sprintf("%s:%s", name, typeString))
+		next = after
+	}
+	return fmt.Sprintf("struct<%s>", strings.Join(fields, ",")), next, nil
+}
+
+// parquetPrimitiveType maps a primitive element to the type Athena reads it as. Unsigned integers are widened to fit their range, and
+// the logical type is used when there's no converted type, as in files written by other tools
+func parquetPrimitiveType(element *parquet.SchemaElement) string {
+	convertedType := parquet.ConvertedType(-1)
+	if element.ConvertedType != nil {
+		convertedType = *element.ConvertedType
+	}
+	logicalType := element.LogicalType
+	if logicalType == nil {
+		logicalType = parquet.NewLogicalType()
+	}
+
+	if convertedType == parquet.ConvertedType_DECIMAL || logicalType.IsSetDECIMAL() {
+		precision, scale := element.GetPrecision(), element.GetScale()
+		if logicalType.IsSetDECIMAL() {
+			precision, scale = logicalType.DECIMAL.Precision, logicalType.DECIMAL.Scale
+		}
+		return fmt.Sprintf("decimal(%d,%d)", precision, scale)
+	}
+
+	switch *element.Type {
+	case parquet.Type_BOOLEAN:
+		return "boolean"
+	case parquet.Type_INT32:
+		switch convertedType {
+		case parquet.ConvertedType_INT_8:
+			return "tinyint"
+		case parquet.ConvertedType_INT_16, parquet.ConvertedType_UINT_8:
+			return "smallint"
+		case parquet.ConvertedType_UINT_16:
+			return "int"
+		case parquet.ConvertedType_UINT_32:
+			return "bigint"
+		case parquet.ConvertedType_DATE:
+			return "date"
+		}
+		if logicalType.IsSetDATE() {
+			return "date"
+		}
+		if logicalType.IsSetINTEGER() {
+			return parquetIntegerType(logicalType.INTEGER)
+		}
+		return "int"
+	case parquet.Type_INT64:
+		switch convertedType {
+		case parquet.ConvertedType_TIMESTAMP_MILLIS, parquet.ConvertedType_TIMESTAMP_MICROS:
+			return "timestamp"
+		case parquet.ConvertedType_UINT_64:
+			return "decimal(20,0)"
+		}
+		if logicalType.IsSetTIMESTAMP() {
+			return "timestamp"
+		}
+		if logicalType.IsSetINTEGER() {
+			return parquetIntegerType(logicalType.INTEGER)
+		}
+		return "bigint"
+	case parquet.Type_INT96:
+		return "timestamp"
+	case parquet.Type_FLOAT:
+		return "float"
+	case parquet.Type_DOUBLE:
+		return "double"
+	case parquet.Type_BYTE_ARRAY:
+		switch convertedType {
+		case parquet.ConvertedType_UTF8, parquet.ConvertedType_ENUM, parquet.ConvertedType_JSON:
+			return "string"
+		}
+		if logicalType.IsSetSTRING() || logicalType.IsSetENUM() || logicalType.IsSetJSON() {
+			return "string"
+		}
+		return "binary"
+	}
+	return "binary"
+}
+
+func parquetIntegerType(integer *parquet.IntType) string {
+	bitWidth := integer.BitWidth
+	// unsigned integers need the next wider signed type
+	if !integer.IsSigned {
+		bitWidth *= 2
+	}
+	switch {
+	case bitWidth <= 8:
+		return "tinyint"
+	case bitWidth <= 16:
+		return "smallint"
+	case bitWidth <= 32:
+		return "int"
+	case bitWidth <= 64:
+		return "bigint"
+	}
+	return "decimal(20,0)"
+}
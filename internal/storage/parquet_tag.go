@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+// ParquetTag is a parsed parquet-go struct tag, e.g. name=src_port, type=INT32. Keys are case insensitive, and those of map keys and of list and map
+// values are prefixed with key and value, e.g. valuetype=BYTE_ARRAY
+type ParquetTag struct {
+	Name           string
+	RepetitionType string
+	// Element is the type of the field itself, which is LIST or MAP for lists and maps, or empty for structs
+	Element ParquetTypeTag
+	Key     ParquetTypeTag
+	Value   ParquetTypeTag
+}
+
+// ParquetTypeTag is the type of a field, map key or value in a parquet tag
+type ParquetTypeTag struct {
+	Type          string
+	ConvertedType string
+	Length        int32
+	Scale         int32
+	Precision     int32
+	// LogicalType holds logicaltype and its logicaltype.<field> keys, e.g. logicaltype=TIMESTAMP, logicaltype.unit=MICROS
+	LogicalType map[string]string
+}
+
+// parquetTagOptions are the keys parquet-go reads which don't affect the type of a column
+var parquetTagOptions = map[string]bool{
+	"fieldid":         true,
+	"encoding":        true,
+	"omitstats":       true,
+	"isadjustedtoutc": true,
+	"repetitiontype":  true,
+}
+
+// ParseParquetTag parses a parquet-go struct tag, returning an error for unknown keys and types rather than panicking like parquet-go
+func ParseParquetTag(tag string) (ParquetTag, error) {
+	parsed := ParquetTag{
+		Element: ParquetTypeTag{LogicalType: map[string]string{}},
+		Key:     ParquetTypeTag{LogicalType: map[string]string{}},
+		Value:   ParquetTypeTag{LogicalType: map[string]string{}},
+	}
+	for _, option := range strings.Split(strings.ReplaceAll(tag, "\t", ""), ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		keyValue := strings.SplitN(option, "=", 2)
+		if len(keyValue) != 2 {
+			return ParquetTag{}, fmt.Errorf("%s should be key=value", option)
+		}
+		key := strings.ToLower(strings.TrimSpace(keyValue[0]))
+		value := strings.TrimSpace(keyValue[1])
+
+		switch key {
+		case "name":
+			parsed.Name = value
+			continue
+		case "inname":
+			continue
+		case "repetitiontype":
+			value = strings.ToUpper(value)
+			if _, err := parquet.FieldRepetitionTypeFromString(value); err != nil {
+				return ParquetTag{}, fmt.Errorf("unknown repetitiontype %s", value)
+			}
+			parsed.RepetitionType = value
+			continue
+		}
+
+		typeTag := &parsed.Element
+		if strings.HasPrefix(key, "key") {
+			typeTag = &parsed.Key
+			key = strings.TrimPrefix(key, "key")
+		} else if strings.HasPrefix(key, "value") {
+			typeTag = &parsed.Value
+			key = strings.TrimPrefix(key, "value")
+		}
+
+		var err error
+		switch {
+		case key == "type":
+			typeTag.Type = strings.ToUpper(value)
+			_, typeErr := parquet.TypeFromString(typeTag.Type)
+			nested := typeTag == &parsed.Element && (typeTag.Type == "LIST" || typeTag.Type == "MAP")
+			if typeErr != nil && !nested {
+				err = fmt.Errorf("unknown type %s", value)
+			}
+		case key == "convertedtype":
+			typeTag.ConvertedType = strings.ToUpper(value)
+			if _, typeErr := parquet.ConvertedTypeFromString(typeTag.ConvertedType); typeErr != nil {
+				err = fmt.Errorf("unknown convertedtype %s", value)
+			}
+		case key == "length":
+			typeTag.Length, err = parseTagInt(value)
+		case key == "scale":
+			typeTag.Scale, err = parseTagInt(value)
+		case key == "precision":
+			typeTag.Precision, err = parseTagInt(value)
+		case key == "logicaltype" || strings.HasPrefix(key, "logicaltype."):
+			typeTag.LogicalType[key] = strings.ToUpper(value)
+		case parquetTagOptions[key]:
+		default:
+			err = fmt.Errorf("unknown key %s", keyValue[0])
+		}
+		if numError, ok := err.(*strconv.NumError); ok {
+			err = fmt.Errorf("%s should be an integer, not %s", keyValue[0], numError.Num)
+		}
+		if err != nil {
+			return ParquetTag{}, err
+		}
+	}
+	if parsed.Name == "" {
+		return ParquetTag{}, fmt.Errorf("name is required")
+	}
+	return parsed, nil
+}
+
+func parseTagInt(value string) (int32, error) {
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	return int32(parsed), err
+}
+
+// IsList returns whether the field is a list, tagged type=LIST, or type=MAP, convertedtype=LIST as older parquet-go versions expect
+func (t ParquetTag) IsList() bool {
+	return t.Element.Type == "LIST" || (t.Element.Type == "MAP" && t.Element.ConvertedType == "LIST")
+}
+
+// IsMap returns whether the field is a map
+func (t ParquetTag) IsMap() bool {
+	return t.Element.Type == "MAP" && !t.IsList()
+}
+
+// IsRepeated returns whether the field is repeated without a LIST annotation, which Athena reads as an array
+func (t ParquetTag) IsRepeated() bool {
+	return t.RepetitionType == "REPEATED"
+}
+
+// SchemaElement returns the parquet schema element of a primitive type, with the logical type parquet-go would write
+func (t ParquetTypeTag) SchemaElement() (*parquet.SchemaElement, error) {
+	if t.Type == "" {
+		return nil, fmt.Errorf("type is required")
+	}
+	physicalType, err := parquet.TypeFromString(t.Type)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a primitive type", t.Type)
+	}
+	element := parquet.NewSchemaElement()
+	element.Type = &physicalType
+	element.TypeLength = &t.Length
+	element.Scale = &t.Scale
+	element.Precision = &t.Precision
+	if t.ConvertedType != "" {
+		convertedType, err := parquet.ConvertedTypeFromString(t.ConvertedType)
+		if err != nil {
+			return nil, err
+		}
+		element.ConvertedType = &convertedType
+	}
+	if logicalType, ok := t.LogicalType["logicaltype"]; ok {
+		element.LogicalType, err = parquetLogicalType(logicalType, t.LogicalType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return element, nil
+}
+
+// GlueType returns the Glue type of a primitive type, e.g. decimal(10,2) for type=FIXED_LEN_BYTE_ARRAY, convertedtype=DECIMAL, precision=10, scale=2
+func (t ParquetTypeTag) GlueType() (string, error) {
+	element, err := t.SchemaElement()
+	if err != nil {
+		return "", err
+	}
+	return parquetPrimitiveType(element), nil
+}
+
+func parquetLogicalType(name string, fields map[string]string) (*parquet.LogicalType, error) {
+	logicalType := parquet.NewLogicalType()
+	switch name {
+	case "STRING":
+		logicalType.STRING = parquet.NewStringType()
+	case "ENUM":
+		logicalType.ENUM = parquet.NewEnumType()
+	case "JSON":
+		logicalType.JSON = parquet.NewJsonType()
+	case "BSON":
+		logicalType.BSON = parquet.NewBsonType()
+	case "UUID":
+		logicalType.UUID = parquet.NewUUIDType()
+	case "DATE":
+		logicalType.DATE = parquet.NewDateType()
+	case "TIME":
+		logicalType.TIME = parquet.NewTimeType()
+	case "TIMESTAMP":
+		logicalType.TIMESTAMP = parquet.NewTimestampType()
+	case "DECIMAL":
+		logicalType.DECIMAL = parquet.NewDecimalType()
+		precision, err := parseTagInt(fields["logicaltype.precision"])
+		if err != nil {
+			return nil, fmt.Errorf("logicaltype.precision is required for DECIMAL")
+		}
+		scale, err := parseTagInt(fields["logicaltype.scale"])
+		if err != nil {
+			return nil, fmt.Errorf("logicaltype.scale is required for DECIMAL")
+		}
+		logicalType.DECIMAL.Precision = precision
+		logicalType.DECIMAL.Scale = scale
+	case "INTEGER":
+		logicalType.INTEGER = parquet.NewIntType()
+		bitWidth, err := parseTagInt(fields["logicaltype.bitwidth"])
+		if err != nil {
+			return nil, fmt.Errorf("logicaltype.bitwidth is required for INTEGER")
+		}
+		logicalType.INTEGER.BitWidth = int8(bitWidth)
+		logicalType.INTEGER.IsSigned = fields["logicaltype.issigned"] != "FALSE"
+	default:
+		return nil, fmt.Errorf("unknown logicaltype %s", name)
+	}
+	return logicalType, nil
+}
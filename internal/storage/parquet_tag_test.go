@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestParseParquetTag(t *testing.T) {
+	tests := []struct {
+		name      string
+		tag       string
+		fieldName string
+		repeated  string
+		list      bool
+		isMap     bool
+		glueType  string
+		err       string
+	}{
+		{name: "string", tag: "name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8", fieldName: "src_ip", glueType: "string"},
+		{name: "case insensitive", tag: "Name=src_port, TYPE=int32, RepetitionType=optional", fieldName: "src_port", repeated: "OPTIONAL", glueType: "int"},
+		{name: "tabs and spaces", tag: "name=flow_id,\ttype=INT64 ,  encoding=PLAIN", fieldName: "flow_id", glueType: "bigint"},
+		{name: "timestamp", tag: "name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS", fieldName: "event_time", glueType: "timestamp"},
+		{name: "logical timestamp", tag: "name=t, type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=MICROS", fieldName: "t", glueType: "timestamp"},
+		{name: "decimal", tag: "name=price, type=FIXED_LEN_BYTE_ARRAY, length=8, convertedtype=DECIMAL, precision=10, scale=2", fieldName: "price", glueType: "decimal(10,2)"},
+		{name: "unsigned", tag: "name=bytes, type=INT64, convertedtype=UINT_64", fieldName: "bytes", glueType: "decimal(20,0)"},
+		{name: "list", tag: "name=query_keys, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8", fieldName: "query_keys", list: true},
+		{name: "legacy list", tag: "name=query_keys, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8", fieldName: "query_keys", list: true},
+		{name: "map", tag: "name=labels, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=INT32", fieldName: "labels", isMap: true},
+		{name: "struct", tag: "name=tcp, repetitiontype=OPTIONAL", fieldName: "tcp", repeated: "OPTIONAL"},
+		{name: "repeated", tag: "name=answers, repetitiontype=REPEATED", fieldName: "answers", repeated: "REPEATED"},
+		{name: "missing name", tag: "type=INT32", err: "name is required"},
+		{name: "missing value", tag: "name=a, type", err: "type should be key=value"},
+		{name: "unknown key", tag: "name=a, type=INT32, colour=red", err: "unknown key colour"},
+		{name: "unknown type", tag: "name=a, type=STRING", err: "unknown type STRING"},
+		{name: "unknown value type", tag: "name=a, type=LIST, valuetype=LIST", err: "unknown type LIST"},
+		{name: "unknown converted type", tag: "name=a, type=INT32, convertedtype=SHORT", err: "unknown convertedtype SHORT"},
+		{name: "unknown repetition type", tag: "name=a, type=INT32, repetitiontype=SOMETIMES", err: "unknown repetitiontype SOMETIMES"},
+		{name: "invalid integer", tag: "name=a, type=FIXED_LEN_BYTE_ARRAY, length=eight", err: "length should be an integer, not eight"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tag, err := ParseParquetTag(test.tag)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error is %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tag.Name != test.fieldName {
+				t.Errorf("name is %s, expected %s", tag.Name, test.fieldName)
+			}
+			if tag.RepetitionType != test.repeated {
+				t.Errorf("repetition type is %s, expected %s", tag.RepetitionType, test.repeated)
+			}
+			if tag.IsList() != test.list || tag.IsMap() != test.isMap {
+				t.Errorf("list is %v and map is %v, expected %v and %v", tag.IsList(), tag.IsMap(), test.list, test.isMap)
+			}
+			if test.glueType == "" {
+				return
+			}
+			glueType, err := tag.Element.GlueType()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if glueType != test.glueType {
+				t.Errorf("glue type is %s, expected %s", glueType, test.glueType)
+			}
+		})
+	}
+}
+
+func TestParquetTypeTagGlueType(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      ParquetTypeTag
+		expected string
+		err      bool
+	}{
+		{name: "boolean", tag: ParquetTypeTag{Type: "BOOLEAN"}, expected: "boolean"},
+		{name: "int8", tag: ParquetTypeTag{Type: "INT32", ConvertedType: "INT_8"}, expected: "tinyint"},
+		{name: "uint16", tag: ParquetTypeTag{Type: "INT32", ConvertedType: "UINT_16"}, expected: "int"},
+		{name: "uint32", tag: ParquetTypeTag{Type: "INT32", ConvertedType: "UINT_32"}, expected: "bigint"},
+		{name: "date", tag: ParquetTypeTag{Type: "INT32", ConvertedType: "DATE"}, expected: "date"},
+		{name: "int96", tag: ParquetTypeTag{Type: "INT96"}, expected: "timestamp"},
+		{name: "double", tag: ParquetTypeTag{Type: "DOUBLE"}, expected: "double"},
+		{name: "no type", tag: ParquetTypeTag{}, err: true},
+		{name: "nested type", tag: ParquetTypeTag{Type: "LIST"}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			glueType, err := test.tag.GlueType()
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %s", glueType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if glueType != test.expected {
+				t.Errorf("glue type is %s, expected %s", glueType, test.expected)
+			}
+		})
+	}
+}
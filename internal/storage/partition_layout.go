@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Optional partition keys. They're named so they don't clash with the in_iface and vlan columns, which Athena doesn't allow.
+const (
+	PartitionEventMinute = "event_minute"
+	PartitionSensor      = "sensor_name"
+	PartitionInIface     = "iface"
+	PartitionVlan        = "vlan_id"
+
+	// EmptyPartitionValue is written in place of an empty string, e.g. for events without an in_iface
+	EmptyPartitionValue = "none"
+)
+
+// PartitionLayout describes the partition directories files are written under. event_date and event_hour always come first, followed by any optional keys in the configured order.
+type PartitionLayout struct {
+	Keys           []string
+	MinuteInterval int
+	SensorName     string
+}
+
+// ParsePartitionLayout parses a comma separated list of optional partition keys
+func ParsePartitionLayout(keys string, minuteInterval int, sensorName string) (PartitionLayout, error) {
+	layout := PartitionLayout{
+		Keys:           []string{},
+		MinuteInterval: minuteInterval,
+		SensorName:     sensorName,
+	}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		switch key {
+		case PartitionEventMinute:
+			if minuteInterval <= 0 || minuteInterval > 60 || 60%minuteInterval != 0 {
+				return layout, fmt.Errorf("minute interval must divide 60 but got %d", minuteInterval)
+			}
+		case PartitionSensor, PartitionInIface, PartitionVlan:
+		default:
+			return layout, fmt.Errorf("unknown partition key %s, expected one of %s, %s, %s, %s", key, PartitionEventMinute, PartitionSensor, PartitionInIface, PartitionVlan)
+		}
+		if layout.HasKey(key) {
+			return layout, fmt.Errorf("partition key %s is listed twice", key)
+		}
+		layout.Keys = append(layout.Keys, key)
+	}
+	return layout, nil
+}
+
+func (l PartitionLayout) HasKey(key string) bool {
+	for _, k := range l.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Key drops the fields of an event's key which aren't part of the layout, so events in the same partition share a writer
+func (l PartitionLayout) Key(key DateHourKey) DateHourKey {
+	partitionKey := DateHourKey{
+		Date: key.Date,
+		Hour: key.Hour,
+	}
+	for _, k := range l.Keys {
+		switch k {
+		case PartitionEventMinute:
+			partitionKey.Minute = key.Minute - key.Minute%l.MinuteInterval
+		case PartitionSensor:
+			partitionKey.Sensor = l.SensorName
+		case PartitionInIface:
+			partitionKey.InIface = key.InIface
+		case PartitionVlan:
+			partitionKey.Vlan = key.Vlan
+		}
+	}
+	return partitionKey
+}
+
+func partitionValue(value string) string {
+	if value == "" {
+		return EmptyPartitionValue
+	}
+	return url.PathEscape(value)
+}
+
+// Path returns the partition directories for a key, e.g. event_date=2021-08-01/event_hour=13/sensor_name=sensor-1
+func (l PartitionLayout) Path(key DateHourKey) string {
+	parts := []string{
+		fmt.Sprintf("event_date=%s", key.Date),
+		fmt.Sprintf("event_hour=%v", key.Hour),
+	}
+	for _, k := range l.Keys {
+		value := ""
+		switch k {
+		case PartitionEventMinute:
+			value = strconv.Itoa(key.Minute)
+		case PartitionSensor:
+			value = partitionValue(key.Sensor)
+		case PartitionInIface:
+			value = partitionValue(key.InIface)
+		case PartitionVlan:
+			value = strconv.Itoa(key.Vlan)
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", k, value))
+	}
+	return strings.Join(parts, "/")
+}
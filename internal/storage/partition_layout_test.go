@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePartitionLayout(t *testing.T) {
+	tests := []struct {
+		name           string
+		keys           string
+		minuteInterval int
+		expected       []string
+		err            bool
+	}{
+		{name: "empty", keys: "", expected: []string{}},
+		{name: "trimmed", keys: " sensor_name , iface,", expected: []string{PartitionSensor, PartitionInIface}},
+		{name: "order kept", keys: "vlan_id,event_minute,sensor_name", minuteInterval: 15, expected: []string{PartitionVlan, PartitionEventMinute, PartitionSensor}},
+		{name: "unknown key", keys: "sensor_name,in_iface", err: true},
+		{name: "duplicate key", keys: "iface,iface", err: true},
+		{name: "minute interval not dividing 60", keys: "event_minute", minuteInterval: 7, err: true},
+		{name: "minute interval of 0", keys: "event_minute", minuteInterval: 0, err: true},
+		{name: "minute interval over an hour", keys: "event_minute", minuteInterval: 120, err: true},
+		{name: "minute interval unused", keys: "sensor_name", minuteInterval: 7, expected: []string{PartitionSensor}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout, err := ParsePartitionLayout(test.keys, test.minuteInterval, "sensor-1")
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got keys %v", layout.Keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(layout.Keys, test.expected) {
+				t.Errorf("keys are %v, expected %v", layout.Keys, test.expected)
+			}
+		})
+	}
+}
+
+func TestPartitionLayoutPath(t *testing.T) {
+	event := DateHourKey{
+		Date:    "2021-08-01",
+		Hour:    13,
+		Minute:  47,
+		Sensor:  "ignored",
+		InIface: "eth0",
+		Vlan:    100,
+	}
+	tests := []struct {
+		name     string
+		keys     string
+		key      DateHourKey
+		expected string
+	}{
+		{name: "date and hour only", keys: "", key: event, expected: "event_date=2021-08-01/event_hour=13"},
+		{name: "minute rounded down", keys: "event_minute", key: event, expected: "event_date=2021-08-01/event_hour=13/event_minute=45"},
+		{name: "sensor from the layout", keys: "sensor_name", key: event, expected: "event_date=2021-08-01/event_hour=13/sensor_name=sensor%201"},
+		{name: "configured order", keys: "vlan_id,iface", key: event, expected: "event_date=2021-08-01/event_hour=13/vlan_id=100/iface=eth0"},
+		{name: "empty interface", keys: "iface", key: DateHourKey{Date: "2021-08-01", Hour: 0}, expected: "event_date=2021-08-01/event_hour=0/iface=none"},
+		{name: "escaped interface", keys: "iface", key: DateHourKey{Date: "2021-08-01", Hour: 1, InIface: "a/b"}, expected: "event_date=2021-08-01/event_hour=1/iface=a%2Fb"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout, err := ParsePartitionLayout(test.keys, 15, "sensor 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path := layout.Path(layout.Key(test.key)); path != test.expected {
+				t.Errorf("path is %s, expected %s", path, test.expected)
+			}
+		})
+	}
+}
+
+func TestPartitionLayoutKey(t *testing.T) {
+	layout, err := ParsePartitionLayout("iface", 0, "sensor-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// events differing only in fields outside the layout share a partition, and so a writer
+	a := layout.Key(DateHourKey{Date: "2021-08-01", Hour: 13, Minute: 1, InIface: "eth0", Vlan: 1})
+	b := layout.Key(DateHourKey{Date: "2021-08-01", Hour: 13, Minute: 59, InIface: "eth0", Vlan: 2})
+	if a != b {
+		t.Errorf("keys %+v and %+v differ", a, b)
+	}
+}
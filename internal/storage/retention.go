@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EventDatePartition = "event_date"
+	eventDateLayout    = "2006-01-02"
+)
+
+type RetentionOptions struct {
+	RetentionDays int
+	Now           time.Time
+	DryRun        bool
+	// AuditLog, if set, receives a JSON line for every expired partition
+	AuditLog io.Writer
+}
+
+// ExpiredPartition is a single event_date partition older than the retention period
+type ExpiredPartition struct {
+	Time      time.Time `json:"time"`
+	Location  string    `json:"location"`
+	EventDate string    `json:"event_date"`
+	Objects   int       `json:"objects"`
+	Bytes     int64     `json:"bytes"`
+	DryRun    bool      `json:"dry_run"`
+}
+
+// RetentionCutoff returns the oldest event_date kept when partitions are retained for the given number of days
+func RetentionCutoff(now time.Time, retentionDays int) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return today.AddDate(0, 0, -retentionDays)
+}
+
+// ParseEventDatePartition returns the date of a directory named event_date=YYYY-MM-DD
+func ParseEventDatePartition(directory string) (time.Time, bool) {
+	name := path.Base(strings.TrimSuffix(directory, "/"))
+	if !strings.HasPrefix(name, EventDatePartition+"=") {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(eventDateLayout, strings.TrimPrefix(name, EventDatePartition+"="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// EnforceRetention deletes every event_date partition directly under prefix which is older than the retention period. A retention of 0 days keeps everything.
+func EnforceRetention(store ObjectStore, prefix string, options RetentionOptions) ([]ExpiredPartition, error) {
+	expired := []ExpiredPartition{}
+	if options.RetentionDays <= 0 {
+		return expired, nil
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	cutoff := RetentionCutoff(options.Now, options.RetentionDays)
+
+	directories, err := store.ListDirectories(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, directory := range directories {
+		date, ok := ParseEventDatePartition(directory)
+		if !ok || !date.Before(cutoff) {
+			continue
+		}
+
+		objects, err := store.List(directory)
+		if err != nil {
+			return expired, err
+		}
+		partition := ExpiredPartition{
+			Time:      time.Now().UTC(),
+			Location:  store.URL(directory),
+			EventDate: date.Format(eventDateLayout),
+			Objects:   len(objects),
+			DryRun:    options.DryRun,
+		}
+		keys := make([]string, len(objects))
+		for i, object := range objects {
+			keys[i] = object.Key
+			partition.Bytes += object.Size
+		}
+
+		if !options.DryRun {
+			err = store.Delete(keys)
+			if err != nil {
+				return expired, fmt.Errorf("failed to delete %s: %w", partition.Location, err)
+			}
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"location":   partition.Location,
+			"event_date": partition.EventDate,
+			"objects":    partition.Objects,
+			"bytes":      partition.Bytes,
+			"dry_run":    partition.DryRun,
+		}).Info("expired partition")
+
+		if options.AuditLog != nil {
+			err = json.NewEncoder(options.AuditLog).Encode(partition)
+			if err != nil {
+				return expired, fmt.Errorf("failed to write audit log, %w", err)
+			}
+		}
+		expired = append(expired, partition)
+	}
+
+	return expired, nil
+}
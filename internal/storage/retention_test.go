@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeRetentionTestObjects writes an object of 10 bytes at each key
+func writeRetentionTestObjects(t *testing.T, store ObjectStore, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		file, err := store.Create(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.Write([]byte("0123456789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+}
+
+func listKeys(t *testing.T, store ObjectStore, prefix string) []string {
+	t.Helper()
+	objects, err := store.List(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
+
+func TestEnforceRetention(t *testing.T) {
+	// a retention of 7 days on 2024-01-10 keeps 2024-01-03 onwards
+	now := time.Date(2024, 1, 10, 15, 30, 0, 0, time.UTC)
+	objects := []string{
+		"flow/event_date=2024-01-01/event_hour=0/a.parquet",
+		"flow/event_date=2024-01-01/event_hour=1/b.parquet",
+		"flow/event_date=2024-01-02/event_hour=23/c.parquet",
+		"flow/event_date=2024-01-03/event_hour=0/d.parquet",
+		"flow/event_date=2024-01-10/event_hour=15/e.parquet",
+		"flow/not_a_partition/f.parquet",
+		"ndjson/flow/event_date=2024-01-02/event_hour=0/g.ndjson",
+		"ndjson/flow/event_date=2024-01-03/event_hour=0/h.ndjson",
+	}
+	tests := []struct {
+		name          string
+		prefix        string
+		retentionDays int
+		dryRun        bool
+		expired       []string
+		remaining     []string
+	}{
+		{
+			name:          "expired partitions deleted",
+			prefix:        "flow",
+			retentionDays: 7,
+			expired:       []string{"2024-01-01", "2024-01-02"},
+			remaining: []string{
+				"flow/event_date=2024-01-03/event_hour=0/d.parquet",
+				"flow/event_date=2024-01-10/event_hour=15/e.parquet",
+				"flow/not_a_partition/f.parquet",
+			},
+		},
+		{
+			name:          "partition at the cutoff kept",
+			prefix:        "flow/",
+			retentionDays: 8,
+			expired:       []string{"2024-01-01"},
+			remaining: []string{
+				"flow/event_date=2024-01-02/event_hour=23/c.parquet",
+				"flow/event_date=2024-01-03/event_hour=0/d.parquet",
+				"flow/event_date=2024-01-10/event_hour=15/e.parquet",
+				"flow/not_a_partition/f.parquet",
+			},
+		},
+		{
+			name:          "dry run",
+			prefix:        "flow",
+			retentionDays: 7,
+			dryRun:        true,
+			expired:       []string{"2024-01-01", "2024-01-02"},
+			remaining:     objects[:6],
+		},
+		{
+			name:          "retention disabled",
+			prefix:        "flow",
+			retentionDays: 0,
+			expired:       []string{},
+			remaining:     objects[:6],
+		},
+		{
+			name:          "ndjson files",
+			prefix:        "ndjson/flow",
+			retentionDays: 7,
+			expired:       []string{"2024-01-02"},
+			remaining:     []string{"ndjson/flow/event_date=2024-01-03/event_hour=0/h.ndjson"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewLocalObjectStore(t.TempDir())
+			writeRetentionTestObjects(t, store, objects...)
+			auditLog := &bytes.Buffer{}
+
+			expired, err := EnforceRetention(store, test.prefix, RetentionOptions{
+				RetentionDays: test.retentionDays,
+				Now:           now,
+				DryRun:        test.dryRun,
+				AuditLog:      auditLog,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			dates := []string{}
+			for _, partition := range expired {
+				dates = append(dates, partition.EventDate)
+				if partition.DryRun != test.dryRun {
+					t.Errorf("%s is logged with dry run %v", partition.EventDate, partition.DryRun)
+				}
+			}
+			sort.Strings(dates)
+			if !reflect.DeepEqual(dates, test.expired) {
+				t.Errorf("expired %v, expected %v", dates, test.expired)
+			}
+
+			// the events of other prefixes are untouched
+			remaining := listKeys(t, store, test.prefix)
+			if !reflect.DeepEqual(remaining, test.remaining) {
+				t.Errorf("%v remain, expected %v", remaining, test.remaining)
+			}
+
+			// the audit log has a line for every expired partition
+			lines := []ExpiredPartition{}
+			decoder := json.NewDecoder(auditLog)
+			for decoder.More() {
+				partition := ExpiredPartition{}
+				err = decoder.Decode(&partition)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, partition)
+			}
+			if !reflect.DeepEqual(lines, expired) {
+				t.Errorf("audit log is %+v, expected %+v", lines, expired)
+			}
+		})
+	}
+}
+
+func TestEnforceRetentionPartitionSize(t *testing.T) {
+	store := NewLocalObjectStore(t.TempDir())
+	writeRetentionTestObjects(t, store,
+		"flow/event_date=2024-01-01/event_hour=0/a.parquet",
+		"flow/event_date=2024-01-01/event_hour=0/_manifest-a.ndjson",
+		"flow/event_date=2024-01-01/event_hour=1/b.parquet",
+	)
+	expired, err := EnforceRetention(store, "flow", RetentionOptions{
+		RetentionDays: 1,
+		Now:           time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+		DryRun:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 {
+		t.Fatalf("expired %d partitions, expected 1", len(expired))
+	}
+	partition := expired[0]
+	if partition.Objects != 3 || partition.Bytes != 30 {
+		t.Errorf("partition has %d objects of %d bytes, expected 3 of 30", partition.Objects, partition.Bytes)
+	}
+	if expected := store.URL("flow/event_date=2024-01-01/"); partition.Location != expected {
+		t.Errorf("partition location is %s, expected %s", partition.Location, expected)
+	}
+}
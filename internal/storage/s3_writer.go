@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DateHourKey identifies the partition an event belongs to. Fields which aren't part of the PartitionLayout are ignored.
+type DateHourKey struct {
+	Date    string
+	Hour    int
+	Minute  int
+	Sensor  string
+	InIface string
+	Vlan    int
+}
+
+type Rotatable interface {
+	GetDateHourKey() DateHourKey
+	// GetEventTime returns the event time in milliseconds since the epoch, once UpdateFields has been called
+	GetEventTime() int64
+	UpdateFields() error
+}
+
+// S3FileWriter writes records to a single object at a time, in the given output format.
+// Files are uploaded under a hidden temporary key, verified, and only then moved to their final key and added to the partition's manifest, so a crash mid-upload never leaves a truncated file visible.
+type S3FileWriter struct {
+	store           ObjectStore
+	prefix          string
+	namer           *objectNamer
+	encoder         FileEncoder
+	file            *checksumFile
+	filename        string
+	tempKey         string
+	lock            sync.Mutex
+	timeOpened      time.Time
+	timeOfLastWrite time.Time
+	records         int64
+	minEventTime    int64
+	maxEventTime    int64
+	sampleObj       interface{}
+	key             DateHourKey
+	layout          PartitionLayout
+	format          OutputFormat
+}
+
+func NewS3FileWriter(store ObjectStore, prefix string, namer *objectNamer, key DateHourKey, layout PartitionLayout, sampleObj interface{}, format OutputFormat) (*S3FileWriter, error) {
+	w := &S3FileWriter{
+		store:     store,
+		prefix:    prefix,
+		namer:     namer,
+		sampleObj: sampleObj,
+		key:       key,
+		layout:    layout,
+		format:    format,
+	}
+	err := w.open()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *S3FileWriter) partitionPrefix() string {
+	return path.Join(w.prefix, w.layout.Path(w.key))
+}
+
+// open starts uploading a new file
+func (w *S3FileWriter) open() error {
+	filename := path.Join(w.partitionPrefix(), w.namer.next(w.format.Extension()))
+	tempKey := path.Join(w.partitionPrefix(), uploadingPrefix+path.Base(filename))
+	file, err := w.store.Create(tempKey)
+	if err != nil {
+		return err
+	}
+	checksum := newChecksumFile(file)
+
+	encoder, err := w.format.NewEncoder(checksum, w.sampleObj)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = checksum
+	w.filename = filename
+	w.tempKey = tempKey
+	w.encoder = encoder
+	w.timeOpened = time.Now()
+	w.timeOfLastWrite = time.Now()
+	w.records = 0
+	w.minEventTime = 0
+	w.maxEventTime = 0
+	return nil
+}
+
+func (w *S3FileWriter) Write(obj Rotatable) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	err := w.encoder.Write(obj)
+	if err != nil {
+		return err
+	}
+
+	eventTime := obj.GetEventTime()
+	if w.records == 0 || eventTime < w.minEventTime {
+		w.minEventTime = eventTime
+	}
+	if w.records == 0 || eventTime > w.maxEventTime {
+		w.maxEventTime = eventTime
+	}
+	w.timeOfLastWrite = time.Now()
+	w.records++
+
+	return nil
+}
+
+func (w *S3FileWriter) Size() int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.encoder.Size()
+}
+
+func (w *S3FileWriter) Records() int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.records
+}
+
+func (w *S3FileWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.close()
+}
+
+// close function without lock to avoid deadlock. The file is closed even when it fails to make it into place, so the writer can't be written to again either way.
+func (w *S3FileWriter) close() error {
+	err := w.encoder.Close()
+	if err != nil {
+		w.file.Close()
+		w.store.Delete([]string{w.tempKey})
+		return err
+	}
+	err = w.file.Close()
+	if err != nil {
+		w.store.Delete([]string{w.tempKey})
+		return err
+	}
+
+	if w.records == 0 {
+		return w.store.Delete([]string{w.tempKey})
+	}
+
+	err = verifyUpload(w.store, w.tempKey, w.file)
+	if err != nil {
+		w.store.Delete([]string{w.tempKey})
+		return err
+	}
+	err = w.store.Move(w.tempKey, w.filename)
+	if err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", w.tempKey, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"filename":  w.filename,
+		"partition": w.layout.Path(w.key),
+		"format":    w.format.Name(),
+		"records":   w.records,
+		"size":      w.file.size,
+	}).Info("closed S3 file")
+
+	// the file is in place whether or not it commits, and the committer keeps a file which fails to retry with its next commit, so the failure isn't the writer's
+	committer, ok := w.format.(FileCommitter)
+	if ok {
+		err = committer.Commit(WrittenFile{
+			Key:     w.filename,
+			Records: w.records,
+			Size:    w.file.size,
+		})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"filename": w.filename,
+				"error":    err,
+			}).Error("failed to commit S3 file")
+		}
+	}
+
+	err = appendManifest(w.store, path.Join(w.partitionPrefix(), w.namer.manifestName()), ManifestEntry{
+		Key:          w.filename,
+		Format:       w.format.Name(),
+		Records:      w.records,
+		Size:         w.file.size,
+		SHA256:       w.file.SHA256(),
+		MinEventTime: time.UnixMilli(w.minEventTime).UTC(),
+		MaxEventTime: time.UnixMilli(w.maxEventTime).UTC(),
+		WrittenAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %s to the partition manifest: %w", w.filename, err)
+	}
+
+	return nil
+}
+
+func (w *S3FileWriter) RotateFile() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	err := w.close()
+	if err != nil {
+		return err
+	}
+
+	err = w.open()
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"new_filename": w.filename,
+		"prefix":       w.prefix,
+		"partition":    w.layout.Path(w.key),
+		"format":       w.format.Name(),
+	}).Info("rotated S3 file")
+
+	return nil
+}
+
+type RotatingWriter struct {
+	openWriters        map[DateHourKey]*S3FileWriter
+	lock               sync.Mutex
+	store              ObjectStore
+	namer              *objectNamer
+	prefix             string
+	fileTimeoutMinutes int
+	fileMaxAgeMinutes  int
+	fileTargetSize     int64
+	fileMinRecords     int64
+	format             OutputFormat
+	partitionLayout    PartitionLayout
+}
+
+func NewRotatingWriter(store ObjectStore, prefix string, fileTimeoutMinutes, fileMaxAgeMinutes int, fileTargetSize, fileMinRecords int64, format OutputFormat, partitionLayout PartitionLayout) *RotatingWriter {
+	writer := &RotatingWriter{
+		openWriters:        make(map[DateHourKey]*S3FileWriter),
+		store:              store,
+		namer:              newObjectNamer(partitionLayout.SensorName, time.Now()),
+		prefix:             prefix,
+		fileTimeoutMinutes: fileTimeoutMinutes,
+		fileMaxAgeMinutes:  fileMaxAgeMinutes,
+		fileTargetSize:     fileTargetSize,
+		fileMinRecords:     fileMinRecords,
+		format:             format,
+		partitionLayout:    partitionLayout,
+	}
+
+	// schedule cleaning of file writers
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for range ticker.C {
+			err := writer.CleanFiles()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error":  err,
+					"prefix": writer.prefix,
+				}).Error("error cleaning S3 files")
+			}
+		}
+	}()
+
+	return writer
+}
+
+func (r *RotatingWriter) Write(obj Rotatable) error {
+	if obj == nil {
+		return fmt.Errorf("obj is nil")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := r.partitionLayout.Key(obj.GetDateHourKey())
+	if writer, ok := r.openWriters[key]; ok && writer.Size() >= r.fileTargetSize && writer.Records() >= r.fileMinRecords {
+		size, records := writer.Size(), writer.Records()
+		err := writer.RotateFile()
+		if err != nil {
+			// the writer's file is closed whatever failed, so a new writer takes over the partition rather than failing every later event
+			delete(r.openWriters, key)
+			logrus.WithFields(logrus.Fields{
+				"prefix": r.prefix,
+				"key":    key,
+				"error":  err,
+			}).Error("failed to rotate S3 file")
+		} else {
+			logrus.WithFields(logrus.Fields{
+				"prefix":  r.prefix,
+				"key":     key,
+				"size":    size,
+				"records": records,
+			}).Info("rotated S3 file due to target filesize reached")
+		}
+	}
+
+	if _, ok := r.openWriters[key]; !ok {
+		writer, err := NewS3FileWriter(r.store, r.prefix, r.namer, key, r.partitionLayout, obj, r.format)
+		if err != nil {
+			return err
+		}
+		r.openWriters[key] = writer
+	}
+
+	return r.openWriters[key].Write(obj)
+}
+
+// CleanFiles closes the writers which have been idle or open for too long. Every due writer is closed and removed, even once one fails, and the errors are returned together.
+func (r *RotatingWriter) CleanFiles() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	errs := []error{}
+	for key, writer := range r.openWriters {
+		reason := ""
+		if time.Since(writer.timeOfLastWrite) > time.Minute*time.Duration(r.fileTimeoutMinutes) {
+			reason = "time-of-last-write"
+		} else if time.Since(writer.timeOpened) > time.Minute*time.Duration(r.fileMaxAgeMinutes) {
+			reason = "time-since-opened"
+		} else {
+			continue
+		}
+		err := writer.Close()
+		delete(r.openWriters, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", writer.filename, err))
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"prefix": writer.prefix,
+			"key":    key,
+		}).Info("closed S3 file due to " + reason)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes every open writer, returning the errors of those which failed together
+func (r *RotatingWriter) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	errs := []error{}
+	for key, writer := range r.openWriters {
+		err := writer.Close()
+		delete(r.openWriters, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", writer.filename, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingMoveStore fails the first moves as if the store were unavailable
+type failingMoveStore struct {
+	*LocalObjectStore
+	failures int
+}
+
+func (s *failingMoveStore) Move(from, to string) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("store unavailable")
+	}
+	return s.LocalObjectStore.Move(from, to)
+}
+
+func writeTestEvents(t *testing.T, writer *RotatingWriter, start time.Time, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		err := writer.Write(&testEvent{EventTime: start.Add(time.Duration(i) * time.Second).UnixMilli(), Name: "event"})
+		if err != nil {
+			t.Fatalf("write %d failed, %v", i, err)
+		}
+	}
+}
+
+func TestRotatingWriterCommitFailure(t *testing.T) {
+	store, catalog, table := newTestIcebergTable(t)
+	// every attempt of the first commit fails, as if the catalog were down
+	catalog.conflicts = icebergCommitAttempts
+	// a target size of 0 rotates the file before every write after the first
+	writer := NewRotatingWriter(store, "flow", 60, 60, 0, 1, table, PartitionLayout{})
+
+	writeTestEvents(t, writer, time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), 3)
+	if len(table.pending) != 0 {
+		t.Errorf("%d files still pending after the catalog came back", len(table.pending))
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := currentDataFiles(t, table)
+	if len(files) != 3 {
+		t.Errorf("table has %d data files, expected all 3 written, %v", len(files), files)
+	}
+	for path, records := range files {
+		if records != 1 {
+			t.Errorf("%s has %d records, expected 1", path, records)
+		}
+	}
+}
+
+func TestRotatingWriterMoveFailure(t *testing.T) {
+	store := &failingMoveStore{LocalObjectStore: NewLocalObjectStore(t.TempDir())}
+	writer := NewRotatingWriter(store, "flow", 60, 60, 0, 1, ParquetFormat{Options: DefaultParquetOptions()}, PartitionLayout{})
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	// the rotation on the second write fails to move the first file into place, and the rest of the events go to a new file
+	store.failures = 1
+	writeTestEvents(t, writer, start, 3)
+
+	// one of the two open partitions fails to close, and the other is still closed
+	writeTestEvents(t, writer, start.Add(time.Hour), 1)
+	store.failures = 1
+	err := writer.Close()
+	if err == nil || !strings.Contains(err.Error(), "store unavailable") {
+		t.Fatalf("close returned %v, expected the move's error", err)
+	}
+	if len(writer.openWriters) != 0 {
+		t.Errorf("%d writers still open", len(writer.openWriters))
+	}
+
+	entries := append(readManifests(t, store, "flow/event_date=2024-01-02/event_hour=3"), readManifests(t, store, "flow/event_date=2024-01-02/event_hour=4")...)
+	records := int64(0)
+	for _, entry := range entries {
+		records += entry.Records
+	}
+	// the first file and one of the last two are lost
+	if len(entries) != 2 || records != 2 {
+		t.Errorf("manifests list %d files of %d records, expected 2 of 2", len(entries), records)
+	}
+
+	// the writer can still be used once the store comes back
+	writeTestEvents(t, writer, start.Add(2*time.Hour), 1)
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := readManifests(t, store, "flow/event_date=2024-01-02/event_hour=5"); len(entries) != 1 {
+		t.Errorf("manifest lists %d files after the store came back, expected 1", len(entries))
+	}
+}
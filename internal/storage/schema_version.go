@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+const (
+	// SchemaVersionMetadataKey is the key-value metadata key parquet files record the schema version of their model under
+	SchemaVersionMetadataKey = "surithena.schema_version"
+)
+
+// SchemaVersioned is implemented by models which declare the version of their schema, so readers of old partitions can tell which fields they were written with
+type SchemaVersioned interface {
+	SchemaVersion() int
+}
+
+// SchemaVersionMetadata returns the key-value metadata written into the footer of files of the model, which is empty if the model isn't versioned
+func SchemaVersionMetadata(model interface{}) []*parquet.KeyValue {
+	versioned, ok := model.(SchemaVersioned)
+	if !ok {
+		return nil
+	}
+	version := strconv.Itoa(versioned.SchemaVersion())
+	return []*parquet.KeyValue{
+		{
+			Key:   SchemaVersionMetadataKey,
+			Value: &version,
+		},
+	}
+}
+
+// ParquetSchemaVersion returns the schema version recorded in the key-value metadata of a file, or false for files written before models were versioned
+func ParquetSchemaVersion(metadata []*parquet.KeyValue) (int, bool) {
+	for _, keyValue := range metadata {
+		if keyValue.Key != SchemaVersionMetadataKey || keyValue.Value == nil {
+			continue
+		}
+		version, err := strconv.Atoi(*keyValue.Value)
+		if err != nil {
+			return 0, false
+		}
+		return version, true
+	}
+	return 0, false
+}
+
+func metadataFingerprint(metadata []*parquet.KeyValue) string {
+	parts := []string{}
+	for _, keyValue := range metadata {
+		parts = append(parts, fmt.Sprintf("%s=%s", keyValue.Key, keyValue.GetValue()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
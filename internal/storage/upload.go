@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/google/uuid"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+const (
+	// uploadPartSize is fixed so the ETag S3 computes for a multipart upload can be predicted
+	uploadPartSize       = manager.DefaultUploadPartSize
+	uploadingPrefix      = "_uploading-"
+	manifestPrefix       = "_manifest-"
+	manifestExtension    = ".ndjson"
+	objectNameTimeFormat = "20060102T150405Z"
+)
+
+var (
+	unsafeObjectNameRegex = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+// checksumFile hashes everything written to the file, so the uploaded object can be verified against what was written
+type checksumFile struct {
+	source.ParquetFile
+	size     int64
+	sha256   hash.Hash
+	md5      hash.Hash
+	partMD5  hash.Hash
+	partFill int64
+	partSums []byte
+	parts    int
+}
+
+func newChecksumFile(file source.ParquetFile) *checksumFile {
+	return &checksumFile{
+		ParquetFile: file,
+		sha256:      sha256.New(),
+		md5:         md5.New(),
+		partMD5:     md5.New(),
+	}
+}
+
+func (f *checksumFile) Write(p []byte) (int, error) {
+	n, err := f.ParquetFile.Write(p)
+	written := p[:n]
+	f.size += int64(n)
+	f.sha256.Write(written)
+	f.md5.Write(written)
+	for len(written) > 0 {
+		chunk := written
+		if remaining := uploadPartSize - f.partFill; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		f.partMD5.Write(chunk)
+		f.partFill += int64(len(chunk))
+		written = written[len(chunk):]
+		if f.partFill == uploadPartSize {
+			f.finishPart()
+		}
+	}
+	return n, err
+}
+
+func (f *checksumFile) finishPart() {
+	f.partSums = append(f.partSums, f.partMD5.Sum(nil)...)
+	f.parts++
+	f.partMD5.Reset()
+	f.partFill = 0
+}
+
+func (f *checksumFile) SHA256() string {
+	return hex.EncodeToString(f.sha256.Sum(nil))
+}
+
+// ETag returns the ETag S3 gives the object, which is the MD5 of a single part upload or the MD5 of the part MD5s for a multipart upload
+func (f *checksumFile) ETag() string {
+	if f.size < uploadPartSize {
+		return hex.EncodeToString(f.md5.Sum(nil))
+	}
+	sums := f.partSums
+	parts := f.parts
+	if f.partFill > 0 {
+		sums = append(append([]byte{}, sums...), f.partMD5.Sum(nil)...)
+		parts++
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts)
+}
+
+// verifyUpload checks the uploaded object matches what was written, comparing its ETag when the store reports one and otherwise reading it back to compare its SHA-256
+func verifyUpload(store ObjectStore, key string, checksum *checksumFile) error {
+	info, err := store.Stat(key)
+	if err != nil {
+		return err
+	}
+	if info.Size != checksum.size {
+		return fmt.Errorf("uploaded %s is %d bytes, expected %d", store.URL(key), info.Size, checksum.size)
+	}
+	if info.ETag != "" {
+		if info.ETag != checksum.ETag() {
+			return fmt.Errorf("uploaded %s has ETag %s, expected %s", store.URL(key), info.ETag, checksum.ETag())
+		}
+		return nil
+	}
+
+	file, err := store.Open(key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	// a large buffer keeps the number of ranged reads down
+	_, err = io.CopyBuffer(hash, file, make([]byte, uploadPartSize))
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum.SHA256() {
+		return fmt.Errorf("uploaded %s has SHA-256 %s, expected %s", store.URL(key), sum, checksum.SHA256())
+	}
+	return nil
+}
+
+// objectNamer names the files of one RotatingWriter <sensor>-<start time>-<random id>-<sequence>, so names sort in the order they were written and never collide between sensors,
+// nor between writers of one sensor started in the same second, such as after a quick restart or compaction running alongside ingestion
+type objectNamer struct {
+	id       string
+	sequence int64
+}
+
+func newObjectNamer(sensorName string, started time.Time) *objectNamer {
+	name := strings.TrimLeft(unsafeObjectNameRegex.ReplaceAllString(sensorName, "-"), "_.-")
+	if name == "" {
+		name = "eve-processor"
+	}
+	return &objectNamer{
+		id: fmt.Sprintf("%s-%s-%s", name, started.UTC().Format(objectNameTimeFormat), uuid.New().String()[:8]),
+	}
+}
+
+func (n *objectNamer) next(extension string) string {
+	return fmt.Sprintf("%s-%06d%s", n.id, atomic.AddInt64(&n.sequence, 1), extension)
+}
+
+// manifestName is the manifest this writer keeps in every partition it writes to, hidden from Athena by its _ prefix
+func (n *objectNamer) manifestName() string {
+	return manifestPrefix + n.id + manifestExtension
+}
+
+// ManifestEntry describes one file in a partition manifest, which lists the files each writer has made visible in the partition so they can be processed incrementally without listing the bucket.
+// Compaction lists the file it merges into in its own manifest, along with an entry with ReplacedBy set for each file it deletes, so readers of the manifests should skip keys any manifest of the partition marks replaced.
+type ManifestEntry struct {
+	Key          string    `json:"key"`
+	Format       string    `json:"format"`
+	Records      int64     `json:"records"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	MinEventTime time.Time `json:"min_event_time"`
+	MaxEventTime time.Time `json:"max_event_time"`
+	WrittenAt    time.Time `json:"written_at"`
+	ReplacedBy   string    `json:"replaced_by,omitempty"`
+}
+
+// appendManifest rewrites the manifest with entries appended, as objects can't be appended to. Each writer has its own manifest so there's no other writer to race with.
+func appendManifest(store ObjectStore, key string, entries ...ManifestEntry) error {
+	data, err := ReadObject(store, key)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	return WriteObject(store, key, data)
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	// S3 allows at most 10 tags per object
+	maxObjectTags = 10
+)
+
+// UploadOptions are applied to every object written to S3, including the copy made when a finished file is moved into place
+type UploadOptions struct {
+	// KMSKeyID encrypts objects with SSE-KMS using this key when set, otherwise the bucket's default encryption applies
+	KMSKeyID         string
+	BucketKeyEnabled bool
+	Tags             map[string]string
+}
+
+// ParseObjectTags parses comma separated key=value pairs, e.g. classification=confidential,team=soc
+func ParseObjectTags(value string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid object tag %s, expected key=value", pair)
+		}
+		tags[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
+
+// Validate checks the options are accepted by S3
+func (o UploadOptions) Validate() error {
+	if len(o.Tags) > maxObjectTags {
+		return fmt.Errorf("%d object tags configured, S3 allows at most %d", len(o.Tags), maxObjectTags)
+	}
+	for key, value := range o.Tags {
+		if len(key) > 128 || len(value) > 256 {
+			return fmt.Errorf("object tag %s is too long, keys are limited to 128 characters and values to 256", key)
+		}
+	}
+	return nil
+}
+
+// tagging encodes the tags as the URL query string S3 expects
+func (o UploadOptions) tagging() *string {
+	if len(o.Tags) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	keys := []string{}
+	for key := range o.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values.Set(key, o.Tags[key])
+	}
+	return aws.String(values.Encode())
+}
+
+func (o UploadOptions) serverSideEncryption() (types.ServerSideEncryption, *string) {
+	if o.KMSKeyID == "" {
+		return "", nil
+	}
+	return types.ServerSideEncryptionAwsKms, aws.String(o.KMSKeyID)
+}
+
+// addToStack sets the options on the PutObject and CreateMultipartUpload calls made by the uploader, which doesn't expose those fields itself
+func (o UploadOptions) addToStack(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("SurithenaUploadOptions", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		encryption, keyID := o.serverSideEncryption()
+		switch params := in.Parameters.(type) {
+		case *s3.PutObjectInput:
+			params.ServerSideEncryption = encryption
+			params.SSEKMSKeyId = keyID
+			params.BucketKeyEnabled = o.BucketKeyEnabled && keyID != nil
+			params.Tagging = o.tagging()
+		case *s3.CreateMultipartUploadInput:
+			params.ServerSideEncryption = encryption
+			params.SSEKMSKeyId = keyID
+			params.BucketKeyEnabled = o.BucketKeyEnabled && keyID != nil
+			params.Tagging = o.tagging()
+		}
+		return next.HandleInitialize(ctx, in)
+	}), middleware.Before)
+}
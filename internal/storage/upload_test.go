@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestObjectNamer(t *testing.T) {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+2", 2*60*60))
+	tests := []struct {
+		sensorName string
+		id         string
+	}{
+		{sensorName: "sensor-1", id: "sensor-1"},
+		{sensorName: "my sensor/a", id: "my-sensor-a"},
+		{sensorName: "_.hidden", id: "hidden"},
+		{sensorName: "", id: "eve-processor"},
+	}
+	for _, test := range tests {
+		t.Run(test.sensorName, func(t *testing.T) {
+			namer := newObjectNamer(test.sensorName, started)
+			file := regexp.MustCompile(`^` + regexp.QuoteMeta(test.id) + `-20240102T010405Z-[0-9a-f]{8}-000001\.parquet$`)
+			if name := namer.next(".parquet"); !file.MatchString(name) {
+				t.Errorf("file is named %s, expected it to match %s", name, file)
+			}
+			manifest := regexp.MustCompile(`^_manifest-` + regexp.QuoteMeta(test.id) + `-20240102T010405Z-[0-9a-f]{8}\.ndjson$`)
+			if name := namer.manifestName(); !manifest.MatchString(name) {
+				t.Errorf("manifest is named %s, expected it to match %s", name, manifest)
+			}
+		})
+	}
+}
+
+func TestObjectNamerSameSecond(t *testing.T) {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := newObjectNamer("sensor-1", started)
+	second := newObjectNamer("sensor-1", started.Add(500*time.Millisecond))
+	if a, b := first.next(".parquet"), second.next(".parquet"); a == b {
+		t.Errorf("writers started in the same second both named a file %s", a)
+	}
+	if first.manifestName() == second.manifestName() {
+		t.Errorf("writers started in the same second share the manifest %s", first.manifestName())
+	}
+}
+
+func TestObjectNamerSequence(t *testing.T) {
+	namer := newObjectNamer("sensor-1", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	names := make([]string, 100)
+	wg := sync.WaitGroup{}
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			names[i] = namer.next(".parquet")
+		}(i)
+	}
+	wg.Wait()
+
+	// names are unique and sort in sequence order
+	sort.Strings(names)
+	for i, name := range names {
+		if expected := fmt.Sprintf("%s-%06d.parquet", namer.id, i+1); name != expected {
+			t.Fatalf("name %d is %s, expected %s", i, name, expected)
+		}
+	}
+}
+
+func TestLocalObjectStoreMove(t *testing.T) {
+	store := NewLocalObjectStore(t.TempDir())
+	for _, key := range []string{"a/_uploading-1", "a/_uploading-2"} {
+		file, err := store.Create(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.Write([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	err := store.Move("a/_uploading-1", "a/b/1.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Move("a/_uploading-2", "a/b/1.parquet")
+	if !errors.Is(err, ErrObjectExists) {
+		t.Fatalf("moving onto an existing key returned %v, expected ErrObjectExists", err)
+	}
+	data, err := ReadObject(store, "a/b/1.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a/_uploading-1" {
+		t.Errorf("the existing object was overwritten with %s", data)
+	}
+	if _, err := store.Stat("a/_uploading-2"); err != nil {
+		t.Errorf("the object which failed to move is gone, %v", err)
+	}
+	if _, err := store.Stat("a/_uploading-1"); !IsNotFound(err) {
+		t.Errorf("the moved object is still at its old key")
+	}
+}
+
+func TestManifestEntryEncoding(t *testing.T) {
+	written := time.Date(2024, 1, 2, 3, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		entry    ManifestEntry
+		expected string
+	}{
+		{
+			name: "written file",
+			entry: ManifestEntry{
+				Key:          "flow/event_date=2024-01-02/event_hour=3/a.parquet",
+				Format:       "parquet",
+				Records:      10,
+				Size:         2048,
+				SHA256:       "abc",
+				MinEventTime: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+				MaxEventTime: time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC),
+				WrittenAt:    written,
+			},
+			expected: `{"key":"flow/event_date=2024-01-02/event_hour=3/a.parquet","format":"parquet","records":10,"size":2048,"sha256":"abc","min_event_time":"2024-01-02T03:00:00Z","max_event_time":"2024-01-02T03:04:00Z","written_at":"2024-01-02T03:05:00Z"}`,
+		},
+		{
+			name: "replaced file",
+			entry: ManifestEntry{
+				Key:        "a.parquet",
+				WrittenAt:  written,
+				ReplacedBy: "b.parquet",
+			},
+			expected: `{"key":"a.parquet","format":"","records":0,"size":0,"sha256":"","min_event_time":"0001-01-01T00:00:00Z","max_event_time":"0001-01-01T00:00:00Z","written_at":"2024-01-02T03:05:00Z","replaced_by":"b.parquet"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("entry is encoded as %s, expected %s", data, test.expected)
+			}
+			decoded := ManifestEntry{}
+			err = json.Unmarshal(data, &decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, test.entry) {
+				t.Errorf("entry is decoded as %+v, expected %+v", decoded, test.entry)
+			}
+		})
+	}
+}
+
+// notFoundError is an error with the status code S3 responds with for a missing key
+type notFoundError struct{}
+
+func (notFoundError) Error() string       { return "not found" }
+func (notFoundError) HTTPStatusCode() int { return 404 }
+
+// fakeS3 implements the calls S3ObjectStore.Move makes over a set of keys
+type fakeS3 struct {
+	S3API
+	objects map[string]bool
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if !f.objects[*params.Key] {
+		return nil, notFoundError{}
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.objects[*params.Key] = true
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	for _, object := range params.Delete.Objects {
+		delete(f.objects, *object.Key)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestS3ObjectStoreMove(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		err    error
+	}{
+		{name: "new key", exists: false},
+		{name: "existing key", exists: true, err: ErrObjectExists},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeS3{objects: map[string]bool{"a/_uploading-1": true, "a/1.parquet": test.exists}}
+			store, _, err := OpenObjectStore("s3://bucket/a", api, UploadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.Move("a/_uploading-1", "a/1.parquet")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("move returned %v, expected %v", err, test.err)
+			}
+			// the source is only deleted once it's copied
+			if api.objects["a/_uploading-1"] != (test.err != nil) {
+				t.Errorf("source exists is %v after the move", api.objects["a/_uploading-1"])
+			}
+		})
+	}
+}
@@ -9,42 +9,50 @@ import (
 )
 
 type AlertEvent struct {
-	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
-	EventType string `json:"event_type"`
-	SrcIP     string `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DestIP    string `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	SrcPort   int    `json:"src_port" parquet:"name=src_port, type=INT32"`
-	DestPort  int    `json:"dest_port" parquet:"name=dest_port, type=INT32"`
-	Proto     string `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	AppProto  string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	FlowID    int64  `json:"flow_id" parquet:"name=flow_id, type=INT64"`
-	InIface   string `json:"in_iface" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Vlan      int    `json:"vlan" parquet:"name=vlan, type=INT32"`
-	TxID      int    `json:"tx_id" parquet:"name=tx_id, type=INT32"`
+	Timestamp   string  `json:"timestamp"`
+	EventTime   int64   `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
+	EventType   string  `json:"event_type"`
+	SrcIP       string  `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Source IP address"`
+	DestIP      string  `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Destination IP address"`
+	SrcPort     *int    `json:"src_port,omitempty" parquet:"name=src_port, type=INT32, repetitiontype=OPTIONAL" desc:"Source port"`
+	DestPort    *int    `json:"dest_port,omitempty" parquet:"name=dest_port, type=INT32, repetitiontype=OPTIONAL" desc:"Destination port"`
+	Proto       string  `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Transport protocol, e.g. TCP, UDP or ICMP"`
+	AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol Suricata detected on the flow"`
+	FlowID      *int64  `json:"flow_id,omitempty" parquet:"name=flow_id, type=INT64, repetitiontype=OPTIONAL" desc:"Suricata flow ID, shared by every event of the same flow"`
+	InIface     *string `json:"in_iface,omitempty" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Interface the packets were captured on"`
+	Vlan        []int   `json:"vlan,omitempty" parquet:"name=vlan, type=MAP, convertedtype=LIST, valuetype=INT32" desc:"VLAN IDs the packets are tagged with, outermost first"`
+	TxID        *int    `json:"tx_id,omitempty" parquet:"name=tx_id, type=INT32, repetitiontype=OPTIONAL" desc:"ID of the application layer transaction within the flow"`
+	ICMPType    int     `json:"icmp_type"`
+	ICMPCode    int     `json:"icmp_code"`
+	CommunityID string  `json:"community_id" parquet:"name=community_id, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Community ID flow hash, for correlating with other tools"`
+	Host        string  `json:"host"`
 
 	Alert struct {
-		Action      string `json:"action" parquet:"name=action, type=BYTE_ARRAY, convertedtype=UTF8"`
-		GID         int    `json:"gid" parquet:"name=gid, type=INT32"`
-		SignatureID int    `json:"signature_id" parquet:"name=signature_id, type=INT32"`
-		Rev         int    `json:"rev" parquet:"name=rev, type=INT32"`
-		AppProto    string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Signature   string `json:"signature" parquet:"name=signature, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Severity    int    `json:"severity" parquet:"name=severity, type=INT32"`
-		Source      struct {
-			IP   string `json:"ip" parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-			Port int    `json:"port" parquet:"name=port, type=INT32"`
-		} `json:"source" parquet:"name=source"`
-		Target struct {
-			IP   string `json:"ip" parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-			Port int    `json:"port" parquet:"name=port, type=INT32"`
-		} `json:"target" parquet:"name=target"`
-	} `json:"alert" parquet:"name=alert"`
+		Action      string  `json:"action" parquet:"name=action, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Action taken, allowed or blocked"`
+		GID         int     `json:"gid" parquet:"name=gid, type=INT32" desc:"Generator ID of the signature"`
+		SignatureID int     `json:"signature_id" parquet:"name=signature_id, type=INT32" desc:"Signature ID (SID) of the rule"`
+		Rev         int     `json:"rev" parquet:"name=rev, type=INT32" desc:"Revision of the rule"`
+		AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol of the alert"`
+		Signature   string  `json:"signature" parquet:"name=signature, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Message of the rule"`
+		Severity    int     `json:"severity" parquet:"name=severity, type=INT32" desc:"Severity of the rule, 1 being the highest"`
+		Source      *struct {
+			IP   string `json:"ip" parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"IP address of the attack source"`
+			Port *int   `json:"port,omitempty" parquet:"name=port, type=INT32, repetitiontype=OPTIONAL" desc:"Port of the attack source"`
+		} `json:"source,omitempty" parquet:"name=source, repetitiontype=OPTIONAL" desc:"Endpoint the rule marks as the source of the attack"`
+		Target *struct {
+			IP   string `json:"ip" parquet:"name=ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"IP address of the attack target"`
+			Port *int   `json:"port,omitempty" parquet:"name=port, type=INT32, repetitiontype=OPTIONAL" desc:"Port of the attack target"`
+		} `json:"target,omitempty" parquet:"name=target, repetitiontype=OPTIONAL" desc:"Endpoint the rule marks as the target of the attack"`
+	} `json:"alert" parquet:"name=alert" desc:"Details of the signature which fired"`
 
 	GeoIPData struct {
-		Source GeoIPData `json:"source" parquet:"name=source"`
-		Dest   GeoIPData `json:"dest" parquet:"name=dest"`
-	} `json:"geoip_data" parquet:"name=geoip_data"`
+		Source GeoIPData `json:"source" parquet:"name=source" desc:"GeoIP location of the source address"`
+		Dest   GeoIPData `json:"dest" parquet:"name=dest" desc:"GeoIP location of the destination address"`
+	} `json:"geoip_data" parquet:"name=geoip_data" desc:"GeoIP enrichment of the source and destination addresses"`
+
+	ThreatIntelMatches []ThreatIntelMatch `json:"ti_matches" parquet:"name=ti_matches, type=LIST" desc:"Threat intel indicators the event matched"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
 }
 
 func (e *AlertEvent) UpdateGeoIP(reader *geoip2.Reader) error {
@@ -61,14 +69,65 @@ func (e *AlertEvent) UpdateGeoIP(reader *geoip2.Reader) error {
 	return nil
 }
 
+func (e *AlertEvent) UpdateThreatIntel(db *ThreatIntelDB) error {
+	e.ThreatIntelMatches = []ThreatIntelMatch{}
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("src_ip", e.SrcIP)...)
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("dest_ip", e.DestIP)...)
+	return nil
+}
+
+// UpdateCommunityID computes the Community ID of the flow, unless Suricata already included one in the event
+func (e *AlertEvent) UpdateCommunityID(seed uint16) error {
+	if e.CommunityID != "" {
+		return nil
+	}
+	srcPort, destPort := communityIDPorts(e.Proto, e.SrcPort, e.DestPort, e.ICMPType, e.ICMPCode)
+	communityID, err := CommunityID(seed, e.SrcIP, e.DestIP, srcPort, destPort, e.Proto)
+	if err != nil {
+		return err
+	}
+	e.CommunityID = communityID
+	return nil
+}
+
+func (e *AlertEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
+}
+
 func (e AlertEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:    e.Timestamp[:10],
+		Hour:    hour,
+		Minute:  minute,
+		InIface: stringValue(e.InIface),
+		Vlan:    outerVlan(e.Vlan),
 	}
 }
 
+func (e AlertEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// alertEventSchemaChangelog records the columns added in each version of the alert schema, the last entry being the current version
+var alertEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+	{
+		Version:     2,
+		Description: "src_port, dest_port, tx_id, app_proto, in_iface, flow_id, alert.app_proto, alert.source and alert.target, and the ports of the alert source and target, are NULL when absent from the EVE record, rather than 0 or an empty string. app_proto is only logged once a protocol is detected, in_iface only for live captures, flow_id only for alerts on flows and source and target only for rules with a target keyword. src_ip, dest_ip, proto and the action, gid, signature_id, rev, signature and severity of alert stay REQUIRED as Suricata logs them for every alert. vlan is the list of VLAN IDs Suricata logs, outermost first and empty for untagged traffic, rather than an int which no tagged event could be decoded into. Files written before have to be migrated, as Athena can't read their int vlan as an array",
+	},
+}
+
+func (e AlertEvent) SchemaVersion() int {
+	return 2
+}
+
+func (e AlertEvent) SchemaChangelog() []SchemaRevision {
+	return alertEventSchemaChangelog
+}
+
 func (e *AlertEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
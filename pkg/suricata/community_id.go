@@ -0,0 +1,112 @@
+package suricata
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	protocolNumbers = map[string]uint8{
+		"icmp":      1,
+		"tcp":       6,
+		"udp":       17,
+		"ipv6-icmp": 58,
+		"icmpv6":    58,
+		"sctp":      132,
+	}
+
+	// ICMP type pairs that form a request/response conversation, used to make the hash direction-independent
+	icmpv4Equivalents = map[int]int{8: 0, 0: 8, 13: 14, 14: 13, 15: 16, 16: 15, 17: 18, 18: 17, 10: 9, 9: 10}
+	icmpv6Equivalents = map[int]int{128: 129, 129: 128, 133: 134, 134: 133, 135: 136, 136: 135, 130: 131, 131: 130, 144: 145, 145: 144, 139: 140, 140: 139}
+)
+
+type CommunityIDModel interface {
+	UpdateCommunityID(seed uint16) error
+}
+
+func ProtocolNumber(proto string) (uint8, error) {
+	if number, ok := protocolNumbers[strings.ToLower(proto)]; ok {
+		return number, nil
+	}
+	number, err := strconv.ParseUint(proto, 10, 8)
+	if err != nil {
+		return 0, errors.New("unknown protocol " + proto)
+	}
+	return uint8(number), nil
+}
+
+// CommunityID computes the Community ID v1 flow hash. For ICMP the ports are interpreted as the ICMP type and code, as they are in the specification.
+func CommunityID(seed uint16, srcIPString, destIPString string, srcPort, destPort int, proto string) (string, error) {
+	srcIP := net.ParseIP(srcIPString)
+	if srcIP == nil {
+		return "", errors.New("invalid IP address " + srcIPString)
+	}
+	destIP := net.ParseIP(destIPString)
+	if destIP == nil {
+		return "", errors.New("invalid IP address " + destIPString)
+	}
+	if v4 := srcIP.To4(); v4 != nil {
+		srcIP = v4
+	}
+	if v4 := destIP.To4(); v4 != nil {
+		destIP = v4
+	}
+	protoNumber, err := ProtocolNumber(proto)
+	if err != nil {
+		return "", err
+	}
+
+	hasPorts := true
+	oneWay := false
+	switch protoNumber {
+	case 1, 58:
+		equivalents := icmpv4Equivalents
+		if protoNumber == 58 {
+			equivalents = icmpv6Equivalents
+		}
+		if equivalent, ok := equivalents[srcPort]; ok {
+			destPort = equivalent
+		} else {
+			oneWay = true
+		}
+	case 6, 17, 132:
+	default:
+		hasPorts = false
+	}
+
+	// order the endpoints so both directions of a flow hash to the same value
+	ipComparison := bytes.Compare(srcIP, destIP)
+	if !oneWay && (ipComparison > 0 || (ipComparison == 0 && srcPort > destPort)) {
+		srcIP, destIP = destIP, srcIP
+		srcPort, destPort = destPort, srcPort
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, seed)
+	buf.Write(srcIP)
+	buf.Write(destIP)
+	buf.WriteByte(protoNumber)
+	buf.WriteByte(0)
+	if hasPorts {
+		binary.Write(buf, binary.BigEndian, uint16(srcPort))
+		binary.Write(buf, binary.BigEndian, uint16(destPort))
+	}
+
+	hash := sha1.Sum(buf.Bytes())
+	return "1:" + base64.StdEncoding.EncodeToString(hash[:]), nil
+}
+
+// communityIDPorts returns the values hashed in place of the ports, which are the ICMP type and code for ICMP flows, and 0 for ports absent from the event
+func communityIDPorts(proto string, srcPort, destPort *int, icmpType, icmpCode int) (int, int) {
+	switch strings.ToLower(proto) {
+	case "icmp", "ipv6-icmp", "icmpv6":
+		return icmpType, icmpCode
+	}
+	return intValue(srcPort), intValue(destPort)
+}
@@ -0,0 +1,87 @@
+package suricata
+
+import (
+	"testing"
+)
+
+func TestCommunityID(t *testing.T) {
+	// vectors from the Community ID specification's baseline
+	tests := []struct {
+		name     string
+		seed     uint16
+		srcIP    string
+		destIP   string
+		srcPort  int
+		destPort int
+		proto    string
+		expected string
+	}{
+		{name: "tcp", srcIP: "128.232.110.120", destIP: "66.35.250.204", srcPort: 34855, destPort: 80, proto: "TCP", expected: "1:LQU9qZlK+B5F3KDmev6m5PMibrg="},
+		{name: "tcp reversed", srcIP: "66.35.250.204", destIP: "128.232.110.120", srcPort: 80, destPort: 34855, proto: "TCP", expected: "1:LQU9qZlK+B5F3KDmev6m5PMibrg="},
+		{name: "tcp seeded", seed: 1, srcIP: "128.232.110.120", destIP: "66.35.250.204", srcPort: 34855, destPort: 80, proto: "TCP", expected: "1:3V71V58M3Ksw/yuFALMcW0LAHvc="},
+		{name: "udp", srcIP: "192.168.1.52", destIP: "8.8.8.8", srcPort: 54585, destPort: 53, proto: "UDP", expected: "1:d/FP5EW3wiY1vCndhwleRRKHowQ="},
+		{name: "sctp", srcIP: "192.168.170.8", destIP: "192.168.170.56", srcPort: 7, destPort: 80, proto: "SCTP", expected: "1:jQgCxbku+pNGw8WPbEc/TS/uTpQ="},
+		{name: "icmp echo request", srcIP: "192.168.0.89", destIP: "192.168.0.1", srcPort: 8, destPort: 0, proto: "ICMP", expected: "1:X0snYXpgwiv9TZtqg64sgzUn6Dk="},
+		{name: "icmp echo reply", srcIP: "192.168.0.1", destIP: "192.168.0.89", srcPort: 0, destPort: 0, proto: "ICMP", expected: "1:X0snYXpgwiv9TZtqg64sgzUn6Dk="},
+		{name: "icmpv6 neighbor solicitation", srcIP: "fe80::200:86ff:fe05:80da", destIP: "fe80::260:97ff:fe07:69ea", srcPort: 135, destPort: 0, proto: "IPv6-ICMP", expected: "1:dGHyGvjMfljg6Bppwm3bg0LO8TY="},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := CommunityID(test.seed, test.srcIP, test.destIP, test.srcPort, test.destPort, test.proto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != test.expected {
+				t.Errorf("community id is %s, expected %s", id, test.expected)
+			}
+		})
+	}
+}
+
+func TestCommunityIDICMPv6Equivalents(t *testing.T) {
+	tests := []struct {
+		name         string
+		requestType  int
+		responseType int
+	}{
+		{name: "echo", requestType: 128, responseType: 129},
+		{name: "neighbor discovery", requestType: 135, responseType: 136},
+		{name: "node information", requestType: 139, responseType: 140},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := CommunityID(0, "2001:db8::1", "2001:db8::2", test.requestType, 0, "IPv6-ICMP")
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := CommunityID(0, "2001:db8::2", "2001:db8::1", test.responseType, 0, "IPv6-ICMP")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if request != response {
+				t.Errorf("request hashes to %s and response to %s", request, response)
+			}
+		})
+	}
+}
+
+func TestCommunityIDErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		srcIP  string
+		destIP string
+		proto  string
+	}{
+		{name: "invalid source", srcIP: "not-an-ip", destIP: "10.0.0.1", proto: "TCP"},
+		{name: "invalid destination", srcIP: "10.0.0.1", destIP: "", proto: "TCP"},
+		{name: "unknown protocol", srcIP: "10.0.0.1", destIP: "10.0.0.2", proto: "QUIC"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := CommunityID(0, test.srcIP, test.destIP, 1, 2, test.proto)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -9,33 +9,41 @@ import (
 )
 
 type DHCPEvent struct {
-	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
-	EventType string `json:"event_type"`
-	SrcIP     string `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DestIP    string `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	SrcPort   int    `json:"src_port" parquet:"name=src_port, type=INT32"`
-	DestPort  int    `json:"dest_port" parquet:"name=dest_port, type=INT32"`
-	Proto     string `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	AppProto  string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	FlowID    int64  `json:"flow_id" parquet:"name=flow_id, type=INT64"`
-	InIface   string `json:"in_iface" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Vlan      int    `json:"vlan" parquet:"name=vlan, type=INT32"`
-	TxID      int    `json:"tx_id" parquet:"name=tx_id, type=INT32"`
+	Timestamp   string  `json:"timestamp"`
+	EventTime   int64   `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
+	EventType   string  `json:"event_type"`
+	SrcIP       string  `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Source IP address"`
+	DestIP      string  `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Destination IP address"`
+	SrcPort     *int    `json:"src_port,omitempty" parquet:"name=src_port, type=INT32, repetitiontype=OPTIONAL" desc:"Source port"`
+	DestPort    *int    `json:"dest_port,omitempty" parquet:"name=dest_port, type=INT32, repetitiontype=OPTIONAL" desc:"Destination port"`
+	Proto       string  `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Transport protocol, e.g. TCP, UDP or ICMP"`
+	AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol Suricata detected on the flow"`
+	FlowID      int64   `json:"flow_id" parquet:"name=flow_id, type=INT64" desc:"Suricata flow ID, shared by every event of the same flow"`
+	InIface     *string `json:"in_iface,omitempty" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Interface the packets were captured on"`
+	Vlan        []int   `json:"vlan,omitempty" parquet:"name=vlan, type=MAP, convertedtype=LIST, valuetype=INT32" desc:"VLAN IDs the packets are tagged with, outermost first"`
+	TxID        *int    `json:"tx_id,omitempty" parquet:"name=tx_id, type=INT32, repetitiontype=OPTIONAL" desc:"ID of the application layer transaction within the flow"`
+	ICMPType    int     `json:"icmp_type"`
+	ICMPCode    int     `json:"icmp_code"`
+	CommunityID string  `json:"community_id" parquet:"name=community_id, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Community ID flow hash, for correlating with other tools"`
+	Host        string  `json:"host"`
 
 	DHCP struct {
-		Type        string `json:"type" parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8"`
-		ID          int    `json:"id" parquet:"name=id, type=INT32"`
-		ClientMac   string `json:"client_mac" parquet:"name=client_mac, type=BYTE_ARRAY, convertedtype=UTF8"`
-		AssignedIP  string `json:"assigned_ip" parquet:"name=assigned_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-		DHCPType    string `json:"dhcp_type" parquet:"name=dhcp_type, type=BYTE_ARRAY, convertedtype=UTF8"`
-		RenewalTime int    `json:"renewal_time" parquet:"name=renewal_time, type=INT32"`
-	} `json:"dhcp" parquet:"name=dhcp"`
+		Type        string  `json:"type" parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Whether the message is a request or a reply"`
+		ID          int     `json:"id" parquet:"name=id, type=INT32" desc:"DHCP transaction ID"`
+		ClientMac   string  `json:"client_mac" parquet:"name=client_mac, type=BYTE_ARRAY, convertedtype=UTF8" desc:"MAC address of the client"`
+		AssignedIP  *string `json:"assigned_ip,omitempty" parquet:"name=assigned_ip, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"IP address assigned to the client"`
+		DHCPType    *string `json:"dhcp_type,omitempty" parquet:"name=dhcp_type, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"DHCP message type, e.g. discover, offer, request or ack"`
+		RenewalTime *int    `json:"renewal_time,omitempty" parquet:"name=renewal_time, type=INT32, repetitiontype=OPTIONAL" desc:"Lease renewal time in seconds"`
+	} `json:"dhcp" parquet:"name=dhcp" desc:"DHCP message details"`
 
 	GeoIPData struct {
-		Source GeoIPData `json:"source" parquet:"name=source"`
-		Dest   GeoIPData `json:"dest" parquet:"name=dest"`
-	} `json:"geoip_data" parquet:"name=geoip_data"`
+		Source GeoIPData `json:"source" parquet:"name=source" desc:"GeoIP location of the source address"`
+		Dest   GeoIPData `json:"dest" parquet:"name=dest" desc:"GeoIP location of the destination address"`
+	} `json:"geoip_data" parquet:"name=geoip_data" desc:"GeoIP enrichment of the source and destination addresses"`
+
+	ThreatIntelMatches []ThreatIntelMatch `json:"ti_matches" parquet:"name=ti_matches, type=LIST" desc:"Threat intel indicators the event matched"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
 }
 
 func (e *DHCPEvent) UpdateGeoIP(reader *geoip2.Reader) error {
@@ -52,14 +60,65 @@ func (e *DHCPEvent) UpdateGeoIP(reader *geoip2.Reader) error {
 	return nil
 }
 
+func (e *DHCPEvent) UpdateThreatIntel(db *ThreatIntelDB) error {
+	e.ThreatIntelMatches = []ThreatIntelMatch{}
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("src_ip", e.SrcIP)...)
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("dest_ip", e.DestIP)...)
+	return nil
+}
+
+// UpdateCommunityID computes the Community ID of the flow, unless Suricata already included one in the event
+func (e *DHCPEvent) UpdateCommunityID(seed uint16) error {
+	if e.CommunityID != "" {
+		return nil
+	}
+	srcPort, destPort := communityIDPorts(e.Proto, e.SrcPort, e.DestPort, e.ICMPType, e.ICMPCode)
+	communityID, err := CommunityID(seed, e.SrcIP, e.DestIP, srcPort, destPort, e.Proto)
+	if err != nil {
+		return err
+	}
+	e.CommunityID = communityID
+	return nil
+}
+
+func (e *DHCPEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
+}
+
 func (e DHCPEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:    e.Timestamp[:10],
+		Hour:    hour,
+		Minute:  minute,
+		InIface: stringValue(e.InIface),
+		Vlan:    outerVlan(e.Vlan),
 	}
 }
 
+func (e DHCPEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// dhcpEventSchemaChangelog records the columns added in each version of the dhcp schema, the last entry being the current version
+var dhcpEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+	{
+		Version:     2,
+		Description: "src_port, dest_port, tx_id, app_proto, in_iface, assigned_ip, renewal_time and dhcp.dhcp_type are NULL when absent from the EVE record, rather than 0 or an empty string. app_proto is only logged once a protocol is detected, in_iface only for live captures and dhcp_type only with extended logging. The type, id and client_mac of dhcp stay REQUIRED as Suricata logs them for every message. vlan is the list of VLAN IDs Suricata logs, outermost first and empty for untagged traffic, rather than an int which no tagged event could be decoded into. Files written before have to be migrated, as Athena can't read their int vlan as an array",
+	},
+}
+
+func (e DHCPEvent) SchemaVersion() int {
+	return 2
+}
+
+func (e DHCPEvent) SchemaChangelog() []SchemaRevision {
+	return dhcpEventSchemaChangelog
+}
+
 func (e *DHCPEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
@@ -9,43 +9,53 @@ import (
 )
 
 type DNSEvent struct {
-	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
-	EventType string `json:"event_type"`
-	SrcIP     string `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DestIP    string `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	SrcPort   int    `json:"src_port" parquet:"name=src_port, type=INT32"`
-	DestPort  int    `json:"dest_port" parquet:"name=dest_port, type=INT32"`
-	Proto     string `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	AppProto  string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	FlowID    int64  `json:"flow_id" parquet:"name=flow_id, type=INT64"`
-	InIface   string `json:"in_iface" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Vlan      int    `json:"vlan" parquet:"name=vlan, type=INT32"`
-	TxID      int    `json:"tx_id" parquet:"name=tx_id, type=INT32"`
+	Timestamp   string  `json:"timestamp"`
+	EventTime   int64   `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
+	EventType   string  `json:"event_type"`
+	SrcIP       string  `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Source IP address"`
+	DestIP      string  `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Destination IP address"`
+	SrcPort     *int    `json:"src_port,omitempty" parquet:"name=src_port, type=INT32, repetitiontype=OPTIONAL" desc:"Source port"`
+	DestPort    *int    `json:"dest_port,omitempty" parquet:"name=dest_port, type=INT32, repetitiontype=OPTIONAL" desc:"Destination port"`
+	Proto       string  `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Transport protocol, e.g. TCP, UDP or ICMP"`
+	AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol Suricata detected on the flow"`
+	FlowID      int64   `json:"flow_id" parquet:"name=flow_id, type=INT64" desc:"Suricata flow ID, shared by every event of the same flow"`
+	InIface     *string `json:"in_iface,omitempty" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Interface the packets were captured on"`
+	Vlan        []int   `json:"vlan,omitempty" parquet:"name=vlan, type=MAP, convertedtype=LIST, valuetype=INT32" desc:"VLAN IDs the packets are tagged with, outermost first"`
+	TxID        *int    `json:"tx_id,omitempty" parquet:"name=tx_id, type=INT32, repetitiontype=OPTIONAL" desc:"ID of the application layer transaction within the flow"`
+	ICMPType    int     `json:"icmp_type"`
+	ICMPCode    int     `json:"icmp_code"`
+	CommunityID string  `json:"community_id" parquet:"name=community_id, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Community ID flow hash, for correlating with other tools"`
+	Host        string  `json:"host"`
 
 	DNS *struct {
-		Version int    `json:"version" parquet:"name=version, type=INT32"`
-		Type    string `json:"type" parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8"`
-		ID      int    `json:"id" parquet:"name=id, type=INT32"`
-		Flags   string `json:"flags" parquet:"name=flags, type=BYTE_ARRAY, convertedtype=UTF8"`
-		QR      bool   `json:"qr" parquet:"name=qr, type=BOOLEAN"`
-		RD      bool   `json:"rd" parquet:"name=rd, type=BOOLEAN"`
-		RA      bool   `json:"ra" parquet:"name=ra, type=BOOLEAN"`
-		RRName  string `json:"rrname" parquet:"name=rrname, type=BYTE_ARRAY, convertedtype=UTF8"`
-		RRType  string `json:"rrtype" parquet:"name=rrtype, type=BYTE_ARRAY, convertedtype=UTF8"`
-		RCode   string `json:"rcode" parquet:"name=rcode, type=BYTE_ARRAY, convertedtype=UTF8"`
+		Version int     `json:"version" parquet:"name=version, type=INT32" desc:"Version of the Suricata DNS log format"`
+		Type    string  `json:"type" parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Whether the record is a query or an answer"`
+		ID      int     `json:"id" parquet:"name=id, type=INT32" desc:"DNS transaction ID"`
+		Flags   *string `json:"flags,omitempty" parquet:"name=flags, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"DNS header flags as hex"`
+		QR      bool    `json:"qr" parquet:"name=qr, type=BOOLEAN" desc:"Whether the message is a response"`
+		RD      bool    `json:"rd" parquet:"name=rd, type=BOOLEAN" desc:"Whether recursion was desired"`
+		RA      bool    `json:"ra" parquet:"name=ra, type=BOOLEAN" desc:"Whether recursion was available"`
+		RRName  string  `json:"rrname" parquet:"name=rrname, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Name being queried"`
+		RRType  string  `json:"rrtype" parquet:"name=rrtype, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Record type being queried, e.g. A, AAAA or MX"`
+		RCode   *string `json:"rcode,omitempty" parquet:"name=rcode, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Response code, e.g. NOERROR or NXDOMAIN"`
 		Answers []struct {
-			RRName string `json:"rrname" parquet:"name=rrname, type=BYTE_ARRAY, convertedtype=UTF8"`
-			RRType string `json:"rrtype" parquet:"name=rrtype, type=BYTE_ARRAY, convertedtype=UTF8"`
-			TTL    int    `json:"ttl" parquet:"name=ttl, type=INT32"`
-			RData  string `json:"rdata" parquet:"name=rdata, type=BYTE_ARRAY, convertedtype=UTF8"`
-		} `json:"answers" parquet:"name=answers"`
-	} `json:"dns" parquet:"name=dns"`
+			RRName string  `json:"rrname" parquet:"name=rrname, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Name of the answer record"`
+			RRType string  `json:"rrtype" parquet:"name=rrtype, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Type of the answer record"`
+			TTL    int     `json:"ttl" parquet:"name=ttl, type=INT32" desc:"TTL of the answer record in seconds"`
+			RData  *string `json:"rdata,omitempty" parquet:"name=rdata, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Data of the answer record"`
+		} `json:"answers" parquet:"name=answers" desc:"Resource records of the answer"`
+	} `json:"dns,omitempty" parquet:"name=dns, repetitiontype=OPTIONAL" desc:"DNS query or answer details"`
 
 	GeoIPData struct {
-		Source GeoIPData `json:"source" parquet:"name=source"`
-		Dest   GeoIPData `json:"dest" parquet:"name=dest"`
-	} `json:"geoip_data" parquet:"name=geoip_data"`
+		Source GeoIPData `json:"source" parquet:"name=source" desc:"GeoIP location of the source address"`
+		Dest   GeoIPData `json:"dest" parquet:"name=dest" desc:"GeoIP location of the destination address"`
+	} `json:"geoip_data" parquet:"name=geoip_data" desc:"GeoIP enrichment of the source and destination addresses"`
+
+	DomainData DomainData `json:"domain_data" parquet:"name=domain_data" desc:"Breakdown of the queried domain name"`
+
+	ThreatIntelMatches []ThreatIntelMatch `json:"ti_matches" parquet:"name=ti_matches, type=LIST" desc:"Threat intel indicators the event matched"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
 }
 
 func (e *DNSEvent) UpdateGeoIP(reader *geoip2.Reader) error {
@@ -62,14 +72,76 @@ func (e *DNSEvent) UpdateGeoIP(reader *geoip2.Reader) error {
 	return nil
 }
 
+func (e *DNSEvent) UpdateDomainData(psl *PublicSuffixList) error {
+	if e.DNS == nil {
+		return nil
+	}
+	e.DomainData = psl.GetDomainData(e.DNS.RRName)
+	return nil
+}
+
+func (e *DNSEvent) UpdateThreatIntel(db *ThreatIntelDB) error {
+	e.ThreatIntelMatches = []ThreatIntelMatch{}
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("src_ip", e.SrcIP)...)
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("dest_ip", e.DestIP)...)
+	if e.DNS != nil {
+		e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchDomain("dns.rrname", e.DNS.RRName)...)
+	}
+	return nil
+}
+
+// UpdateCommunityID computes the Community ID of the flow, unless Suricata already included one in the event
+func (e *DNSEvent) UpdateCommunityID(seed uint16) error {
+	if e.CommunityID != "" {
+		return nil
+	}
+	srcPort, destPort := communityIDPorts(e.Proto, e.SrcPort, e.DestPort, e.ICMPType, e.ICMPCode)
+	communityID, err := CommunityID(seed, e.SrcIP, e.DestIP, srcPort, destPort, e.Proto)
+	if err != nil {
+		return err
+	}
+	e.CommunityID = communityID
+	return nil
+}
+
+func (e *DNSEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
+}
+
 func (e DNSEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:    e.Timestamp[:10],
+		Hour:    hour,
+		Minute:  minute,
+		InIface: stringValue(e.InIface),
+		Vlan:    outerVlan(e.Vlan),
 	}
 }
 
+func (e DNSEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// dnsEventSchemaChangelog records the columns added in each version of the dns schema, the last entry being the current version
+var dnsEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+	{
+		Version:     2,
+		Description: "src_port, dest_port, tx_id, app_proto, in_iface, dns, dns.rcode, dns.flags and the rdata of dns answers are NULL when absent from the EVE record, rather than 0 or an empty string. app_proto is only logged once a protocol is detected, in_iface only for live captures, flags only for answers and rdata not for every record type. The version, type, id, rrname and rrtype of dns stay REQUIRED as Suricata logs them for every query and answer, and the qr, rd and ra flags are only logged when set, so false when absent. vlan is the list of VLAN IDs Suricata logs, outermost first and empty for untagged traffic, rather than an int which no tagged event could be decoded into. Files written before have to be migrated, as Athena can't read their int vlan as an array",
+	},
+}
+
+func (e DNSEvent) SchemaVersion() int {
+	return 2
+}
+
+func (e DNSEvent) SchemaChangelog() []SchemaRevision {
+	return dnsEventSchemaChangelog
+}
+
 func (e *DNSEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
@@ -0,0 +1,153 @@
+package suricata
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	suffixRuleNormal = iota
+	suffixRuleWildcard
+	suffixRuleException
+)
+
+var (
+	//go:embed public_suffix_list.dat
+	defaultPublicSuffixListData string
+
+	defaultPublicSuffixList     *PublicSuffixList
+	defaultPublicSuffixListOnce sync.Once
+)
+
+type DomainModel interface {
+	UpdateDomainData(psl *PublicSuffixList) error
+}
+
+type DomainData struct {
+	RegisteredDomain string  `json:"registered_domain" parquet:"name=registered_domain, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Domain registered under the public suffix, e.g. example.co.uk"`
+	PublicSuffix     string  `json:"public_suffix" parquet:"name=public_suffix, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Public suffix of the domain, e.g. co.uk"`
+	Subdomain        string  `json:"subdomain" parquet:"name=subdomain, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Labels in front of the registered domain"`
+	LabelCount       int     `json:"label_count" parquet:"name=label_count, type=INT32" desc:"Number of labels in the domain"`
+	Entropy          float64 `json:"entropy" parquet:"name=entropy, type=DOUBLE" desc:"Shannon entropy of the domain, high for generated domains"`
+}
+
+// PublicSuffixList implements the matching algorithm from https://publicsuffix.org/list/ over a parsed list of rules
+type PublicSuffixList struct {
+	rules map[string]int
+}
+
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	psl := &PublicSuffixList{
+		rules: map[string]int{},
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// rules end at the first whitespace
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			psl.rules[rule[1:]] = suffixRuleException
+		case strings.HasPrefix(rule, "*."):
+			psl.rules[rule[2:]] = suffixRuleWildcard
+		default:
+			// a wildcard rule implies the normal rule for its parent, so don't overwrite it
+			if _, ok := psl.rules[rule]; !ok {
+				psl.rules[rule] = suffixRuleNormal
+			}
+		}
+	}
+	return psl, scanner.Err()
+}
+
+func LoadPublicSuffixList(path string) (*PublicSuffixList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePublicSuffixList(f)
+}
+
+// DefaultPublicSuffixList returns the list compiled into the binary
+func DefaultPublicSuffixList() *PublicSuffixList {
+	defaultPublicSuffixListOnce.Do(func() {
+		defaultPublicSuffixList, _ = ParsePublicSuffixList(strings.NewReader(defaultPublicSuffixListData))
+	})
+	return defaultPublicSuffixList
+}
+
+// PublicSuffix returns the public suffix of an already normalized domain. Domains matching no rule use the implicit "*" rule, so their suffix is the last label.
+func (psl *PublicSuffixList) PublicSuffix(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if ruleType, ok := psl.rules[candidate]; ok {
+			if ruleType == suffixRuleException {
+				return strings.Join(labels[i+1:], ".")
+			}
+			return candidate
+		}
+		// a wildcard rule on the parent makes this label part of the suffix
+		if i+1 < len(labels) {
+			if ruleType, ok := psl.rules[strings.Join(labels[i+1:], ".")]; ok && ruleType == suffixRuleWildcard {
+				return candidate
+			}
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+func (psl *PublicSuffixList) GetDomainData(domain string) DomainData {
+	domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || net.ParseIP(domain) != nil {
+		return DomainData{}
+	}
+
+	d := DomainData{
+		LabelCount: strings.Count(domain, ".") + 1,
+	}
+	d.PublicSuffix = psl.PublicSuffix(domain)
+	if d.PublicSuffix == domain {
+		return d
+	}
+
+	prefix := strings.TrimSuffix(domain, "."+d.PublicSuffix)
+	registeredLabel := prefix
+	if dot := strings.LastIndex(prefix, "."); dot >= 0 {
+		d.Subdomain = prefix[:dot]
+		registeredLabel = prefix[dot+1:]
+	}
+	d.RegisteredDomain = registeredLabel + "." + d.PublicSuffix
+	d.Entropy = ShannonEntropy(registeredLabel)
+
+	return d
+}
+
+// ShannonEntropy returns the entropy of s in bits per character
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,109 @@
+package suricata
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const testPublicSuffixList = `// comments and blank lines are skipped
+
+com
+uk
+co.uk
+*.ck
+!www.ck
+github.io extra text after whitespace is ignored
+`
+
+func TestPublicSuffix(t *testing.T) {
+	psl, err := ParsePublicSuffixList(strings.NewReader(testPublicSuffixList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{domain: "example.com", expected: "com"},
+		{domain: "www.example.co.uk", expected: "co.uk"},
+		{domain: "example.uk", expected: "uk"},
+		{domain: "a.b.ck", expected: "b.ck"},
+		{domain: "www.ck", expected: "ck"},
+		{domain: "user.github.io", expected: "github.io"},
+		{domain: "host.unlisted", expected: "unlisted"},
+		{domain: "com", expected: "com"},
+	}
+	for _, test := range tests {
+		t.Run(test.domain, func(t *testing.T) {
+			if suffix := psl.PublicSuffix(test.domain); suffix != test.expected {
+				t.Errorf("public suffix is %s, expected %s", suffix, test.expected)
+			}
+		})
+	}
+}
+
+func TestGetDomainData(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		expected DomainData
+	}{
+		{name: "empty", domain: "", expected: DomainData{}},
+		{name: "ip address", domain: "192.0.2.1", expected: DomainData{}},
+		{name: "suffix only", domain: "co.uk", expected: DomainData{PublicSuffix: "co.uk", LabelCount: 2}},
+		{
+			name:     "registered domain",
+			domain:   "example.com",
+			expected: DomainData{RegisteredDomain: "example.com", PublicSuffix: "com", LabelCount: 2, Entropy: ShannonEntropy("example")},
+		},
+		{
+			name:     "normalized",
+			domain:   " WWW.Example.CO.UK. ",
+			expected: DomainData{RegisteredDomain: "example.co.uk", PublicSuffix: "co.uk", Subdomain: "www", LabelCount: 4, Entropy: ShannonEntropy("example")},
+		},
+		{
+			name:     "nested subdomain",
+			domain:   "a.b.example.github.io",
+			expected: DomainData{RegisteredDomain: "example.github.io", PublicSuffix: "github.io", Subdomain: "a.b", LabelCount: 5, Entropy: ShannonEntropy("example")},
+		},
+		{
+			name:     "wildcard exception",
+			domain:   "www.ck",
+			expected: DomainData{RegisteredDomain: "www.ck", PublicSuffix: "ck", LabelCount: 2, Entropy: ShannonEntropy("www")},
+		},
+	}
+	psl := DefaultPublicSuffixList()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := psl.GetDomainData(test.domain)
+			// entropy is summed in map order, so it can differ in the last bit
+			if math.Abs(d.Entropy-test.expected.Entropy) > 1e-9 {
+				t.Errorf("entropy is %f, expected %f", d.Entropy, test.expected.Entropy)
+			}
+			d.Entropy = test.expected.Entropy
+			if d != test.expected {
+				t.Errorf("domain data is %+v, expected %+v", d, test.expected)
+			}
+		})
+	}
+}
+
+func TestShannonEntropy(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected float64
+	}{
+		{s: "", expected: 0},
+		{s: "aaaa", expected: 0},
+		{s: "ab", expected: 1},
+		{s: "abcd", expected: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			if entropy := ShannonEntropy(test.s); math.Abs(entropy-test.expected) > 1e-9 {
+				t.Errorf("entropy is %f, expected %f", entropy, test.expected)
+			}
+		})
+	}
+}
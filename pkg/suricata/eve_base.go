@@ -3,3 +3,27 @@ package suricata
 type EveBase struct {
 	EventType string `json:"event_type"`
 }
+
+// intValue returns the value of an optional field, or 0 if it was absent from the event
+func intValue(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// stringValue returns the value of an optional field, or "" if it was absent from the event
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// outerVlan returns the outermost VLAN ID events are partitioned by, or 0 for untagged traffic
+func outerVlan(vlans []int) int {
+	if len(vlans) == 0 {
+		return 0
+	}
+	return vlans[0]
+}
@@ -0,0 +1,83 @@
+package suricata
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sheacloud/surithena/internal/storage"
+)
+
+// taggedFlowEvent is a flow record as Suricata logs it for traffic captured on a trunk port
+const taggedFlowEvent = `{"timestamp":"2024-01-02T03:04:05.123456+0000","flow_id":1234,"in_iface":"eth1","event_type":"flow","vlan":[100],"src_ip":"10.0.0.1","src_port":51234,"dest_ip":"10.0.0.2","dest_port":53,"proto":"UDP","app_proto":"dns","flow":{"pkts_toserver":1,"pkts_toclient":1,"bytes_toserver":74,"bytes_toclient":90,"start":"2024-01-02T03:04:00.000000+0000","end":"2024-01-02T03:04:01.000000+0000","age":1,"state":"established","reason":"timeout","alerted":false}}`
+
+func TestVlanDecoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		vlans []int
+		outer int
+	}{
+		{name: "untagged", input: strings.Replace(taggedFlowEvent, `"vlan":[100],`, "", 1), outer: 0},
+		{name: "tagged", input: taggedFlowEvent, vlans: []int{100}, outer: 100},
+		{name: "QinQ", input: strings.Replace(taggedFlowEvent, `"vlan":[100]`, `"vlan":[100,200]`, 1), vlans: []int{100, 200}, outer: 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := &FlowEvent{}
+			err := json.Unmarshal([]byte(test.input), event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(event.Vlan, test.vlans) {
+				t.Errorf("vlan is decoded as %v, expected %v", event.Vlan, test.vlans)
+			}
+			if key := event.GetDateHourKey(); key.Vlan != test.outer {
+				t.Errorf("partitioned on vlan %d, expected %d", key.Vlan, test.outer)
+			}
+
+			// the tags are written to the vlan column as a list
+			store := storage.NewLocalObjectStore(t.TempDir())
+			file, err := store.Create("flow.parquet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoder, err := storage.ParquetFormat{Options: storage.DefaultParquetOptions()}.NewEncoder(file, &FlowEvent{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = encoder.Write(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = encoder.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			reader, err := storage.OpenParquetFile(store, "flow.parquet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			records, err := reader.Read(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("read %d records, expected 1", len(records))
+			}
+			written := []int{}
+			for _, value := range records[0].Lookup("vlan") {
+				if vlan, ok := value.(int32); ok {
+					written = append(written, int(vlan))
+				}
+			}
+			if expected := append([]int{}, test.vlans...); !reflect.DeepEqual(written, expected) {
+				t.Errorf("vlan is written as %v, expected %v", written, expected)
+			}
+		})
+	}
+}
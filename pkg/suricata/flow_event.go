@@ -9,52 +9,60 @@ import (
 )
 
 type FlowEvent struct {
-	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
-	EventType string `json:"event_type"`
-	SrcIP     string `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DestIP    string `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	SrcPort   int    `json:"src_port" parquet:"name=src_port, type=INT32"`
-	DestPort  int    `json:"dest_port" parquet:"name=dest_port, type=INT32"`
-	Proto     string `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	AppProto  string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	FlowID    int64  `json:"flow_id" parquet:"name=flow_id, type=INT64"`
-	InIface   string `json:"in_iface" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Vlan      int    `json:"vlan" parquet:"name=vlan, type=INT32"`
-	TxID      int    `json:"tx_id" parquet:"name=tx_id, type=INT32"`
+	Timestamp   string  `json:"timestamp"`
+	EventTime   int64   `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
+	EventType   string  `json:"event_type"`
+	SrcIP       string  `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Source IP address"`
+	DestIP      string  `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Destination IP address"`
+	SrcPort     *int    `json:"src_port,omitempty" parquet:"name=src_port, type=INT32, repetitiontype=OPTIONAL" desc:"Source port"`
+	DestPort    *int    `json:"dest_port,omitempty" parquet:"name=dest_port, type=INT32, repetitiontype=OPTIONAL" desc:"Destination port"`
+	Proto       string  `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Transport protocol, e.g. TCP, UDP or ICMP"`
+	AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol Suricata detected on the flow"`
+	FlowID      int64   `json:"flow_id" parquet:"name=flow_id, type=INT64" desc:"Suricata flow ID, shared by every event of the same flow"`
+	InIface     *string `json:"in_iface,omitempty" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Interface the packets were captured on"`
+	Vlan        []int   `json:"vlan,omitempty" parquet:"name=vlan, type=MAP, convertedtype=LIST, valuetype=INT32" desc:"VLAN IDs the packets are tagged with, outermost first"`
+	TxID        *int    `json:"tx_id,omitempty" parquet:"name=tx_id, type=INT32, repetitiontype=OPTIONAL" desc:"ID of the application layer transaction within the flow"`
+	ICMPType    int     `json:"icmp_type"`
+	ICMPCode    int     `json:"icmp_code"`
+	CommunityID string  `json:"community_id" parquet:"name=community_id, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Community ID flow hash, for correlating with other tools"`
+	Host        string  `json:"host"`
 
 	Flow struct {
-		PktsToServer  int64  `json:"pkts_toserver" parquet:"name=pkts_toserver, type=INT64"`
-		PktsToClient  int64  `json:"pkts_toclient" parquet:"name=pkts_toclient, type=INT64"`
-		BytesToServer int64  `json:"bytes_toserver" parquet:"name=bytes_toserver, type=INT64"`
-		BytesToClient int64  `json:"bytes_toclient" parquet:"name=bytes_toclient, type=INT64"`
-		Start         string `json:"start" parquet:"name=start, type=BYTE_ARRAY, convertedtype=UTF8"`
-		End           string `json:"end" parquet:"name=end, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Age           int    `json:"age" parquet:"name=age, type=INT32"`
-		State         string `json:"state" parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Reason        string `json:"reason" parquet:"name=reason, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Alerted       bool   `json:"alerted" parquet:"name=alerted, type=BOOLEAN"`
-	} `json:"flow" parquet:"name=flow"`
-
-	TCP struct {
-		TCPFlags   string `json:"tcp_flags" parquet:"name=tcp_flags, type=BYTE_ARRAY, convertedtype=UTF8"`
-		TCPFlagsTS string `json:"tcp_flags_ts" parquet:"name=tcp_flags_ts, type=BYTE_ARRAY, convertedtype=UTF8"`
-		TCPFlagsTC string `json:"tcp_flags_tc" parquet:"name=tcp_flags_tc, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Syn        bool   `json:"syn" parquet:"name=syn, type=BOOLEAN"`
-		Rst        bool   `json:"rst" parquet:"name=rst, type=BOOLEAN"`
-		Ack        bool   `json:"ack" parquet:"name=ack, type=BOOLEAN"`
-		Ecn        bool   `json:"ecn" parquet:"name=ecn, type=BOOLEAN"`
-		Cwr        bool   `json:"cwr" parquet:"name=cwr, type=BOOLEAN"`
-		Psh        bool   `json:"psh" parquet:"name=psh, type=BOOLEAN"`
-		Fin        bool   `json:"fin" parquet:"name=fin, type=BOOLEAN"`
-		Urg        bool   `json:"urg" parquet:"name=urg, type=BOOLEAN"`
-		State      string `json:"state" parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8"`
-	} `json:"tcp" parquet:"name=tcp"`
+		PktsToServer  int64  `json:"pkts_toserver" parquet:"name=pkts_toserver, type=INT64" desc:"Packets sent from the client to the server"`
+		PktsToClient  int64  `json:"pkts_toclient" parquet:"name=pkts_toclient, type=INT64" desc:"Packets sent from the server to the client"`
+		BytesToServer int64  `json:"bytes_toserver" parquet:"name=bytes_toserver, type=INT64" desc:"Bytes sent from the client to the server"`
+		BytesToClient int64  `json:"bytes_toclient" parquet:"name=bytes_toclient, type=INT64" desc:"Bytes sent from the server to the client"`
+		Start         string `json:"start" parquet:"name=start, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Time of the first packet of the flow"`
+		End           string `json:"end" parquet:"name=end, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Time of the last packet of the flow"`
+		Age           int    `json:"age" parquet:"name=age, type=INT32" desc:"Duration of the flow in seconds"`
+		State         string `json:"state" parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8" desc:"State of the flow when it was logged, e.g. new, established or closed"`
+		Reason        string `json:"reason" parquet:"name=reason, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Why the flow was logged, e.g. timeout or shutdown"`
+		Alerted       bool   `json:"alerted" parquet:"name=alerted, type=BOOLEAN" desc:"Whether any alert fired on the flow"`
+	} `json:"flow" parquet:"name=flow" desc:"Counters and state of the flow"`
+
+	TCP *struct {
+		TCPFlags   string  `json:"tcp_flags" parquet:"name=tcp_flags, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Hex of the TCP flags seen in either direction"`
+		TCPFlagsTS string  `json:"tcp_flags_ts" parquet:"name=tcp_flags_ts, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Hex of the TCP flags seen from the client to the server"`
+		TCPFlagsTC string  `json:"tcp_flags_tc" parquet:"name=tcp_flags_tc, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Hex of the TCP flags seen from the server to the client"`
+		Syn        bool    `json:"syn" parquet:"name=syn, type=BOOLEAN" desc:"Whether a SYN was seen"`
+		Rst        bool    `json:"rst" parquet:"name=rst, type=BOOLEAN" desc:"Whether a RST was seen"`
+		Ack        bool    `json:"ack" parquet:"name=ack, type=BOOLEAN" desc:"Whether an ACK was seen"`
+		Ecn        bool    `json:"ecn" parquet:"name=ecn, type=BOOLEAN" desc:"Whether an ECN-Echo was seen"`
+		Cwr        bool    `json:"cwr" parquet:"name=cwr, type=BOOLEAN" desc:"Whether a CWR was seen"`
+		Psh        bool    `json:"psh" parquet:"name=psh, type=BOOLEAN" desc:"Whether a PSH was seen"`
+		Fin        bool    `json:"fin" parquet:"name=fin, type=BOOLEAN" desc:"Whether a FIN was seen"`
+		Urg        bool    `json:"urg" parquet:"name=urg, type=BOOLEAN" desc:"Whether an URG was seen"`
+		State      *string `json:"state,omitempty" parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"TCP state of the session when it was logged"`
+	} `json:"tcp,omitempty" parquet:"name=tcp, repetitiontype=OPTIONAL" desc:"TCP flags and state of the flow"`
 
 	GeoIPData struct {
-		Source GeoIPData `json:"source" parquet:"name=source"`
-		Dest   GeoIPData `json:"dest" parquet:"name=dest"`
-	} `json:"geoip_data" parquet:"name=geoip_data"`
+		Source GeoIPData `json:"source" parquet:"name=source" desc:"GeoIP location of the source address"`
+		Dest   GeoIPData `json:"dest" parquet:"name=dest" desc:"GeoIP location of the destination address"`
+	} `json:"geoip_data" parquet:"name=geoip_data" desc:"GeoIP enrichment of the source and destination addresses"`
+
+	ThreatIntelMatches []ThreatIntelMatch `json:"ti_matches" parquet:"name=ti_matches, type=LIST" desc:"Threat intel indicators the event matched"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
 }
 
 func (e *FlowEvent) UpdateGeoIP(reader *geoip2.Reader) error {
@@ -71,14 +79,65 @@ func (e *FlowEvent) UpdateGeoIP(reader *geoip2.Reader) error {
 	return nil
 }
 
+func (e *FlowEvent) UpdateThreatIntel(db *ThreatIntelDB) error {
+	e.ThreatIntelMatches = []ThreatIntelMatch{}
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("src_ip", e.SrcIP)...)
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("dest_ip", e.DestIP)...)
+	return nil
+}
+
+// UpdateCommunityID computes the Community ID of the flow, unless Suricata already included one in the event
+func (e *FlowEvent) UpdateCommunityID(seed uint16) error {
+	if e.CommunityID != "" {
+		return nil
+	}
+	srcPort, destPort := communityIDPorts(e.Proto, e.SrcPort, e.DestPort, e.ICMPType, e.ICMPCode)
+	communityID, err := CommunityID(seed, e.SrcIP, e.DestIP, srcPort, destPort, e.Proto)
+	if err != nil {
+		return err
+	}
+	e.CommunityID = communityID
+	return nil
+}
+
+func (e *FlowEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
+}
+
 func (e FlowEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:    e.Timestamp[:10],
+		Hour:    hour,
+		Minute:  minute,
+		InIface: stringValue(e.InIface),
+		Vlan:    outerVlan(e.Vlan),
 	}
 }
 
+func (e FlowEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// flowEventSchemaChangelog records the columns added in each version of the flow schema, the last entry being the current version
+var flowEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+	{
+		Version:     2,
+		Description: "src_port, dest_port, tx_id, app_proto, in_iface, tcp and tcp.state are NULL when absent from the EVE record, rather than 0 or an empty string. app_proto is only logged once a protocol is detected, in_iface only for live captures and the tcp state only once the flow is tracked. flow_id and the counters, start, end, age, state, reason and alerted of flow stay REQUIRED as Suricata logs them for every flow, and the tcp flags are only logged when set, so false when absent. vlan is the list of VLAN IDs Suricata logs, outermost first and empty for untagged traffic, rather than an int which no tagged event could be decoded into. Files written before have to be migrated, as Athena can't read their int vlan as an array",
+	},
+}
+
+func (e FlowEvent) SchemaVersion() int {
+	return 2
+}
+
+func (e FlowEvent) SchemaChangelog() []SchemaRevision {
+	return flowEventSchemaChangelog
+}
+
 func (e *FlowEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
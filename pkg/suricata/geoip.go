@@ -12,22 +12,22 @@ type GeoIPModel interface {
 }
 
 type GeoIPData struct {
-	CityName               string  `json:"city_name" parquet:"name=city_name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	ContinentCode          string  `json:"continent_code" parquet:"name=continent_code, type=BYTE_ARRAY, convertedtype=UTF8"`
-	ContinentName          string  `json:"continent_name" parquet:"name=continent_name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	CountryIsoCode         string  `json:"country_iso_code" parquet:"name=country_iso_code, type=BYTE_ARRAY, convertedtype=UTF8"`
-	CountryName            string  `json:"country_name" parquet:"name=country_name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Latitude               float64 `json:"latitude" parquet:"name=latitude, type=DOUBLE"`
-	Longitude              float64 `json:"longitude" parquet:"name=longitude, type=DOUBLE"`
-	LocationAccuracyRadius int     `json:"location_accuracy_radius" parquet:"name=location_accuracy_radius, type=INT32"`
-	TimeZone               string  `json:"time_zone" parquet:"name=time_zone, type=BYTE_ARRAY, convertedtype=UTF8"`
-	PostalCode             string  `json:"postal_code" parquet:"name=postal_code, type=BYTE_ARRAY, convertedtype=UTF8"`
-	IsAnonymousProxy       bool    `json:"is_anonymous_proxy" parquet:"name=is_anonymous_proxy, type=BOOLEAN"`
-	IsSatelliteProvider    bool    `json:"is_satellite_provider" parquet:"name=is_satellite_provider, type=BOOLEAN"`
+	CityName               string  `json:"city_name" parquet:"name=city_name, type=BYTE_ARRAY, convertedtype=UTF8" desc:"City name"`
+	ContinentCode          string  `json:"continent_code" parquet:"name=continent_code, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Two letter continent code"`
+	ContinentName          string  `json:"continent_name" parquet:"name=continent_name, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Continent name"`
+	CountryIsoCode         string  `json:"country_iso_code" parquet:"name=country_iso_code, type=BYTE_ARRAY, convertedtype=UTF8" desc:"ISO 3166-1 country code"`
+	CountryName            string  `json:"country_name" parquet:"name=country_name, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Country name"`
+	Latitude               float64 `json:"latitude" parquet:"name=latitude, type=DOUBLE" desc:"Approximate latitude"`
+	Longitude              float64 `json:"longitude" parquet:"name=longitude, type=DOUBLE" desc:"Approximate longitude"`
+	LocationAccuracyRadius int     `json:"location_accuracy_radius" parquet:"name=location_accuracy_radius, type=INT32" desc:"Radius in kilometers the location is accurate to"`
+	TimeZone               string  `json:"time_zone" parquet:"name=time_zone, type=BYTE_ARRAY, convertedtype=UTF8" desc:"IANA time zone of the location"`
+	PostalCode             string  `json:"postal_code" parquet:"name=postal_code, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Postal code"`
+	IsAnonymousProxy       bool    `json:"is_anonymous_proxy" parquet:"name=is_anonymous_proxy, type=BOOLEAN" desc:"Whether the address belongs to an anonymous proxy"`
+	IsSatelliteProvider    bool    `json:"is_satellite_provider" parquet:"name=is_satellite_provider, type=BOOLEAN" desc:"Whether the address belongs to a satellite provider"`
 	Subdivisions           []struct {
-		IsoCode string `json:"iso_code" parquet:"name=iso_code, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Name    string `json:"name" parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	} `json:"subdivisions" parquet:"name=subdivisions, type=LIST"`
+		IsoCode string `json:"iso_code" parquet:"name=iso_code, type=BYTE_ARRAY, convertedtype=UTF8" desc:"ISO 3166-2 subdivision code"`
+		Name    string `json:"name" parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Subdivision name"`
+	} `json:"subdivisions" parquet:"name=subdivisions, type=LIST" desc:"Subdivisions such as states or provinces, largest first"`
 }
 
 func GetGeoIPData(reader *geoip2.Reader, ipString string) (*GeoIPData, error) {
@@ -55,8 +55,8 @@ func GetGeoIPData(reader *geoip2.Reader, ipString string) (*GeoIPData, error) {
 	g.IsAnonymousProxy = city.Traits.IsAnonymousProxy
 	g.IsSatelliteProvider = city.Traits.IsSatelliteProvider
 	g.Subdivisions = make([]struct {
-		IsoCode string `json:"iso_code" parquet:"name=iso_code, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Name    string `json:"name" parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+		IsoCode string `json:"iso_code" parquet:"name=iso_code, type=BYTE_ARRAY, convertedtype=UTF8" desc:"ISO 3166-2 subdivision code"`
+		Name    string `json:"name" parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Subdivision name"`
 	}, len(city.Subdivisions))
 	for i, s := range city.Subdivisions {
 		g.Subdivisions[i].IsoCode = s.IsoCode
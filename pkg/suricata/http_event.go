@@ -1,7 +1,9 @@
 package suricata
 
 import (
+	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/oschwald/geoip2-golang"
@@ -9,37 +11,49 @@ import (
 )
 
 type HTTPEvent struct {
-	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
-	EventType string `json:"event_type"`
-	SrcIP     string `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DestIP    string `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	SrcPort   int    `json:"src_port" parquet:"name=src_port, type=INT32"`
-	DestPort  int    `json:"dest_port" parquet:"name=dest_port, type=INT32"`
-	Proto     string `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	AppProto  string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	FlowID    int64  `json:"flow_id" parquet:"name=flow_id, type=INT64"`
-	InIface   string `json:"in_iface" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Vlan      int    `json:"vlan" parquet:"name=vlan, type=INT32"`
-	TxID      int    `json:"tx_id" parquet:"name=tx_id, type=INT32"`
+	Timestamp   string  `json:"timestamp"`
+	EventTime   int64   `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
+	EventType   string  `json:"event_type"`
+	SrcIP       string  `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Source IP address"`
+	DestIP      string  `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Destination IP address"`
+	SrcPort     *int    `json:"src_port,omitempty" parquet:"name=src_port, type=INT32, repetitiontype=OPTIONAL" desc:"Source port"`
+	DestPort    *int    `json:"dest_port,omitempty" parquet:"name=dest_port, type=INT32, repetitiontype=OPTIONAL" desc:"Destination port"`
+	Proto       string  `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Transport protocol, e.g. TCP, UDP or ICMP"`
+	AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol Suricata detected on the flow"`
+	FlowID      int64   `json:"flow_id" parquet:"name=flow_id, type=INT64" desc:"Suricata flow ID, shared by every event of the same flow"`
+	InIface     *string `json:"in_iface,omitempty" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Interface the packets were captured on"`
+	Vlan        []int   `json:"vlan,omitempty" parquet:"name=vlan, type=MAP, convertedtype=LIST, valuetype=INT32" desc:"VLAN IDs the packets are tagged with, outermost first"`
+	TxID        *int    `json:"tx_id,omitempty" parquet:"name=tx_id, type=INT32, repetitiontype=OPTIONAL" desc:"ID of the application layer transaction within the flow"`
+	ICMPType    int     `json:"icmp_type"`
+	ICMPCode    int     `json:"icmp_code"`
+	CommunityID string  `json:"community_id" parquet:"name=community_id, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Community ID flow hash, for correlating with other tools"`
+	Host        string  `json:"host"`
 
 	HTTP struct {
-		HTTPPort        int    `json:"http_port" parquet:"name=http_port, type=INT32"`
-		Hostname        string `json:"hostname" parquet:"name=hostname, type=BYTE_ARRAY, convertedtype=UTF8"`
-		URL             string `json:"url" parquet:"name=url, type=BYTE_ARRAY, convertedtype=UTF8"`
-		HTTPUserAgent   string `json:"http_user_agent" parquet:"name=http_user_agent, type=BYTE_ARRAY, convertedtype=UTF8"`
-		HTTPContentType string `json:"http_content_type" parquet:"name=http_content_type, type=BYTE_ARRAY, convertedtype=UTF8"`
-		HTTPRefer       string `json:"http_refer" parquet:"name=http_refer, type=BYTE_ARRAY, convertedtype=UTF8"`
-		HTTPMethod      string `json:"http_method" parquet:"name=http_method, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Protocol        string `json:"protocol" parquet:"name=protocol, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Status          int    `json:"status" parquet:"name=status, type=INT32"`
-		Length          int    `json:"length" parquet:"name=length, type=INT32"`
-	} `json:"http" parquet:"name=http"`
+		HTTPPort        *int    `json:"http_port,omitempty" parquet:"name=http_port, type=INT32, repetitiontype=OPTIONAL" desc:"Port of the HTTP server"`
+		Hostname        *string `json:"hostname,omitempty" parquet:"name=hostname, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Host header of the request"`
+		URL             *string `json:"url,omitempty" parquet:"name=url, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"URL of the request"`
+		HTTPUserAgent   *string `json:"http_user_agent,omitempty" parquet:"name=http_user_agent, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"User-Agent header of the request"`
+		HTTPContentType *string `json:"http_content_type,omitempty" parquet:"name=http_content_type, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Content-Type header of the response"`
+		HTTPRefer       *string `json:"http_refer,omitempty" parquet:"name=http_refer, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Referer header of the request"`
+		HTTPMethod      *string `json:"http_method,omitempty" parquet:"name=http_method, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Request method, e.g. GET or POST"`
+		Protocol        *string `json:"protocol,omitempty" parquet:"name=protocol, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"HTTP version, e.g. HTTP/1.1"`
+		Status          *int    `json:"status,omitempty" parquet:"name=status, type=INT32, repetitiontype=OPTIONAL" desc:"Response status code"`
+		Length          *int    `json:"length,omitempty" parquet:"name=length, type=INT32, repetitiontype=OPTIONAL" desc:"Length of the response body in bytes"`
+	} `json:"http" parquet:"name=http" desc:"HTTP transaction details"`
 
 	GeoIPData struct {
-		Source GeoIPData `json:"source" parquet:"name=source"`
-		Dest   GeoIPData `json:"dest" parquet:"name=dest"`
-	} `json:"geoip_data" parquet:"name=geoip_data"`
+		Source GeoIPData `json:"source" parquet:"name=source" desc:"GeoIP location of the source address"`
+		Dest   GeoIPData `json:"dest" parquet:"name=dest" desc:"GeoIP location of the destination address"`
+	} `json:"geoip_data" parquet:"name=geoip_data" desc:"GeoIP enrichment of the source and destination addresses"`
+
+	DomainData    DomainData    `json:"domain_data" parquet:"name=domain_data" desc:"Breakdown of the queried domain name"`
+	URLData       URLData       `json:"url_data" parquet:"name=url_data" desc:"Breakdown of the request URL"`
+	UserAgentData UserAgentData `json:"user_agent_data" parquet:"name=user_agent_data" desc:"Classification of the User-Agent header"`
+
+	ThreatIntelMatches []ThreatIntelMatch `json:"ti_matches" parquet:"name=ti_matches, type=LIST" desc:"Threat intel indicators the event matched"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
 }
 
 func (e *HTTPEvent) UpdateGeoIP(reader *geoip2.Reader) error {
@@ -56,14 +70,91 @@ func (e *HTTPEvent) UpdateGeoIP(reader *geoip2.Reader) error {
 	return nil
 }
 
+func (e *HTTPEvent) UpdateDomainData(psl *PublicSuffixList) error {
+	if e.HTTP.Hostname == nil {
+		return nil
+	}
+	e.DomainData = psl.GetDomainData(*e.HTTP.Hostname)
+	return nil
+}
+
+func (e *HTTPEvent) UpdateThreatIntel(db *ThreatIntelDB) error {
+	e.ThreatIntelMatches = []ThreatIntelMatch{}
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("src_ip", e.SrcIP)...)
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("dest_ip", e.DestIP)...)
+	if e.HTTP.Hostname != nil {
+		e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchDomain("http.hostname", *e.HTTP.Hostname)...)
+	}
+	if e.HTTP.Hostname != nil && e.HTTP.URL != nil {
+		e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchURL("http.url", e.requestURL())...)
+	}
+	return nil
+}
+
+// requestURL returns the URL the request was for, including the port of the Host header, or the URL itself for requests to proxies which send absolute URLs
+func (e *HTTPEvent) requestURL() string {
+	if strings.Contains(*e.HTTP.URL, "://") {
+		return *e.HTTP.URL
+	}
+	host := *e.HTTP.Hostname
+	if e.HTTP.HTTPPort != nil {
+		host = net.JoinHostPort(host, strconv.Itoa(*e.HTTP.HTTPPort))
+	}
+	return "http://" + host + *e.HTTP.URL
+}
+
+// UpdateCommunityID computes the Community ID of the flow, unless Suricata already included one in the event
+func (e *HTTPEvent) UpdateCommunityID(seed uint16) error {
+	if e.CommunityID != "" {
+		return nil
+	}
+	srcPort, destPort := communityIDPorts(e.Proto, e.SrcPort, e.DestPort, e.ICMPType, e.ICMPCode)
+	communityID, err := CommunityID(seed, e.SrcIP, e.DestIP, srcPort, destPort, e.Proto)
+	if err != nil {
+		return err
+	}
+	e.CommunityID = communityID
+	return nil
+}
+
+func (e *HTTPEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
+}
+
 func (e HTTPEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:    e.Timestamp[:10],
+		Hour:    hour,
+		Minute:  minute,
+		InIface: stringValue(e.InIface),
+		Vlan:    outerVlan(e.Vlan),
 	}
 }
 
+func (e HTTPEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// httpEventSchemaChangelog records the columns added in each version of the http schema, the last entry being the current version
+var httpEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+	{
+		Version:     2,
+		Description: "src_port, dest_port, tx_id, app_proto, in_iface, the url, http_method and protocol of http and its optional request and response fields are NULL when absent from the EVE record, rather than 0 or an empty string. app_proto is only logged once a protocol is detected, in_iface only for live captures and the request line is missing when only a response was seen. src_ip, dest_ip and proto stay REQUIRED as Suricata logs them for every transaction. vlan is the list of VLAN IDs Suricata logs, outermost first and empty for untagged traffic, rather than an int which no tagged event could be decoded into. Files written before have to be migrated, as Athena can't read their int vlan as an array",
+	},
+}
+
+func (e HTTPEvent) SchemaVersion() int {
+	return 2
+}
+
+func (e HTTPEvent) SchemaChangelog() []SchemaRevision {
+	return httpEventSchemaChangelog
+}
+
 func (e *HTTPEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
@@ -72,3 +163,9 @@ func (e *HTTPEvent) UpdateFields() error {
 	e.EventTime = parsedTime.UTC().UnixMilli()
 	return nil
 }
+
+func (e *HTTPEvent) UpdateHTTPParsing() error {
+	e.URLData = GetURLData(stringValue(e.HTTP.URL))
+	e.UserAgentData = GetUserAgentData(stringValue(e.HTTP.HTTPUserAgent))
+	return nil
+}
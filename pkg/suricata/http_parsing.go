@@ -0,0 +1,185 @@
+package suricata
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type HTTPParsingModel interface {
+	UpdateHTTPParsing() error
+}
+
+type uaPattern struct {
+	family string
+	regex  *regexp.Regexp
+}
+
+var (
+	// clients that identify as a script or library rather than a browser, checked before any browser
+	scriptedClientPatterns = []uaPattern{
+		{"curl", regexp.MustCompile(`(?i)^curl/([\d.]+)?`)},
+		{"Wget", regexp.MustCompile(`(?i)^wget/([\d.]+)?`)},
+		{"python-requests", regexp.MustCompile(`(?i)python-requests/([\d.]+)?`)},
+		{"Python-urllib", regexp.MustCompile(`(?i)python-urllib/([\d.]+)?`)},
+		{"aiohttp", regexp.MustCompile(`(?i)aiohttp/([\d.]+)?`)},
+		{"Go-http-client", regexp.MustCompile(`(?i)go-http-client/([\d.]+)?`)},
+		{"libwww-perl", regexp.MustCompile(`(?i)libwww-perl/([\d.]+)?`)},
+		{"okhttp", regexp.MustCompile(`(?i)okhttp/([\d.]+)?`)},
+		{"Apache-HttpClient", regexp.MustCompile(`(?i)apache-httpclient/([\d.]+)?`)},
+		{"Java", regexp.MustCompile(`(?i)^java/([\d._]+)?`)},
+		{"PowerShell", regexp.MustCompile(`(?i)powershell/([\d.]+)?`)},
+		{"axios", regexp.MustCompile(`(?i)axios/([\d.]+)?`)},
+		{"node-fetch", regexp.MustCompile(`(?i)node-fetch/([\d.]+)?`)},
+		{"HTTPie", regexp.MustCompile(`(?i)httpie/([\d.]+)?`)},
+		{"Ruby", regexp.MustCompile(`(?i)^ruby`)},
+	}
+
+	spiderPatterns = []uaPattern{
+		{"Googlebot", regexp.MustCompile(`(?i)googlebot/([\d.]+)?`)},
+		{"bingbot", regexp.MustCompile(`(?i)bingbot/([\d.]+)?`)},
+		{"Spider", regexp.MustCompile(`(?i)(bot|crawler|spider)\b`)},
+	}
+
+	// ordered so that browsers which include another browser's token (e.g. Edge includes Chrome and Safari) match first
+	browserPatterns = []uaPattern{
+		{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"IE", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+	}
+
+	osPatterns = []uaPattern{
+		{"Windows", regexp.MustCompile(`Windows`)},
+		{"iOS", regexp.MustCompile(`iPhone|iPad|iPod`)},
+		{"Android", regexp.MustCompile(`Android`)},
+		{"Chrome OS", regexp.MustCompile(`CrOS`)},
+		{"Mac OS X", regexp.MustCompile(`Mac OS X|Macintosh`)},
+		{"Linux", regexp.MustCompile(`Linux`)},
+	}
+)
+
+type URLData struct {
+	Path          string   `json:"path" parquet:"name=path, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Path of the URL"`
+	DecodedPath   string   `json:"decoded_path" parquet:"name=decoded_path, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Path with percent encoding decoded"`
+	Query         string   `json:"query" parquet:"name=query, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Query string of the URL"`
+	DecodedQuery  string   `json:"decoded_query" parquet:"name=decoded_query, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Query string with percent encoding decoded"`
+	QueryKeys     []string `json:"query_keys" parquet:"name=query_keys, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" desc:"Names of the query parameters"`
+	FileExtension string   `json:"file_extension" parquet:"name=file_extension, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Extension of the last path segment"`
+}
+
+type UserAgentData struct {
+	BrowserFamily  string `json:"browser_family" parquet:"name=browser_family, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Browser family, e.g. Chrome or Firefox"`
+	BrowserVersion string `json:"browser_version" parquet:"name=browser_version, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Browser version"`
+	OSFamily       string `json:"os_family" parquet:"name=os_family, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Operating system family"`
+	DeviceFamily   string `json:"device_family" parquet:"name=device_family, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Device family"`
+	IsScripted     bool   `json:"is_scripted" parquet:"name=is_scripted, type=BOOLEAN" desc:"Whether the client is a script or command line tool such as curl"`
+}
+
+// GetURLData splits a request target, as logged in the http.url field, into its components. Invalid percent-encoding is kept as-is in the decoded forms.
+func GetURLData(rawURL string) URLData {
+	d := URLData{
+		QueryKeys: []string{},
+	}
+	if rawURL == "" {
+		return d
+	}
+
+	d.Path = rawURL
+	if i := strings.IndexAny(rawURL, "?#"); i >= 0 {
+		d.Path = rawURL[:i]
+		if rawURL[i] == '?' {
+			d.Query = rawURL[i+1:]
+			if j := strings.Index(d.Query, "#"); j >= 0 {
+				d.Query = d.Query[:j]
+			}
+		}
+	}
+	// absolute-form targets, as sent to proxies, include the scheme and host
+	if parsed, err := url.Parse(d.Path); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+		d.Path = parsed.EscapedPath()
+	}
+
+	d.DecodedPath = d.Path
+	if decoded, err := url.PathUnescape(d.Path); err == nil {
+		d.DecodedPath = decoded
+	}
+	d.DecodedQuery = d.Query
+	if decoded, err := url.QueryUnescape(d.Query); err == nil {
+		d.DecodedQuery = decoded
+	}
+
+	// ParseQuery still returns the pairs it could parse alongside an error
+	values, _ := url.ParseQuery(d.Query)
+	for key := range values {
+		d.QueryKeys = append(d.QueryKeys, key)
+	}
+	sort.Strings(d.QueryKeys)
+
+	d.FileExtension = strings.ToLower(strings.TrimPrefix(path.Ext(d.DecodedPath), "."))
+
+	return d
+}
+
+func matchUserAgent(patterns []uaPattern, userAgent string) (string, string, bool) {
+	for _, pattern := range patterns {
+		match := pattern.regex.FindStringSubmatch(userAgent)
+		if match == nil {
+			continue
+		}
+		version := ""
+		if len(match) > 1 {
+			version = match[1]
+		}
+		return pattern.family, version, true
+	}
+	return "", "", false
+}
+
+func GetUserAgentData(userAgent string) UserAgentData {
+	d := UserAgentData{}
+	if userAgent == "" {
+		return d
+	}
+
+	if family, version, ok := matchUserAgent(scriptedClientPatterns, userAgent); ok {
+		d.BrowserFamily = family
+		d.BrowserVersion = version
+		d.DeviceFamily = "Other"
+		d.IsScripted = true
+	} else if family, version, ok := matchUserAgent(spiderPatterns, userAgent); ok {
+		d.BrowserFamily = family
+		d.BrowserVersion = version
+		d.DeviceFamily = "Spider"
+	} else if family, version, ok := matchUserAgent(browserPatterns, userAgent); ok {
+		d.BrowserFamily = family
+		d.BrowserVersion = version
+	} else {
+		d.BrowserFamily = "Other"
+	}
+
+	d.OSFamily, _, _ = matchUserAgent(osPatterns, userAgent)
+	if d.OSFamily == "" {
+		d.OSFamily = "Other"
+	}
+
+	if d.DeviceFamily == "" {
+		switch {
+		case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") || (d.OSFamily == "Android" && !strings.Contains(userAgent, "Mobile")):
+			d.DeviceFamily = "Tablet"
+		case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone"):
+			d.DeviceFamily = "Mobile"
+		case d.BrowserFamily != "Other":
+			d.DeviceFamily = "Desktop"
+		default:
+			d.DeviceFamily = "Other"
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,22 @@
+package suricata
+
+// SchemaRevision is an entry in the changelog of a model's schema
+type SchemaRevision struct {
+	Version     int
+	Description string
+	// Added lists the columns added in this version, named as schema check reports them, e.g. tls_ja4 or http.url_data.port
+	Added []string
+}
+
+// VersionedModel is implemented by event models, which bump their schema version and add a changelog entry whenever fields are added
+type VersionedModel interface {
+	SchemaVersion() int
+	SchemaChangelog() []SchemaRevision
+}
+
+var (
+	initialSchemaRevision = SchemaRevision{
+		Version:     1,
+		Description: "Initial versioned schema",
+	}
+)
@@ -0,0 +1,43 @@
+package suricata
+
+type SensorModel interface {
+	UpdateSensorData(identity *SensorIdentity) error
+}
+
+// SensorIdentity describes the sensor running eve-processor, and is shared by every event it processes
+type SensorIdentity struct {
+	Name     string
+	Hostname string
+	Site     string
+	Tags     []string
+	// Source is the socket or file events arrive on, left empty unless it should be recorded
+	Source string
+}
+
+type SensorData struct {
+	Name     string   `json:"name" parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Name the sensor is configured with"`
+	Hostname string   `json:"hostname" parquet:"name=hostname, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Hostname of the machine running eve-processor"`
+	Site     string   `json:"site" parquet:"name=site, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Site the sensor is deployed at"`
+	Tags     []string `json:"tags" parquet:"name=tags, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" desc:"Tags the sensor is configured with"`
+	EveHost  string   `json:"eve_host" parquet:"name=eve_host, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Host field Suricata wrote in the event"`
+	Source   string   `json:"source" parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8" desc:"EVE source the event was read from"`
+}
+
+// GetSensorData combines the local identity with the host field Suricata logs when sensor-name is set in suricata.yaml
+func GetSensorData(identity *SensorIdentity, eveHost string) SensorData {
+	d := SensorData{
+		Tags:    []string{},
+		EveHost: eveHost,
+	}
+	if identity == nil {
+		return d
+	}
+	d.Name = identity.Name
+	d.Hostname = identity.Hostname
+	d.Site = identity.Site
+	d.Source = identity.Source
+	if identity.Tags != nil {
+		d.Tags = identity.Tags
+	}
+	return d
+}
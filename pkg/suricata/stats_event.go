@@ -9,86 +9,113 @@ import (
 
 type StatsEvent struct {
 	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	EventTime int64  `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
 	EventType string `json:"event_type"`
+	Host      string `json:"host"`
 
 	Stats struct {
-		Uptime  int64 `json:"uptime" parquet:"name=uptime, type=INT64"`
+		Uptime  int64 `json:"uptime" parquet:"name=uptime, type=INT64" desc:"Seconds since Suricata started"`
 		Capture struct {
-			KernelPackets int64 `json:"kernel_packets" parquet:"name=kernel_packets, type=INT64"`
-			KernelDrops   int64 `json:"kernel_drops" parquet:"name=kernel_drops, type=INT64"`
-			Errors        int64 `json:"errors" parquet:"name=errors, type=INT64"`
-		} `json:"capture" parquet:"name=capture"`
+			KernelPackets int64 `json:"kernel_packets" parquet:"name=kernel_packets, type=INT64" desc:"Packets the kernel delivered to Suricata"`
+			KernelDrops   int64 `json:"kernel_drops" parquet:"name=kernel_drops, type=INT64" desc:"Packets the kernel dropped before Suricata read them"`
+			Errors        int64 `json:"errors" parquet:"name=errors, type=INT64" desc:"Capture errors"`
+		} `json:"capture" parquet:"name=capture" desc:"Packet capture counters"`
 		Decoder struct {
-			Pkts           int64 `json:"pkts" parquet:"name=pkts, type=INT64"`
-			Bytes          int64 `json:"bytes" parquet:"name=bytes, type=INT64"`
-			Invalid        int64 `json:"invalid" parquet:"name=invalid, type=INT64"`
-			IPv4           int64 `json:"ipv4" parquet:"name=ipv4, type=INT64"`
-			IPv6           int64 `json:"ipv6" parquet:"name=ipv6, type=INT64"`
-			Ethernet       int64 `json:"ethernet" parquet:"name=ethernet, type=INT64"`
-			Chdlc          int64 `json:"chdlc" parquet:"name=chdlc, type=INT64"`
-			Raw            int64 `json:"raw" parquet:"name=raw, type=INT64"`
-			Null           int64 `json:"null" parquet:"name=null, type=INT64"`
-			SLL            int64 `json:"sll" parquet:"name=sll, type=INT64"`
-			TCP            int64 `json:"tcp" parquet:"name=tcp, type=INT64"`
-			UDP            int64 `json:"udp" parquet:"name=udp, type=INT64"`
-			SCTP           int64 `json:"sctp" parquet:"name=sctp, type=INT64"`
-			ICMPv4         int64 `json:"icmpv4" parquet:"name=icmpv4, type=INT64"`
-			ICMPv6         int64 `json:"icmpv6" parquet:"name=icmpv6, type=INT64"`
-			PPP            int64 `json:"ppp" parquet:"name=ppp, type=INT64"`
-			PPPoE          int64 `json:"pppoe" parquet:"name=pppoe, type=INT64"`
-			Geneve         int64 `json:"geneve" parquet:"name=geneve, type=INT64"`
-			GRE            int64 `json:"gre" parquet:"name=gre, type=INT64"`
-			VLAN           int64 `json:"vlan" parquet:"name=vlan, type=INT64"`
-			VLANQinQ       int64 `json:"vlan_qinq" parquet:"name=vlan_qinq, type=INT64"`
-			VXLAN          int64 `json:"vxlan" parquet:"name=vxlan, type=INT64"`
-			VNTAG          int64 `json:"vntag" parquet:"name=vntag, type=INT64"`
-			IEEE8021ah     int64 `json:"ieee8021ah" parquet:"name=ieee8021ah, type=INT64"`
-			Teredo         int64 `json:"teredo" parquet:"name=teredo, type=INT64"`
-			IPv4InIPv6     int64 `json:"ipv4_in_ipv6" parquet:"name=ipv4_in_ipv6, type=INT64"`
-			IPv6InIPv6     int64 `json:"ipv6_in_ipv6" parquet:"name=ipv6_in_ipv6, type=INT64"`
-			MPLS           int64 `json:"mpls" parquet:"name=mpls, type=INT64"`
-			AvgPacketSize  int64 `json:"avg_packet_size" parquet:"name=avg_packet_size, type=INT64"`
-			MaxPacketSize  int64 `json:"max_packet_size" parquet:"name=max_packet_size, type=INT64"`
-			MaxMacAddrsSrc int64 `json:"max_mac_addrs_src" parquet:"name=max_mac_addrs_src, type=INT64"`
-			MaxMacAddrsDst int64 `json:"max_mac_addrs_dst" parquet:"name=max_mac_addrs_dst, type=INT64"`
-			ERSpan         int64 `json:"erspan" parquet:"name=erspan, type=INT64"`
-		} `json:"decoder" parquet:"name=decoder"`
+			Pkts           int64 `json:"pkts" parquet:"name=pkts, type=INT64" desc:"Packets decoded"`
+			Bytes          int64 `json:"bytes" parquet:"name=bytes, type=INT64" desc:"Bytes decoded"`
+			Invalid        int64 `json:"invalid" parquet:"name=invalid, type=INT64" desc:"Packets which failed to decode"`
+			IPv4           int64 `json:"ipv4" parquet:"name=ipv4, type=INT64" desc:"IPv4 packets decoded"`
+			IPv6           int64 `json:"ipv6" parquet:"name=ipv6, type=INT64" desc:"IPv6 packets decoded"`
+			Ethernet       int64 `json:"ethernet" parquet:"name=ethernet, type=INT64" desc:"Ethernet frames decoded"`
+			Chdlc          int64 `json:"chdlc" parquet:"name=chdlc, type=INT64" desc:"Cisco HDLC frames decoded"`
+			Raw            int64 `json:"raw" parquet:"name=raw, type=INT64" desc:"Raw IP packets decoded"`
+			Null           int64 `json:"null" parquet:"name=null, type=INT64" desc:"BSD loopback frames decoded"`
+			SLL            int64 `json:"sll" parquet:"name=sll, type=INT64" desc:"Linux cooked capture frames decoded"`
+			TCP            int64 `json:"tcp" parquet:"name=tcp, type=INT64" desc:"TCP segments decoded"`
+			UDP            int64 `json:"udp" parquet:"name=udp, type=INT64" desc:"UDP datagrams decoded"`
+			SCTP           int64 `json:"sctp" parquet:"name=sctp, type=INT64" desc:"SCTP packets decoded"`
+			ICMPv4         int64 `json:"icmpv4" parquet:"name=icmpv4, type=INT64" desc:"ICMPv4 packets decoded"`
+			ICMPv6         int64 `json:"icmpv6" parquet:"name=icmpv6, type=INT64" desc:"ICMPv6 packets decoded"`
+			PPP            int64 `json:"ppp" parquet:"name=ppp, type=INT64" desc:"PPP frames decoded"`
+			PPPoE          int64 `json:"pppoe" parquet:"name=pppoe, type=INT64" desc:"PPPoE frames decoded"`
+			Geneve         int64 `json:"geneve" parquet:"name=geneve, type=INT64" desc:"Geneve encapsulated packets decoded"`
+			GRE            int64 `json:"gre" parquet:"name=gre, type=INT64" desc:"GRE encapsulated packets decoded"`
+			VLAN           int64 `json:"vlan" parquet:"name=vlan, type=INT64" desc:"VLAN tagged frames decoded"`
+			VLANQinQ       int64 `json:"vlan_qinq" parquet:"name=vlan_qinq, type=INT64" desc:"QinQ double tagged frames decoded"`
+			VXLAN          int64 `json:"vxlan" parquet:"name=vxlan, type=INT64" desc:"VXLAN encapsulated packets decoded"`
+			VNTAG          int64 `json:"vntag" parquet:"name=vntag, type=INT64" desc:"VN-Tag frames decoded"`
+			IEEE8021ah     int64 `json:"ieee8021ah" parquet:"name=ieee8021ah, type=INT64" desc:"IEEE 802.1ah provider backbone bridge frames decoded"`
+			Teredo         int64 `json:"teredo" parquet:"name=teredo, type=INT64" desc:"Teredo tunneled packets decoded"`
+			IPv4InIPv6     int64 `json:"ipv4_in_ipv6" parquet:"name=ipv4_in_ipv6, type=INT64" desc:"IPv4 in IPv6 tunneled packets decoded"`
+			IPv6InIPv6     int64 `json:"ipv6_in_ipv6" parquet:"name=ipv6_in_ipv6, type=INT64" desc:"IPv6 in IPv6 tunneled packets decoded"`
+			MPLS           int64 `json:"mpls" parquet:"name=mpls, type=INT64" desc:"MPLS packets decoded"`
+			AvgPacketSize  int64 `json:"avg_packet_size" parquet:"name=avg_packet_size, type=INT64" desc:"Average packet size in bytes"`
+			MaxPacketSize  int64 `json:"max_packet_size" parquet:"name=max_packet_size, type=INT64" desc:"Largest packet size in bytes"`
+			MaxMacAddrsSrc int64 `json:"max_mac_addrs_src" parquet:"name=max_mac_addrs_src, type=INT64" desc:"Most source MAC addresses seen on a single flow"`
+			MaxMacAddrsDst int64 `json:"max_mac_addrs_dst" parquet:"name=max_mac_addrs_dst, type=INT64" desc:"Most destination MAC addresses seen on a single flow"`
+			ERSpan         int64 `json:"erspan" parquet:"name=erspan, type=INT64" desc:"ERSPAN encapsulated packets decoded"`
+		} `json:"decoder" parquet:"name=decoder" desc:"Packet decoder counters"`
 		Flow struct {
-			Memcap            int64 `json:"memcap" parquet:"name=memcap, type=INT64"`
-			TCP               int64 `json:"tcp" parquet:"name=tcp, type=INT64"`
-			UDP               int64 `json:"udp" parquet:"name=udp, type=INT64"`
-			ICMPv4            int64 `json:"icmpv4" parquet:"name=icmpv4, type=INT64"`
-			ICMPv6            int64 `json:"icmpv6" parquet:"name=icmpv6, type=INT64"`
-			TCPReuse          int64 `json:"tcp_reuse" parquet:"name=tcp_reuse, type=INT64"`
-			GetUsed           int64 `json:"get_used" parquet:"name=get_used, type=INT64"`
-			GetUsedEval       int64 `json:"get_used_eval" parquet:"name=get_used_eval, type=INT64"`
-			GetUsedEvalReject int64 `json:"get_used_eval_reject" parquet:"name=get_used_eval_reject, type=INT64"`
-			GetUsedEvalBusy   int64 `json:"get_used_eval_busy" parquet:"name=get_used_eval_busy, type=INT64"`
-			GetUsedFailed     int64 `json:"get_used_failed" parquet:"name=get_used_failed, type=INT64"`
-		} `json:"flow" parquet:"name=flow"`
+			Memcap            int64 `json:"memcap" parquet:"name=memcap, type=INT64" desc:"Flows which couldn't be created because flow.memcap was reached"`
+			TCP               int64 `json:"tcp" parquet:"name=tcp, type=INT64" desc:"TCP flows created"`
+			UDP               int64 `json:"udp" parquet:"name=udp, type=INT64" desc:"UDP flows created"`
+			ICMPv4            int64 `json:"icmpv4" parquet:"name=icmpv4, type=INT64" desc:"ICMPv4 flows created"`
+			ICMPv6            int64 `json:"icmpv6" parquet:"name=icmpv6, type=INT64" desc:"ICMPv6 flows created"`
+			TCPReuse          int64 `json:"tcp_reuse" parquet:"name=tcp_reuse, type=INT64" desc:"TCP flows reused for a new session on the same tuple"`
+			GetUsed           int64 `json:"get_used" parquet:"name=get_used, type=INT64" desc:"Flows taken from the hash when no spare flow was free"`
+			GetUsedEval       int64 `json:"get_used_eval" parquet:"name=get_used_eval, type=INT64" desc:"Flows evaluated as candidates for reuse"`
+			GetUsedEvalReject int64 `json:"get_used_eval_reject" parquet:"name=get_used_eval_reject, type=INT64" desc:"Reuse candidates rejected because they were still active"`
+			GetUsedEvalBusy   int64 `json:"get_used_eval_busy" parquet:"name=get_used_eval_busy, type=INT64" desc:"Reuse candidates skipped because another thread held them"`
+			GetUsedFailed     int64 `json:"get_used_failed" parquet:"name=get_used_failed, type=INT64" desc:"Times no flow could be reused, dropping the packet's flow"`
+		} `json:"flow" parquet:"name=flow" desc:"Flow engine counters"`
 		TCP struct {
-			Sessions        int64 `json:"sessions" parquet:"name=sessions, type=INT64"`
-			SSNMemcapDrop   int64 `json:"ssn_memcap_drop" parquet:"name=ssn_memcap_drop, type=INT64"`
-			Pseudo          int64 `json:"pseudo" parquet:"name=pseudo, type=INT64"`
-			PseudoFailed    int64 `json:"pseudo_failed" parquet:"name=pseudo_failed, type=INT64"`
-			InvalidChecksum int64 `json:"invalid_checksum" parquet:"name=invalid_checksum, type=INT64"`
-			NoFlow          int64 `json:"no_flow" parquet:"name=no_flow, type=INT64"`
-			Syn             int64 `json:"syn" parquet:"name=syn, type=INT64"`
-			Synack          int64 `json:"synack" parquet:"name=synack, type=INT64"`
-			Rst             int64 `json:"rst" parquet:"name=rst, type=INT64"`
-		} `json:"tcp" parquet:"name=tcp"`
-	} `json:"stats" parquet:"name=stats"`
+			Sessions        int64 `json:"sessions" parquet:"name=sessions, type=INT64" desc:"TCP sessions tracked"`
+			SSNMemcapDrop   int64 `json:"ssn_memcap_drop" parquet:"name=ssn_memcap_drop, type=INT64" desc:"Sessions dropped because stream.memcap was reached"`
+			Pseudo          int64 `json:"pseudo" parquet:"name=pseudo, type=INT64" desc:"Pseudo packets created to flush streams"`
+			PseudoFailed    int64 `json:"pseudo_failed" parquet:"name=pseudo_failed, type=INT64" desc:"Pseudo packets which couldn't be created"`
+			InvalidChecksum int64 `json:"invalid_checksum" parquet:"name=invalid_checksum, type=INT64" desc:"Segments with an invalid checksum"`
+			NoFlow          int64 `json:"no_flow" parquet:"name=no_flow, type=INT64" desc:"Segments which couldn't be assigned a flow"`
+			Syn             int64 `json:"syn" parquet:"name=syn, type=INT64" desc:"SYN packets seen"`
+			Synack          int64 `json:"synack" parquet:"name=synack, type=INT64" desc:"SYN/ACK packets seen"`
+			Rst             int64 `json:"rst" parquet:"name=rst, type=INT64" desc:"RST packets seen"`
+		} `json:"tcp" parquet:"name=tcp" desc:"TCP stream engine counters"`
+	} `json:"stats" parquet:"name=stats" desc:"Suricata engine counters"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
+}
+
+func (e *StatsEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
 }
 
 func (e StatsEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:   e.Timestamp[:10],
+		Hour:   hour,
+		Minute: minute,
 	}
 }
 
+func (e StatsEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// statsEventSchemaChangelog records the columns added in each version of the stats schema, the last entry being the current version
+var statsEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+}
+
+func (e StatsEvent) SchemaVersion() int {
+	return 1
+}
+
+func (e StatsEvent) SchemaChangelog() []SchemaRevision {
+	return statsEventSchemaChangelog
+}
+
 func (e *StatsEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
@@ -0,0 +1,211 @@
+package suricata
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Indicator types. ip and cidr indicators are matched against the source and destination address of every event, domain against
+// dns.rrname, http.hostname and tls.sni, url against the request URL of HTTP events and ja3 against the JA3 and JA3S hashes of TLS events.
+// sha256 indicators are understood by the feed loaders, but no event model has a SHA-256 hash to match them against, so they are skipped.
+const (
+	IndicatorTypeIP     = "ip"
+	IndicatorTypeCIDR   = "cidr"
+	IndicatorTypeDomain = "domain"
+	IndicatorTypeJA3    = "ja3"
+	IndicatorTypeSHA256 = "sha256"
+	IndicatorTypeURL    = "url"
+)
+
+type ThreatIntelModel interface {
+	UpdateThreatIntel(db *ThreatIntelDB) error
+}
+
+type ThreatIntelMatch struct {
+	Indicator     string `json:"indicator" parquet:"name=indicator, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Indicator which matched"`
+	IndicatorType string `json:"indicator_type" parquet:"name=indicator_type, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Type of the indicator, e.g. ip, cidr or domain"`
+	Field         string `json:"field" parquet:"name=field, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Event field the indicator matched"`
+	Source        string `json:"source" parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Feed the indicator came from"`
+	Confidence    int    `json:"confidence" parquet:"name=confidence, type=INT32" desc:"Confidence of the feed in the indicator, 0 to 100"`
+}
+
+type ThreatIntelIndicator struct {
+	Value      string
+	Type       string
+	Source     string
+	Confidence int
+}
+
+// matchedIndicatorTypes are the indicator types some event field is matched against, indicators of any other type are skipped when loaded
+var matchedIndicatorTypes = map[string]bool{
+	IndicatorTypeIP:     true,
+	IndicatorTypeCIDR:   true,
+	IndicatorTypeDomain: true,
+	IndicatorTypeJA3:    true,
+	IndicatorTypeURL:    true,
+}
+
+type cidrIndicator struct {
+	network   *net.IPNet
+	indicator ThreatIntelIndicator
+}
+
+// ThreatIntelDB holds indicators loaded from local feeds. It is read-only once loaded, so it can be shared between workers.
+type ThreatIntelDB struct {
+	indicators map[string]map[string][]ThreatIntelIndicator
+	networks   []cidrIndicator
+	// skipped counts the indicators of each type which weren't added as nothing is matched against them
+	skipped map[string]int
+}
+
+func NewThreatIntelDB() *ThreatIntelDB {
+	return &ThreatIntelDB{
+		indicators: map[string]map[string][]ThreatIntelIndicator{},
+		skipped:    map[string]int{},
+	}
+}
+
+func normalizeIndicator(indicatorType, value string) string {
+	value = strings.TrimSpace(value)
+	switch indicatorType {
+	case IndicatorTypeDomain:
+		return strings.TrimSuffix(strings.ToLower(value), ".")
+	case IndicatorTypeJA3:
+		return strings.ToLower(value)
+	case IndicatorTypeIP:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+	case IndicatorTypeURL:
+		return normalizeURL(value)
+	}
+	return value
+}
+
+// normalizeURL reduces http and https URLs to their host, port and request URI, lowercasing the host and dropping the scheme and its default port,
+// so HTTPS://Example.com:443/a, http://example.com/a and example.com/a all match. URLs with other schemes keep the lowercased scheme.
+func normalizeURL(value string) string {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return value
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	port := parsed.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	normalized := host + parsed.RequestURI()
+	if scheme != "http" && scheme != "https" {
+		normalized = scheme + "://" + normalized
+	}
+	return normalized
+}
+
+// Add adds an indicator, skipping it if its type isn't matched against any event field
+func (db *ThreatIntelDB) Add(indicator ThreatIntelIndicator) error {
+	if !matchedIndicatorTypes[indicator.Type] {
+		db.skipped[indicator.Type]++
+		return nil
+	}
+	if indicator.Type == IndicatorTypeCIDR {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(indicator.Value))
+		if err != nil {
+			return err
+		}
+		db.networks = append(db.networks, cidrIndicator{
+			network:   network,
+			indicator: indicator,
+		})
+		return nil
+	}
+
+	value := normalizeIndicator(indicator.Type, indicator.Value)
+	if _, ok := db.indicators[indicator.Type]; !ok {
+		db.indicators[indicator.Type] = map[string][]ThreatIntelIndicator{}
+	}
+	db.indicators[indicator.Type][value] = append(db.indicators[indicator.Type][value], indicator)
+	return nil
+}
+
+func (db *ThreatIntelDB) Len() int {
+	count := len(db.networks)
+	for _, values := range db.indicators {
+		for _, indicators := range values {
+			count += len(indicators)
+		}
+	}
+	return count
+}
+
+// Skipped returns how many indicators of each type were skipped as no event field is matched against them
+func (db *ThreatIntelDB) Skipped() map[string]int {
+	return db.skipped
+}
+
+func newThreatIntelMatches(field string, indicators []ThreatIntelIndicator) []ThreatIntelMatch {
+	matches := make([]ThreatIntelMatch, 0, len(indicators))
+	for _, indicator := range indicators {
+		matches = append(matches, ThreatIntelMatch{
+			Indicator:     indicator.Value,
+			IndicatorType: indicator.Type,
+			Field:         field,
+			Source:        indicator.Source,
+			Confidence:    indicator.Confidence,
+		})
+	}
+	return matches
+}
+
+func (db *ThreatIntelDB) match(indicatorType, field, value string) []ThreatIntelMatch {
+	if value == "" {
+		return nil
+	}
+	return newThreatIntelMatches(field, db.indicators[indicatorType][normalizeIndicator(indicatorType, value)])
+}
+
+func (db *ThreatIntelDB) MatchIP(field, ipString string) []ThreatIntelMatch {
+	ip := net.ParseIP(ipString)
+	if ip == nil {
+		return nil
+	}
+	matches := db.match(IndicatorTypeIP, field, ip.String())
+	for _, n := range db.networks {
+		if n.network.Contains(ip) {
+			matches = append(matches, newThreatIntelMatches(field, []ThreatIntelIndicator{n.indicator})...)
+		}
+	}
+	return matches
+}
+
+// MatchDomain matches the domain and each of its parent domains, so an indicator for example.com also matches www.example.com
+func (db *ThreatIntelDB) MatchDomain(field, domain string) []ThreatIntelMatch {
+	domain = normalizeIndicator(IndicatorTypeDomain, domain)
+	matches := []ThreatIntelMatch{}
+	for domain != "" {
+		matches = append(matches, db.match(IndicatorTypeDomain, field, domain)...)
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return matches
+}
+
+func (db *ThreatIntelDB) MatchJA3(field, hash string) []ThreatIntelMatch {
+	return db.match(IndicatorTypeJA3, field, hash)
+}
+
+func (db *ThreatIntelDB) MatchURL(field, url string) []ThreatIntelMatch {
+	return db.match(IndicatorTypeURL, field, url)
+}
@@ -0,0 +1,237 @@
+package suricata
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	md5Regex    = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+	sha256Regex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+	// matches a single comparison expression of a STIX pattern, e.g. [domain-name:value = 'example.com']
+	stixComparisonRegex = regexp.MustCompile(`([a-z0-9-]+):([A-Za-z0-9_.'-]+)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+)
+
+// InferIndicatorType guesses the indicator type of a bare value from a plain text feed. 32 character hex strings are treated as JA3 hashes.
+func InferIndicatorType(value string) (string, error) {
+	switch {
+	case net.ParseIP(value) != nil:
+		return IndicatorTypeIP, nil
+	case strings.Contains(value, "/") && !strings.Contains(value, "://"):
+		if _, _, err := net.ParseCIDR(value); err == nil {
+			return IndicatorTypeCIDR, nil
+		}
+	case strings.Contains(value, "://"):
+		return IndicatorTypeURL, nil
+	case sha256Regex.MatchString(value):
+		return IndicatorTypeSHA256, nil
+	case md5Regex.MatchString(value):
+		return IndicatorTypeJA3, nil
+	case strings.Contains(value, ".") && !strings.ContainsAny(value, " /"):
+		return IndicatorTypeDomain, nil
+	}
+	return "", fmt.Errorf("unable to infer indicator type of %q", value)
+}
+
+// LoadThreatIntelFeeds loads every feed into a single database. The format of each feed is taken from its extension: .csv files are CSV with a header row, .json files are STIX 2.1 bundles and anything else is plain text with one indicator per line.
+func LoadThreatIntelFeeds(paths []string, defaultConfidence int) (*ThreatIntelDB, error) {
+	db := NewThreatIntelDB()
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		err := db.LoadFeed(path, defaultConfidence)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load threat intel feed %s: %w", path, err)
+		}
+	}
+	return db, nil
+}
+
+func (db *ThreatIntelDB) LoadFeed(path string, defaultConfidence int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	extension := filepath.Ext(path)
+	source := strings.TrimSuffix(filepath.Base(path), extension)
+
+	switch strings.ToLower(extension) {
+	case ".csv":
+		return db.loadCSVFeed(f, source, defaultConfidence)
+	case ".json":
+		return db.loadSTIXFeed(f, source, defaultConfidence)
+	default:
+		return db.loadPlainTextFeed(f, source, defaultConfidence)
+	}
+}
+
+func (db *ThreatIntelDB) loadPlainTextFeed(r io.Reader, source string, defaultConfidence int) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		indicatorType, err := InferIndicatorType(line)
+		if err != nil {
+			return err
+		}
+		err = db.Add(ThreatIntelIndicator{
+			Value:      line,
+			Type:       indicatorType,
+			Source:     source,
+			Confidence: defaultConfidence,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// loadCSVFeed reads a CSV feed with an "indicator" column and optional "type", "confidence" and "source" columns
+func (db *ThreatIntelDB) loadCSVFeed(r io.Reader, source string, defaultConfidence int) error {
+	csvReader := csv.NewReader(r)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["indicator"]; !ok {
+		return fmt.Errorf("missing indicator column")
+	}
+	column := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		indicator := ThreatIntelIndicator{
+			Value:      column(record, "indicator"),
+			Type:       strings.ToLower(column(record, "type")),
+			Source:     column(record, "source"),
+			Confidence: defaultConfidence,
+		}
+		if indicator.Value == "" {
+			continue
+		}
+		if indicator.Type == "" {
+			indicator.Type, err = InferIndicatorType(indicator.Value)
+			if err != nil {
+				return err
+			}
+		}
+		if indicator.Source == "" {
+			indicator.Source = source
+		}
+		if confidence := column(record, "confidence"); confidence != "" {
+			indicator.Confidence, err = strconv.Atoi(confidence)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = db.Add(indicator)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type stixBundle struct {
+	Type    string `json:"type"`
+	Objects []struct {
+		Type        string `json:"type"`
+		Pattern     string `json:"pattern"`
+		PatternType string `json:"pattern_type"`
+		Confidence  *int   `json:"confidence"`
+	} `json:"objects"`
+}
+
+// loadSTIXFeed reads the indicator objects of a STIX 2.1 bundle. Only simple equality comparisons on ipv4-addr, ipv6-addr, domain-name, url, file hashes and x-ja3-hash objects are understood; anything else in a pattern is ignored.
+func (db *ThreatIntelDB) loadSTIXFeed(r io.Reader, source string, defaultConfidence int) error {
+	bundle := stixBundle{}
+	err := json.NewDecoder(r).Decode(&bundle)
+	if err != nil {
+		return err
+	}
+	if bundle.Type != "bundle" {
+		return fmt.Errorf("expected a STIX bundle, got type %q", bundle.Type)
+	}
+
+	for _, object := range bundle.Objects {
+		if object.Type != "indicator" || (object.PatternType != "" && object.PatternType != "stix") {
+			continue
+		}
+		confidence := defaultConfidence
+		if object.Confidence != nil {
+			confidence = *object.Confidence
+		}
+
+		for _, comparison := range stixComparisonRegex.FindAllStringSubmatch(object.Pattern, -1) {
+			objectType, property, value := comparison[1], comparison[2], strings.ReplaceAll(comparison[3], `\'`, `'`)
+
+			indicatorType := ""
+			switch {
+			case (objectType == "ipv4-addr" || objectType == "ipv6-addr") && property == "value":
+				indicatorType = IndicatorTypeIP
+				if strings.Contains(value, "/") {
+					indicatorType = IndicatorTypeCIDR
+				}
+			case objectType == "domain-name" && property == "value":
+				indicatorType = IndicatorTypeDomain
+			case objectType == "url" && property == "value":
+				indicatorType = IndicatorTypeURL
+			case objectType == "file" && (property == "hashes.'SHA-256'" || property == "hashes.SHA256"):
+				indicatorType = IndicatorTypeSHA256
+			case objectType == "x-ja3-hash" && property == "value":
+				indicatorType = IndicatorTypeJA3
+			default:
+				continue
+			}
+
+			err = db.Add(ThreatIntelIndicator{
+				Value:      value,
+				Type:       indicatorType,
+				Source:     source,
+				Confidence: confidence,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
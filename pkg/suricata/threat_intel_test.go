@@ -0,0 +1,109 @@
+package suricata
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{url: "example.com/path", expected: "example.com/path"},
+		{url: "http://example.com/path", expected: "example.com/path"},
+		{url: "HTTP://Example.COM/Path", expected: "example.com/Path"},
+		{url: "https://example.com./", expected: "example.com/"},
+		{url: "http://example.com:80/a?b=c", expected: "example.com/a?b=c"},
+		{url: "https://example.com:443/a", expected: "example.com/a"},
+		{url: "http://example.com:443/a", expected: "example.com:443/a"},
+		{url: "https://example.com:8443/a", expected: "example.com:8443/a"},
+		{url: "http://example.com", expected: "example.com/"},
+		{url: "http://[2001:DB8::1]:80/a", expected: "[2001:db8::1]/a"},
+		{url: "http://[2001:db8::1]:8080/a", expected: "[2001:db8::1]:8080/a"},
+		{url: "FTP://Example.com/file", expected: "ftp://example.com/file"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if normalized := normalizeURL(test.url); normalized != test.expected {
+				t.Errorf("normalized to %s, expected %s", normalized, test.expected)
+			}
+		})
+	}
+}
+
+func TestHTTPEventURLThreatIntel(t *testing.T) {
+	db := NewThreatIntelDB()
+	err := db.Add(ThreatIntelIndicator{Value: "https://Evil.example.com/payload.exe", Type: IndicatorTypeURL, Source: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringPointer := func(s string) *string {
+		return &s
+	}
+	intPointer := func(i int) *int {
+		return &i
+	}
+	tests := []struct {
+		name     string
+		hostname string
+		port     *int
+		url      *string
+		matched  bool
+	}{
+		{name: "request target", hostname: "evil.example.com", url: stringPointer("/payload.exe"), matched: true},
+		{name: "default port", hostname: "EVIL.example.com", port: intPointer(80), url: stringPointer("/payload.exe"), matched: true},
+		{name: "absolute url", hostname: "evil.example.com", url: stringPointer("http://evil.example.com:80/payload.exe"), matched: true},
+		{name: "other port", hostname: "evil.example.com", port: intPointer(8080), url: stringPointer("/payload.exe")},
+		{name: "other path", hostname: "evil.example.com", url: stringPointer("/index.html")},
+		{name: "no url", hostname: "evil.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := HTTPEvent{}
+			e.SrcIP = "10.0.0.1"
+			e.DestIP = "10.0.0.2"
+			e.HTTP.Hostname = stringPointer(test.hostname)
+			e.HTTP.HTTPPort = test.port
+			e.HTTP.URL = test.url
+			err := e.UpdateThreatIntel(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			urlMatches := 0
+			for _, match := range e.ThreatIntelMatches {
+				if match.Field == "http.url" {
+					urlMatches++
+				}
+			}
+			if (urlMatches == 1) != test.matched || urlMatches > 1 {
+				t.Errorf("%d matches on http.url, expected matched %v", urlMatches, test.matched)
+			}
+		})
+	}
+}
+
+func TestThreatIntelDBSkipsUnmatchedTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.csv")
+	content := "indicator,type\n10.0.0.1,\nevil.example.com,\n" + strings.Repeat("ab", 32) + ",\n" + strings.Repeat("cd", 32) + ",sha256\nsomething,email\n"
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := LoadThreatIntelFeeds([]string{path}, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 2 {
+		t.Errorf("loaded %d indicators, expected 2", db.Len())
+	}
+	if expected := map[string]int{IndicatorTypeSHA256: 2, "email": 1}; !reflect.DeepEqual(db.Skipped(), expected) {
+		t.Errorf("skipped %v, expected %v", db.Skipped(), expected)
+	}
+	if matches := db.MatchDomain("dns.rrname", "www.evil.example.com"); len(matches) != 1 {
+		t.Errorf("%d matches for a subdomain of a loaded domain, expected 1", len(matches))
+	}
+}
@@ -0,0 +1,112 @@
+package suricata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	certificateTimeLayout = "2006-01-02T15:04:05"
+)
+
+type JA3Model interface {
+	UpdateJA3Labels(labels *JA3Labels) error
+}
+
+type CertificateModel interface {
+	UpdateCertificateData() error
+}
+
+type CertificateData struct {
+	NotBefore            int64 `json:"not_before" parquet:"name=not_before, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Start of the certificate's validity"`
+	NotAfter             int64 `json:"not_after" parquet:"name=not_after, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"End of the certificate's validity"`
+	ValidityDays         int   `json:"validity_days" parquet:"name=validity_days, type=INT32" desc:"Length of the certificate's validity in days"`
+	DaysToExpiry         int   `json:"days_to_expiry" parquet:"name=days_to_expiry, type=INT32" desc:"Days from the event until the certificate expires, negative once expired"`
+	ExpiredAtObservation bool  `json:"expired_at_observation" parquet:"name=expired_at_observation, type=BOOLEAN" desc:"Whether the certificate had expired when the event was logged"`
+	SelfSigned           bool  `json:"self_signed" parquet:"name=self_signed, type=BOOLEAN" desc:"Whether the subject and issuer are the same"`
+}
+
+type JA3Data struct {
+	JA3Label  string `json:"ja3_label" parquet:"name=ja3_label, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Known client the JA3 hash belongs to"`
+	JA3SLabel string `json:"ja3s_label" parquet:"name=ja3s_label, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Known server the JA3S hash belongs to"`
+}
+
+// GetCertificateData derives validity information from the certificate fields Suricata logs, relative to the time the certificate was observed. Suricata logs notbefore/notafter in UTC without a zone.
+// It returns nil if either is missing, as there is no certificate to derive anything from.
+func GetCertificateData(subject, issuerDN, notBefore, notAfter string, observed time.Time) (*CertificateData, error) {
+	if notBefore == "" || notAfter == "" {
+		return nil, nil
+	}
+
+	notBeforeTime, err := time.Parse(certificateTimeLayout, notBefore)
+	if err != nil {
+		return nil, err
+	}
+	notAfterTime, err := time.Parse(certificateTimeLayout, notAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &CertificateData{}
+	d.NotBefore = notBeforeTime.UnixMilli()
+	d.NotAfter = notAfterTime.UnixMilli()
+	d.ValidityDays = int(notAfterTime.Sub(notBeforeTime).Hours() / 24)
+	d.DaysToExpiry = int(notAfterTime.Sub(observed).Hours() / 24)
+	d.ExpiredAtObservation = observed.After(notAfterTime)
+	d.SelfSigned = subject != "" && subject == issuerDN
+
+	return d, nil
+}
+
+// JA3Labels maps JA3 and JA3S hashes to the name of the client or server known to produce them
+type JA3Labels struct {
+	labels map[string]string
+}
+
+// LoadJA3Labels reads a CSV file of hash,label rows. A header row is optional.
+func LoadJA3Labels(path string) (*JA3Labels, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1
+
+	l := &JA3Labels{
+		labels: map[string]string{},
+	}
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("expected hash,label but got %q", strings.Join(record, ","))
+		}
+		hash := strings.ToLower(strings.TrimSpace(record[0]))
+		if !md5Regex.MatchString(hash) {
+			// most likely the header row
+			continue
+		}
+		l.labels[hash] = strings.TrimSpace(record[1])
+	}
+	return l, nil
+}
+
+func (l *JA3Labels) Len() int {
+	return len(l.labels)
+}
+
+func (l *JA3Labels) Lookup(hash string) string {
+	return l.labels[strings.ToLower(hash)]
+}
@@ -0,0 +1,133 @@
+package suricata
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCertificateData(t *testing.T) {
+	observed := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		subject   string
+		issuerDN  string
+		notBefore string
+		notAfter  string
+		expected  *CertificateData
+		err       string
+	}{
+		{name: "no certificate"},
+		{name: "no notafter", notBefore: "2024-01-01T00:00:00"},
+		{
+			name:      "valid",
+			subject:   "CN=example.com",
+			issuerDN:  "CN=Example CA",
+			notBefore: "2024-01-01T00:00:00",
+			notAfter:  "2024-12-31T00:00:00",
+			expected: &CertificateData{
+				NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+				NotAfter:     time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC).UnixMilli(),
+				ValidityDays: 365,
+				DaysToExpiry: 212,
+			},
+		},
+		{
+			name:      "expired and self signed",
+			subject:   "CN=router.local",
+			issuerDN:  "CN=router.local",
+			notBefore: "2023-01-01T00:00:00",
+			notAfter:  "2024-05-01T00:00:00",
+			expected: &CertificateData{
+				NotBefore:            time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+				NotAfter:             time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+				ValidityDays:         486,
+				DaysToExpiry:         -31,
+				ExpiredAtObservation: true,
+				SelfSigned:           true,
+			},
+		},
+		{name: "invalid notbefore", notBefore: "2024-01-01", notAfter: "2024-12-31T00:00:00", err: `parsing time "2024-01-01"`},
+		{name: "invalid notafter", notBefore: "2024-01-01T00:00:00", notAfter: "2024-12-31 00:00:00", err: `parsing time "2024-12-31 00:00:00"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := GetCertificateData(test.subject, test.issuerDN, test.notBefore, test.notAfter, observed)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("error is %v, expected it to contain %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data, test.expected) {
+				t.Errorf("certificate data is %+v, expected %+v", data, test.expected)
+			}
+		})
+	}
+}
+
+func TestTLSEventUpdateCertificateData(t *testing.T) {
+	stringPointer := func(s string) *string {
+		return &s
+	}
+	e := TLSEvent{Timestamp: "2024-06-01T14:00:00.000000+0200"}
+	err := e.UpdateCertificateData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.CertificateData != nil {
+		t.Errorf("event without a certificate has certificate data %+v", e.CertificateData)
+	}
+
+	e.TLS.NotBefore = stringPointer("2024-01-01T00:00:00")
+	e.TLS.NotAfter = stringPointer("2024-06-01T13:00:00")
+	err = e.UpdateCertificateData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the event was logged at 12:00 UTC, before the certificate expired
+	if e.CertificateData == nil || e.CertificateData.ExpiredAtObservation {
+		t.Errorf("certificate data is %+v, expected it not yet expired", e.CertificateData)
+	}
+}
+
+func TestLoadJA3Labels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ja3.csv")
+	content := "hash,label\n# known clients\ne7d705a3286e19ea42f587b344ee6865, Tor Browser \n6734F37431670B3AB4292B8F60F29984,Trickbot\n"
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, err := LoadJA3Labels(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels.Len() != 2 {
+		t.Errorf("loaded %d labels, expected 2", labels.Len())
+	}
+	for hash, expected := range map[string]string{
+		"e7d705a3286e19ea42f587b344ee6865": "Tor Browser",
+		"6734f37431670b3ab4292b8f60f29984": "Trickbot",
+		"6734F37431670B3AB4292B8F60F29984": "Trickbot",
+		"00000000000000000000000000000000": "",
+	} {
+		if label := labels.Lookup(hash); label != expected {
+			t.Errorf("%s is labeled %q, expected %q", hash, label, expected)
+		}
+	}
+
+	err = os.WriteFile(path, []byte("e7d705a3286e19ea42f587b344ee6865\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadJA3Labels(path)
+	if err == nil || !strings.Contains(err.Error(), "expected hash,label") {
+		t.Errorf("error is %v, expected a missing label to be rejected", err)
+	}
+}
@@ -9,48 +9,60 @@ import (
 )
 
 type TLSEvent struct {
-	Timestamp string `json:"timestamp"`
-	EventTime int64  `parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
-	EventType string `json:"event_type"`
-	SrcIP     string `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DestIP    string `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
-	SrcPort   int    `json:"src_port" parquet:"name=src_port, type=INT32"`
-	DestPort  int    `json:"dest_port" parquet:"name=dest_port, type=INT32"`
-	Proto     string `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	AppProto  string `json:"app_proto" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8"`
-	FlowID    int64  `json:"flow_id" parquet:"name=flow_id, type=INT64"`
-	InIface   string `json:"in_iface" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8"`
-	Vlan      int    `json:"vlan" parquet:"name=vlan, type=INT32"`
-	TxID      int    `json:"tx_id" parquet:"name=tx_id, type=INT32"`
+	Timestamp   string  `json:"timestamp"`
+	EventTime   int64   `json:"event_time" parquet:"name=event_time, type=INT64, convertedtype=TIMESTAMP_MILLIS" desc:"Time Suricata logged the event"`
+	EventType   string  `json:"event_type"`
+	SrcIP       string  `json:"src_ip" parquet:"name=src_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Source IP address"`
+	DestIP      string  `json:"dest_ip" parquet:"name=dest_ip, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Destination IP address"`
+	SrcPort     *int    `json:"src_port,omitempty" parquet:"name=src_port, type=INT32, repetitiontype=OPTIONAL" desc:"Source port"`
+	DestPort    *int    `json:"dest_port,omitempty" parquet:"name=dest_port, type=INT32, repetitiontype=OPTIONAL" desc:"Destination port"`
+	Proto       string  `json:"proto" parquet:"name=proto, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Transport protocol, e.g. TCP, UDP or ICMP"`
+	AppProto    *string `json:"app_proto,omitempty" parquet:"name=app_proto, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Application protocol Suricata detected on the flow"`
+	FlowID      int64   `json:"flow_id" parquet:"name=flow_id, type=INT64" desc:"Suricata flow ID, shared by every event of the same flow"`
+	InIface     *string `json:"in_iface,omitempty" parquet:"name=in_iface, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Interface the packets were captured on"`
+	Vlan        []int   `json:"vlan,omitempty" parquet:"name=vlan, type=MAP, convertedtype=LIST, valuetype=INT32" desc:"VLAN IDs the packets are tagged with, outermost first"`
+	TxID        *int    `json:"tx_id,omitempty" parquet:"name=tx_id, type=INT32, repetitiontype=OPTIONAL" desc:"ID of the application layer transaction within the flow"`
+	ICMPType    int     `json:"icmp_type"`
+	ICMPCode    int     `json:"icmp_code"`
+	CommunityID string  `json:"community_id" parquet:"name=community_id, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Community ID flow hash, for correlating with other tools"`
+	Host        string  `json:"host"`
 
 	Traffic *struct {
-		ID    []string `json:"id" parquet:"name=id, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
-		Label []string `json:"label" parquet:"name=label, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
-	} `json:"traffic" parquet:"name=traffic"`
+		ID    []string `json:"id" parquet:"name=id, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" desc:"Traffic IDs the flow was tagged with by the rules"`
+		Label []string `json:"label" parquet:"name=label, type=MAP, convertedtype=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8" desc:"Traffic labels the flow was tagged with by the rules"`
+	} `json:"traffic,omitempty" parquet:"name=traffic, repetitiontype=OPTIONAL" desc:"Traffic IDs and labels of the flow"`
 
 	TLS struct {
-		Subject     string `json:"subject" parquet:"name=subject, type=BYTE_ARRAY, convertedtype=UTF8"`
-		IssuerDN    string `json:"issuerdn" parquet:"name=issuerdn, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Serial      string `json:"serial" parquet:"name=serial, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Fingerprint string `json:"fingerprint" parquet:"name=fingerprint, type=BYTE_ARRAY, convertedtype=UTF8"`
-		SNI         string `json:"sni" parquet:"name=sni, type=BYTE_ARRAY, convertedtype=UTF8"`
-		Version     string `json:"version" parquet:"name=version, type=BYTE_ARRAY, convertedtype=UTF8"`
-		NotBefore   string `json:"notbefore" parquet:"name=notbefore, type=BYTE_ARRAY, convertedtype=UTF8"`
-		NotAfter    string `json:"notafter" parquet:"name=notafter, type=BYTE_ARRAY, convertedtype=UTF8"`
-		JA3         struct {
-			Hash   string `json:"hash" parquet:"name=hash, type=BYTE_ARRAY, convertedtype=UTF8"`
-			String string `json:"string" parquet:"name=string, type=BYTE_ARRAY, convertedtype=UTF8"`
-		} `json:"ja3" parquet:"name=ja3"`
-		JA3S struct {
-			Hash   string `json:"hash" parquet:"name=hash, type=BYTE_ARRAY, convertedtype=UTF8"`
-			String string `json:"string" parquet:"name=string, type=BYTE_ARRAY, convertedtype=UTF8"`
-		} `json:"ja3s" parquet:"name=ja3s"`
-	} `json:"tls" parquet:"name=tls"`
+		Subject     *string `json:"subject,omitempty" parquet:"name=subject, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Subject of the server certificate"`
+		IssuerDN    *string `json:"issuerdn,omitempty" parquet:"name=issuerdn, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Issuer of the server certificate"`
+		Serial      *string `json:"serial,omitempty" parquet:"name=serial, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Serial number of the server certificate"`
+		Fingerprint *string `json:"fingerprint,omitempty" parquet:"name=fingerprint, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"SHA-1 fingerprint of the server certificate"`
+		SNI         *string `json:"sni,omitempty" parquet:"name=sni, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Server name indication sent by the client"`
+		Version     string  `json:"version" parquet:"name=version, type=BYTE_ARRAY, convertedtype=UTF8" desc:"Negotiated TLS version"`
+		NotBefore   *string `json:"notbefore,omitempty" parquet:"name=notbefore, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"Start of the server certificate's validity"`
+		NotAfter    *string `json:"notafter,omitempty" parquet:"name=notafter, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL" desc:"End of the server certificate's validity"`
+		JA3         *struct {
+			Hash   string `json:"hash" parquet:"name=hash, type=BYTE_ARRAY, convertedtype=UTF8" desc:"MD5 of the JA3 string"`
+			String string `json:"string" parquet:"name=string, type=BYTE_ARRAY, convertedtype=UTF8" desc:"JA3 string of the client hello"`
+		} `json:"ja3,omitempty" parquet:"name=ja3, repetitiontype=OPTIONAL" desc:"JA3 fingerprint of the client hello"`
+		JA3S *struct {
+			Hash   string `json:"hash" parquet:"name=hash, type=BYTE_ARRAY, convertedtype=UTF8" desc:"MD5 of the JA3S string"`
+			String string `json:"string" parquet:"name=string, type=BYTE_ARRAY, convertedtype=UTF8" desc:"JA3S string of the server hello"`
+		} `json:"ja3s,omitempty" parquet:"name=ja3s, repetitiontype=OPTIONAL" desc:"JA3S fingerprint of the server hello"`
+	} `json:"tls" parquet:"name=tls" desc:"TLS handshake details"`
 
 	GeoIPData struct {
-		Source GeoIPData `json:"source" parquet:"name=source"`
-		Dest   GeoIPData `json:"dest" parquet:"name=dest"`
-	} `json:"geoip_data" parquet:"name=geoip_data"`
+		Source GeoIPData `json:"source" parquet:"name=source" desc:"GeoIP location of the source address"`
+		Dest   GeoIPData `json:"dest" parquet:"name=dest" desc:"GeoIP location of the destination address"`
+	} `json:"geoip_data" parquet:"name=geoip_data" desc:"GeoIP enrichment of the source and destination addresses"`
+
+	DomainData      DomainData       `json:"domain_data" parquet:"name=domain_data" desc:"Breakdown of the queried domain name"`
+	CertificateData *CertificateData `json:"certificate_data,omitempty" parquet:"name=certificate_data, repetitiontype=OPTIONAL" desc:"Validity of the server certificate, NULL when it has no validity period"`
+	JA3Data         JA3Data          `json:"ja3_data" parquet:"name=ja3_data" desc:"Known clients and servers matching the JA3 and JA3S hashes"`
+
+	ThreatIntelMatches []ThreatIntelMatch `json:"ti_matches" parquet:"name=ti_matches, type=LIST" desc:"Threat intel indicators the event matched"`
+
+	SensorData SensorData `json:"sensor" parquet:"name=sensor" desc:"Sensor which captured the event"`
 }
 
 func (e *TLSEvent) UpdateGeoIP(reader *geoip2.Reader) error {
@@ -67,14 +79,92 @@ func (e *TLSEvent) UpdateGeoIP(reader *geoip2.Reader) error {
 	return nil
 }
 
+func (e *TLSEvent) UpdateDomainData(psl *PublicSuffixList) error {
+	if e.TLS.SNI == nil {
+		return nil
+	}
+	e.DomainData = psl.GetDomainData(*e.TLS.SNI)
+	return nil
+}
+
+func (e *TLSEvent) UpdateJA3Labels(labels *JA3Labels) error {
+	if e.TLS.JA3 != nil {
+		e.JA3Data.JA3Label = labels.Lookup(e.TLS.JA3.Hash)
+	}
+	if e.TLS.JA3S != nil {
+		e.JA3Data.JA3SLabel = labels.Lookup(e.TLS.JA3S.Hash)
+	}
+	return nil
+}
+
+func (e *TLSEvent) UpdateThreatIntel(db *ThreatIntelDB) error {
+	e.ThreatIntelMatches = []ThreatIntelMatch{}
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("src_ip", e.SrcIP)...)
+	e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchIP("dest_ip", e.DestIP)...)
+	if e.TLS.SNI != nil {
+		e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchDomain("tls.sni", *e.TLS.SNI)...)
+	}
+	if e.TLS.JA3 != nil {
+		e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchJA3("tls.ja3.hash", e.TLS.JA3.Hash)...)
+	}
+	if e.TLS.JA3S != nil {
+		e.ThreatIntelMatches = append(e.ThreatIntelMatches, db.MatchJA3("tls.ja3s.hash", e.TLS.JA3S.Hash)...)
+	}
+	return nil
+}
+
+// UpdateCommunityID computes the Community ID of the flow, unless Suricata already included one in the event
+func (e *TLSEvent) UpdateCommunityID(seed uint16) error {
+	if e.CommunityID != "" {
+		return nil
+	}
+	srcPort, destPort := communityIDPorts(e.Proto, e.SrcPort, e.DestPort, e.ICMPType, e.ICMPCode)
+	communityID, err := CommunityID(seed, e.SrcIP, e.DestIP, srcPort, destPort, e.Proto)
+	if err != nil {
+		return err
+	}
+	e.CommunityID = communityID
+	return nil
+}
+
+func (e *TLSEvent) UpdateSensorData(identity *SensorIdentity) error {
+	e.SensorData = GetSensorData(identity, e.Host)
+	return nil
+}
+
 func (e TLSEvent) GetDateHourKey() storage.DateHourKey {
 	hour, _ := strconv.Atoi(e.Timestamp[11:13])
+	minute, _ := strconv.Atoi(e.Timestamp[14:16])
 	return storage.DateHourKey{
-		Date: e.Timestamp[:10],
-		Hour: hour,
+		Date:    e.Timestamp[:10],
+		Hour:    hour,
+		Minute:  minute,
+		InIface: stringValue(e.InIface),
+		Vlan:    outerVlan(e.Vlan),
 	}
 }
 
+func (e TLSEvent) GetEventTime() int64 {
+	return e.EventTime
+}
+
+// tlsEventSchemaChangelog records the columns added in each version of the tls schema, the last entry being the current version
+var tlsEventSchemaChangelog = []SchemaRevision{
+	initialSchemaRevision,
+	{
+		Version:     2,
+		Description: "src_port, dest_port, tx_id, app_proto, in_iface, traffic, tls.sni, tls.ja3, tls.ja3s and the certificate fields of tls are NULL when absent from the EVE record, rather than 0 or an empty string. app_proto is only logged once a protocol is detected, in_iface only for live captures and ja3 and ja3s only when JA3 fingerprinting is enabled. tls.version stays REQUIRED as Suricata logs it for every handshake. certificate_data is NULL when the certificate has no notbefore or notafter, rather than zero timestamps which read as 1970. vlan is the list of VLAN IDs Suricata logs, outermost first and empty for untagged traffic, rather than an int which no tagged event could be decoded into. Files written before have to be migrated, as Athena can't read their int vlan as an array",
+	},
+}
+
+func (e TLSEvent) SchemaVersion() int {
+	return 2
+}
+
+func (e TLSEvent) SchemaChangelog() []SchemaRevision {
+	return tlsEventSchemaChangelog
+}
+
 func (e *TLSEvent) UpdateFields() error {
 	parsedTime, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
 	if err != nil {
@@ -83,3 +173,12 @@ func (e *TLSEvent) UpdateFields() error {
 	e.EventTime = parsedTime.UTC().UnixMilli()
 	return nil
 }
+
+func (e *TLSEvent) UpdateCertificateData() error {
+	observed, err := time.Parse("2006-01-02T15:04:05.999999-0700", e.Timestamp)
+	if err != nil {
+		return err
+	}
+	e.CertificateData, err = GetCertificateData(stringValue(e.TLS.Subject), stringValue(e.TLS.IssuerDN), stringValue(e.TLS.NotBefore), stringValue(e.TLS.NotAfter), observed)
+	return err
+}
@@ -5,7 +5,9 @@ resource "aws_glue_catalog_table" "alert_events" {
   table_type    = "EXTERNAL_TABLE"
   parameters = {
     EXTERNAL                         = "TRUE"
+    "parquet.block.size"             = "134217728"
     "parquet.compression"            = "SNAPPY"
+    "parquet.page.size"              = "8192"
     "projection.enabled"             = "true"
     "projection.event_date.format"   = "yyyy-MM-dd"
     "projection.event_date.range"    = "NOW-1YEARS,NOW"
@@ -13,6 +15,7 @@ resource "aws_glue_catalog_table" "alert_events" {
     "projection.event_hour.interval" = "1"
     "projection.event_hour.range"    = "0,23"
     "projection.event_hour.type"     = "integer"
+    "surithena.schema_version"       = "2"
   }
 
   storage_descriptor {
@@ -31,67 +34,146 @@ resource "aws_glue_catalog_table" "alert_events" {
     columns {
       name    = "event_time"
       type    = "timestamp"
-      comment = ""
+      comment = "Time Suricata logged the event"
     }
     columns {
       name    = "src_ip"
       type    = "string"
-      comment = ""
+      comment = "Source IP address"
     }
     columns {
       name    = "dest_ip"
       type    = "string"
-      comment = ""
+      comment = "Destination IP address"
     }
     columns {
       name    = "src_port"
       type    = "int"
-      comment = ""
+      comment = "Source port"
     }
     columns {
       name    = "dest_port"
       type    = "int"
-      comment = ""
+      comment = "Destination port"
     }
     columns {
       name    = "proto"
       type    = "string"
-      comment = ""
+      comment = "Transport protocol, e.g. TCP, UDP or ICMP"
     }
     columns {
       name    = "app_proto"
       type    = "string"
-      comment = ""
+      comment = "Application protocol Suricata detected on the flow"
     }
     columns {
       name    = "flow_id"
       type    = "bigint"
-      comment = ""
+      comment = "Suricata flow ID, shared by every event of the same flow"
     }
     columns {
       name    = "in_iface"
       type    = "string"
-      comment = ""
+      comment = "Interface the packets were captured on"
     }
     columns {
       name    = "vlan"
-      type    = "int"
-      comment = ""
+      type    = "array<int>"
+      comment = "VLAN IDs the packets are tagged with, outermost first"
     }
     columns {
       name    = "tx_id"
       type    = "int"
-      comment = ""
+      comment = "ID of the application layer transaction within the flow"
+    }
+    columns {
+      name    = "community_id"
+      type    = "string"
+      comment = "Community ID flow hash, for correlating with other tools"
     }
     columns {
       name    = "alert"
       type    = "struct<action:string,gid:int,signature_id:int,rev:int,app_proto:string,signature:string,severity:int,source:struct<ip:string,port:int>,target:struct<ip:string,port:int>>"
-      comment = ""
+      comment = "Details of the signature which fired"
+      parameters = {
+        "comment.action"       = "Action taken, allowed or blocked"
+        "comment.app_proto"    = "Application protocol of the alert"
+        "comment.gid"          = "Generator ID of the signature"
+        "comment.rev"          = "Revision of the rule"
+        "comment.severity"     = "Severity of the rule, 1 being the highest"
+        "comment.signature"    = "Message of the rule"
+        "comment.signature_id" = "Signature ID (SID) of the rule"
+        "comment.source"       = "Endpoint the rule marks as the source of the attack"
+        "comment.source.ip"    = "IP address of the attack source"
+        "comment.source.port"  = "Port of the attack source"
+        "comment.target"       = "Endpoint the rule marks as the target of the attack"
+        "comment.target.ip"    = "IP address of the attack target"
+        "comment.target.port"  = "Port of the attack target"
+      }
     }
     columns {
       name    = "geoip_data"
       type    = "struct<source:struct<city_name:string,continent_code:string,continent_name:string,country_iso_code:string,country_name:string,latitude:double,longitude:double,location_accuracy_radius:int,time_zone:string,postal_code:string,is_anonymous_proxy:boolean,is_satellite_provider:boolean,subdivisions:array<struct<iso_code:string,name:string>>>,dest:struct<city_name:string,continent_code:string,continent_name:string,country_iso_code:string,country_name:string,latitude:double,longitude:double,location_accuracy_radius:int,time_zone:string,postal_code:string,is_anonymous_proxy:boolean,is_satellite_provider:boolean,subdivisions:array<struct<iso_code:string,name:string>>>>"
-      comment = ""
+      comment = "GeoIP enrichment of the source and destination addresses"
+      parameters = {
+        "comment.dest"                            = "GeoIP location of the destination address"
+        "comment.dest.city_name"                  = "City name"
+        "comment.dest.continent_code"             = "Two letter continent code"
+        "comment.dest.continent_name"             = "Continent name"
+        "comment.dest.country_iso_code"           = "ISO 3166-1 country code"
+        "comment.dest.country_name"               = "Country name"
+        "comment.dest.is_anonymous_proxy"         = "Whether the address belongs to an anonymous proxy"
+        "comment.dest.is_satellite_provider"      = "Whether the address belongs to a satellite provider"
+        "comment.dest.latitude"                   = "Approximate latitude"
+        "comment.dest.location_accuracy_radius"   = "Radius in kilometers the location is accurate to"
+        "comment.dest.longitude"                  = "Approximate longitude"
+        "comment.dest.postal_code"                = "Postal code"
+        "comment.dest.subdivisions"               = "Subdivisions such as states or provinces, largest first"
+        "comment.dest.subdivisions.iso_code"      = "ISO 3166-2 subdivision code"
+        "comment.dest.subdivisions.name"          = "Subdivision name"
+        "comment.dest.time_zone"                  = "IANA time zone of the location"
+        "comment.source"                          = "GeoIP location of the source address"
+        "comment.source.city_name"                = "City name"
+        "comment.source.continent_code"           = "Two letter continent code"
+        "comment.source.continent_name"           = "Continent name"
+        "comment.source.country_iso_code"         = "ISO 3166-1 country code"
+        "comment.source.country_name"             = "Country name"
+        "comment.source.is_anonymous_proxy"       = "Whether the address belongs to an anonymous proxy"
+        "comment.source.is_satellite_provider"    = "Whether the address belongs to a satellite provider"
+        "comment.source.latitude"                 = "Approximate latitude"
+        "comment.source.location_accuracy_radius" = "Radius in kilometers the location is accurate to"
+        "comment.source.longitude"                = "Approximate longitude"
+        "comment.source.postal_code"              = "Postal code"
+        "comment.source.subdivisions"             = "Subdivisions such as states or provinces, largest first"
+        "comment.source.subdivisions.iso_code"    = "ISO 3166-2 subdivision code"
+        "comment.source.subdivisions.name"        = "Subdivision name"
+        "comment.source.time_zone"                = "IANA time zone of the location"
+      }
+    }
+    columns {
+      name    = "ti_matches"
+      type    = "array<struct<indicator:string,indicator_type:string,field:string,source:string,confidence:int>>"
+      comment = "Threat intel indicators the event matched"
+      parameters = {
+        "comment.confidence"     = "Confidence of the feed in the indicator, 0 to 100"
+        "comment.field"          = "Event field the indicator matched"
+        "comment.indicator"      = "Indicator which matched"
+        "comment.indicator_type" = "Type of the indicator, e.g. ip, cidr or domain"
+        "comment.source"         = "Feed the indicator came from"
+      }
+    }
+    columns {
+      name    = "sensor"
+      type    = "struct<name:string,hostname:string,site:string,tags:array<string>,eve_host:string,source:string>"
+      comment = "Sensor which captured the event"
+      parameters = {
+        "comment.eve_host" = "Host field Suricata wrote in the event"
+        "comment.hostname" = "Hostname of the machine running eve-processor"
+        "comment.name"     = "Name the sensor is configured with"
+        "comment.site"     = "Site the sensor is deployed at"
+        "comment.source"   = "EVE source the event was read from"
+        "comment.tags"     = "Tags the sensor is configured with"
+      }
     }
   }
 
@@ -0,0 +1,368 @@
+resource "aws_athena_workgroup" "surithena" {
+  name = "surithena"
+  configuration {
+    enforce_workgroup_configuration    = true
+    publish_cloudwatch_metrics_enabled = true
+    bytes_scanned_cutoff_per_query     = 10737418240
+    result_configuration {
+      output_location = "s3://${var.bucket_name}/athena-results/"
+      encryption_configuration {
+        encryption_option = "SSE_S3"
+      }
+    }
+  }
+}
+
+resource "aws_athena_named_query" "alert_flows" {
+  name        = "alert_flows"
+  description = "Alerts joined to the flow they fired on by flow_id, with the flow's packet and byte counts"
+  workgroup   = aws_athena_workgroup.surithena.id
+  database    = aws_glue_catalog_database.surithena.name
+  query       = <<EOT
+SELECT
+  a.event_time,
+  a.flow_id,
+  a.src_ip,
+  a.src_port,
+  a.dest_ip,
+  a.dest_port,
+  a.proto,
+  a.app_proto,
+  a.alert.signature_id AS signature_id,
+  a.alert.signature AS signature,
+  a.alert.severity AS severity,
+  a.alert.action AS action,
+  f.flow.pkts_toserver AS pkts_toserver,
+  f.flow.pkts_toclient AS pkts_toclient,
+  f.flow.bytes_toserver AS bytes_toserver,
+  f.flow.bytes_toclient AS bytes_toclient,
+  f.flow.start AS flow_start,
+  f.flow."end" AS flow_end,
+  f.flow.state AS flow_state
+FROM alert_events a
+LEFT JOIN flow_events f
+  ON f.flow_id = a.flow_id
+  -- flows are logged when they end, which can be a while after the alert
+  AND f.event_date BETWEEN a.event_date AND a.event_date + INTERVAL '1' DAY
+EOT
+}
+
+resource "aws_glue_catalog_table" "alert_flows" {
+  name          = "alert_flows"
+  database_name = aws_glue_catalog_database.surithena.name
+  description   = "Alerts joined to the flow they fired on by flow_id, with the flow's packet and byte counts"
+  table_type    = "VIRTUAL_VIEW"
+  view_original_text = format("/* Presto View: %s */", base64encode(jsonencode({
+    originalSql = <<EOT
+SELECT
+  a.event_time,
+  a.flow_id,
+  a.src_ip,
+  a.src_port,
+  a.dest_ip,
+  a.dest_port,
+  a.proto,
+  a.app_proto,
+  a.alert.signature_id AS signature_id,
+  a.alert.signature AS signature,
+  a.alert.severity AS severity,
+  a.alert.action AS action,
+  f.flow.pkts_toserver AS pkts_toserver,
+  f.flow.pkts_toclient AS pkts_toclient,
+  f.flow.bytes_toserver AS bytes_toserver,
+  f.flow.bytes_toclient AS bytes_toclient,
+  f.flow.start AS flow_start,
+  f.flow."end" AS flow_end,
+  f.flow.state AS flow_state
+FROM alert_events a
+LEFT JOIN flow_events f
+  ON f.flow_id = a.flow_id
+  -- flows are logged when they end, which can be a while after the alert
+  AND f.event_date BETWEEN a.event_date AND a.event_date + INTERVAL '1' DAY
+EOT
+    catalog     = "awsdatacatalog"
+    schema      = aws_glue_catalog_database.surithena.name
+    columns = [
+      { name = "event_time", type = "timestamp" },
+      { name = "flow_id", type = "bigint" },
+      { name = "src_ip", type = "varchar" },
+      { name = "src_port", type = "integer" },
+      { name = "dest_ip", type = "varchar" },
+      { name = "dest_port", type = "integer" },
+      { name = "proto", type = "varchar" },
+      { name = "app_proto", type = "varchar" },
+      { name = "signature_id", type = "integer" },
+      { name = "signature", type = "varchar" },
+      { name = "severity", type = "integer" },
+      { name = "action", type = "varchar" },
+      { name = "pkts_toserver", type = "bigint" },
+      { name = "pkts_toclient", type = "bigint" },
+      { name = "bytes_toserver", type = "bigint" },
+      { name = "bytes_toclient", type = "bigint" },
+      { name = "flow_start", type = "varchar" },
+      { name = "flow_end", type = "varchar" },
+      { name = "flow_state", type = "varchar" },
+    ]
+  })))
+  view_expanded_text = "/* Presto View */"
+  parameters = {
+    comment     = "Presto View"
+    presto_view = "true"
+  }
+  storage_descriptor {
+    columns {
+      name = "event_time"
+      type = "timestamp"
+    }
+    columns {
+      name = "flow_id"
+      type = "bigint"
+    }
+    columns {
+      name = "src_ip"
+      type = "string"
+    }
+    columns {
+      name = "src_port"
+      type = "int"
+    }
+    columns {
+      name = "dest_ip"
+      type = "string"
+    }
+    columns {
+      name = "dest_port"
+      type = "int"
+    }
+    columns {
+      name = "proto"
+      type = "string"
+    }
+    columns {
+      name = "app_proto"
+      type = "string"
+    }
+    columns {
+      name = "signature_id"
+      type = "int"
+    }
+    columns {
+      name = "signature"
+      type = "string"
+    }
+    columns {
+      name = "severity"
+      type = "int"
+    }
+    columns {
+      name = "action"
+      type = "string"
+    }
+    columns {
+      name = "pkts_toserver"
+      type = "bigint"
+    }
+    columns {
+      name = "pkts_toclient"
+      type = "bigint"
+    }
+    columns {
+      name = "bytes_toserver"
+      type = "bigint"
+    }
+    columns {
+      name = "bytes_toclient"
+      type = "bigint"
+    }
+    columns {
+      name = "flow_start"
+      type = "string"
+    }
+    columns {
+      name = "flow_end"
+      type = "string"
+    }
+    columns {
+      name = "flow_state"
+      type = "string"
+    }
+  }
+}
+
+resource "aws_athena_named_query" "dns_nxdomain_spikes" {
+  name        = "dns_nxdomain_spikes"
+  description = "Hours in the last week where a client's NXDOMAIN answers were well above its hourly average, a sign of domain generation algorithms or misconfiguration"
+  workgroup   = aws_athena_workgroup.surithena.id
+  database    = aws_glue_catalog_database.surithena.name
+  query       = <<EOT
+WITH hourly AS (
+  SELECT
+    src_ip,
+    date_trunc('hour', event_time) AS hour,
+    count(*) AS nxdomains,
+    count(DISTINCT domain_data.registered_domain) AS registered_domains
+  FROM dns_events
+  WHERE dns.type = 'answer'
+    AND dns.rcode = 'NXDOMAIN'
+    AND event_time >= current_timestamp - INTERVAL '7' DAY
+    AND event_date >= current_date - INTERVAL '7' DAY
+  GROUP BY src_ip, date_trunc('hour', event_time)
+),
+baseline AS (
+  SELECT
+    src_ip,
+    avg(nxdomains) AS average_nxdomains,
+    stddev_pop(nxdomains) AS stddev_nxdomains
+  FROM hourly
+  GROUP BY src_ip
+)
+SELECT
+  h.src_ip,
+  h.hour,
+  h.nxdomains,
+  h.registered_domains,
+  b.average_nxdomains
+FROM hourly h
+JOIN baseline b ON b.src_ip = h.src_ip
+WHERE h.nxdomains >= 20
+  AND h.nxdomains > b.average_nxdomains + 3 * b.stddev_nxdomains
+ORDER BY h.nxdomains DESC
+EOT
+}
+
+resource "aws_athena_named_query" "expiring_certificates" {
+  name        = "expiring_certificates"
+  description = "Server certificates seen in the last week which expire within 30 days, or already have"
+  workgroup   = aws_athena_workgroup.surithena.id
+  database    = aws_glue_catalog_database.surithena.name
+  query       = <<EOT
+SELECT
+  tls.fingerprint AS fingerprint,
+  arbitrary(tls.subject) AS subject,
+  arbitrary(tls.issuerdn) AS issuerdn,
+  arbitrary(tls.sni) AS sni,
+  max(certificate_data.not_after) AS not_after,
+  date_diff('day', CAST(current_timestamp AS timestamp), max(certificate_data.not_after)) AS days_to_expiry,
+  bool_or(certificate_data.self_signed) AS self_signed,
+  count(DISTINCT dest_ip) AS servers,
+  count(*) AS connections,
+  max(event_time) AS last_seen
+FROM tls_events
+WHERE certificate_data.not_after <= CAST(current_timestamp + INTERVAL '30' DAY AS timestamp)
+  AND tls.fingerprint <> ''
+  AND event_time >= current_timestamp - INTERVAL '7' DAY
+  AND event_date >= current_date - INTERVAL '7' DAY
+GROUP BY tls.fingerprint
+EOT
+}
+
+resource "aws_glue_catalog_table" "expiring_certificates" {
+  name          = "expiring_certificates"
+  database_name = aws_glue_catalog_database.surithena.name
+  description   = "Server certificates seen in the last week which expire within 30 days, or already have"
+  table_type    = "VIRTUAL_VIEW"
+  view_original_text = format("/* Presto View: %s */", base64encode(jsonencode({
+    originalSql = <<EOT
+SELECT
+  tls.fingerprint AS fingerprint,
+  arbitrary(tls.subject) AS subject,
+  arbitrary(tls.issuerdn) AS issuerdn,
+  arbitrary(tls.sni) AS sni,
+  max(certificate_data.not_after) AS not_after,
+  date_diff('day', CAST(current_timestamp AS timestamp), max(certificate_data.not_after)) AS days_to_expiry,
+  bool_or(certificate_data.self_signed) AS self_signed,
+  count(DISTINCT dest_ip) AS servers,
+  count(*) AS connections,
+  max(event_time) AS last_seen
+FROM tls_events
+WHERE certificate_data.not_after <= CAST(current_timestamp + INTERVAL '30' DAY AS timestamp)
+  AND tls.fingerprint <> ''
+  AND event_time >= current_timestamp - INTERVAL '7' DAY
+  AND event_date >= current_date - INTERVAL '7' DAY
+GROUP BY tls.fingerprint
+EOT
+    catalog     = "awsdatacatalog"
+    schema      = aws_glue_catalog_database.surithena.name
+    columns = [
+      { name = "fingerprint", type = "varchar" },
+      { name = "subject", type = "varchar" },
+      { name = "issuerdn", type = "varchar" },
+      { name = "sni", type = "varchar" },
+      { name = "not_after", type = "timestamp" },
+      { name = "days_to_expiry", type = "bigint" },
+      { name = "self_signed", type = "boolean" },
+      { name = "servers", type = "bigint" },
+      { name = "connections", type = "bigint" },
+      { name = "last_seen", type = "timestamp" },
+    ]
+  })))
+  view_expanded_text = "/* Presto View */"
+  parameters = {
+    comment     = "Presto View"
+    presto_view = "true"
+  }
+  storage_descriptor {
+    columns {
+      name = "fingerprint"
+      type = "string"
+    }
+    columns {
+      name = "subject"
+      type = "string"
+    }
+    columns {
+      name = "issuerdn"
+      type = "string"
+    }
+    columns {
+      name = "sni"
+      type = "string"
+    }
+    columns {
+      name = "not_after"
+      type = "timestamp"
+    }
+    columns {
+      name = "days_to_expiry"
+      type = "bigint"
+    }
+    columns {
+      name = "self_signed"
+      type = "boolean"
+    }
+    columns {
+      name = "servers"
+      type = "bigint"
+    }
+    columns {
+      name = "connections"
+      type = "bigint"
+    }
+    columns {
+      name = "last_seen"
+      type = "timestamp"
+    }
+  }
+}
+
+resource "aws_athena_named_query" "top_talkers" {
+  name        = "top_talkers"
+  description = "Source addresses sending the most bytes over the last day"
+  workgroup   = aws_athena_workgroup.surithena.id
+  database    = aws_glue_catalog_database.surithena.name
+  query       = <<EOT
+SELECT
+  src_ip,
+  count(*) AS flows,
+  count(DISTINCT dest_ip) AS destinations,
+  sum(flow.bytes_toserver) AS bytes_sent,
+  sum(flow.bytes_toclient) AS bytes_received,
+  sum(flow.bytes_toserver + flow.bytes_toclient) AS bytes_total
+FROM flow_events
+WHERE event_time >= current_timestamp - INTERVAL '1' DAY
+  AND event_date >= current_date - INTERVAL '1' DAY
+GROUP BY src_ip
+ORDER BY bytes_total DESC
+LIMIT 50
+EOT
+}
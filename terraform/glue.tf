@@ -1,3 +1,3 @@
 resource "aws_glue_catalog_database" "surithena" {
   name = "surithena"
-}
\ No newline at end of file
+}
@@ -5,7 +5,9 @@ resource "aws_glue_catalog_table" "http_events" {
   table_type    = "EXTERNAL_TABLE"
   parameters = {
     EXTERNAL                         = "TRUE"
+    "parquet.block.size"             = "134217728"
     "parquet.compression"            = "SNAPPY"
+    "parquet.page.size"              = "8192"
     "projection.enabled"             = "true"
     "projection.event_date.format"   = "yyyy-MM-dd"
     "projection.event_date.range"    = "NOW-1YEARS,NOW"
@@ -13,6 +15,7 @@ resource "aws_glue_catalog_table" "http_events" {
     "projection.event_hour.interval" = "1"
     "projection.event_hour.range"    = "0,23"
     "projection.event_hour.type"     = "integer"
+    "surithena.schema_version"       = "2"
   }
 
   storage_descriptor {
@@ -31,67 +34,180 @@ resource "aws_glue_catalog_table" "http_events" {
     columns {
       name    = "event_time"
       type    = "timestamp"
-      comment = ""
+      comment = "Time Suricata logged the event"
     }
     columns {
       name    = "src_ip"
       type    = "string"
-      comment = ""
+      comment = "Source IP address"
     }
     columns {
       name    = "dest_ip"
       type    = "string"
-      comment = ""
+      comment = "Destination IP address"
     }
     columns {
       name    = "src_port"
       type    = "int"
-      comment = ""
+      comment = "Source port"
     }
     columns {
       name    = "dest_port"
       type    = "int"
-      comment = ""
+      comment = "Destination port"
     }
     columns {
       name    = "proto"
       type    = "string"
-      comment = ""
+      comment = "Transport protocol, e.g. TCP, UDP or ICMP"
     }
     columns {
       name    = "app_proto"
       type    = "string"
-      comment = ""
+      comment = "Application protocol Suricata detected on the flow"
     }
     columns {
       name    = "flow_id"
       type    = "bigint"
-      comment = ""
+      comment = "Suricata flow ID, shared by every event of the same flow"
     }
     columns {
       name    = "in_iface"
       type    = "string"
-      comment = ""
+      comment = "Interface the packets were captured on"
     }
     columns {
       name    = "vlan"
-      type    = "int"
-      comment = ""
+      type    = "array<int>"
+      comment = "VLAN IDs the packets are tagged with, outermost first"
     }
     columns {
       name    = "tx_id"
       type    = "int"
-      comment = ""
+      comment = "ID of the application layer transaction within the flow"
+    }
+    columns {
+      name    = "community_id"
+      type    = "string"
+      comment = "Community ID flow hash, for correlating with other tools"
     }
     columns {
       name    = "http"
       type    = "struct<http_port:int,hostname:string,url:string,http_user_agent:string,http_content_type:string,http_refer:string,http_method:string,protocol:string,status:int,length:int>"
-      comment = ""
+      comment = "HTTP transaction details"
+      parameters = {
+        "comment.hostname"          = "Host header of the request"
+        "comment.http_content_type" = "Content-Type header of the response"
+        "comment.http_method"       = "Request method, e.g. GET or POST"
+        "comment.http_port"         = "Port of the HTTP server"
+        "comment.http_refer"        = "Referer header of the request"
+        "comment.http_user_agent"   = "User-Agent header of the request"
+        "comment.length"            = "Length of the response body in bytes"
+        "comment.protocol"          = "HTTP version, e.g. HTTP/1.1"
+        "comment.status"            = "Response status code"
+        "comment.url"               = "URL of the request"
+      }
     }
     columns {
       name    = "geoip_data"
       type    = "struct<source:struct<city_name:string,continent_code:string,continent_name:string,country_iso_code:string,country_name:string,latitude:double,longitude:double,location_accuracy_radius:int,time_zone:string,postal_code:string,is_anonymous_proxy:boolean,is_satellite_provider:boolean,subdivisions:array<struct<iso_code:string,name:string>>>,dest:struct<city_name:string,continent_code:string,continent_name:string,country_iso_code:string,country_name:string,latitude:double,longitude:double,location_accuracy_radius:int,time_zone:string,postal_code:string,is_anonymous_proxy:boolean,is_satellite_provider:boolean,subdivisions:array<struct<iso_code:string,name:string>>>>"
-      comment = ""
+      comment = "GeoIP enrichment of the source and destination addresses"
+      parameters = {
+        "comment.dest"                            = "GeoIP location of the destination address"
+        "comment.dest.city_name"                  = "City name"
+        "comment.dest.continent_code"             = "Two letter continent code"
+        "comment.dest.continent_name"             = "Continent name"
+        "comment.dest.country_iso_code"           = "ISO 3166-1 country code"
+        "comment.dest.country_name"               = "Country name"
+        "comment.dest.is_anonymous_proxy"         = "Whether the address belongs to an anonymous proxy"
+        "comment.dest.is_satellite_provider"      = "Whether the address belongs to a satellite provider"
+        "comment.dest.latitude"                   = "Approximate latitude"
+        "comment.dest.location_accuracy_radius"   = "Radius in kilometers the location is accurate to"
+        "comment.dest.longitude"                  = "Approximate longitude"
+        "comment.dest.postal_code"                = "Postal code"
+        "comment.dest.subdivisions"               = "Subdivisions such as states or provinces, largest first"
+        "comment.dest.subdivisions.iso_code"      = "ISO 3166-2 subdivision code"
+        "comment.dest.subdivisions.name"          = "Subdivision name"
+        "comment.dest.time_zone"                  = "IANA time zone of the location"
+        "comment.source"                          = "GeoIP location of the source address"
+        "comment.source.city_name"                = "City name"
+        "comment.source.continent_code"           = "Two letter continent code"
+        "comment.source.continent_name"           = "Continent name"
+        "comment.source.country_iso_code"         = "ISO 3166-1 country code"
+        "comment.source.country_name"             = "Country name"
+        "comment.source.is_anonymous_proxy"       = "Whether the address belongs to an anonymous proxy"
+        "comment.source.is_satellite_provider"    = "Whether the address belongs to a satellite provider"
+        "comment.source.latitude"                 = "Approximate latitude"
+        "comment.source.location_accuracy_radius" = "Radius in kilometers the location is accurate to"
+        "comment.source.longitude"                = "Approximate longitude"
+        "comment.source.postal_code"              = "Postal code"
+        "comment.source.subdivisions"             = "Subdivisions such as states or provinces, largest first"
+        "comment.source.subdivisions.iso_code"    = "ISO 3166-2 subdivision code"
+        "comment.source.subdivisions.name"        = "Subdivision name"
+        "comment.source.time_zone"                = "IANA time zone of the location"
+      }
+    }
+    columns {
+      name    = "domain_data"
+      type    = "struct<registered_domain:string,public_suffix:string,subdomain:string,label_count:int,entropy:double>"
+      comment = "Breakdown of the queried domain name"
+      parameters = {
+        "comment.entropy"           = "Shannon entropy of the domain, high for generated domains"
+        "comment.label_count"       = "Number of labels in the domain"
+        "comment.public_suffix"     = "Public suffix of the domain, e.g. co.uk"
+        "comment.registered_domain" = "Domain registered under the public suffix, e.g. example.co.uk"
+        "comment.subdomain"         = "Labels in front of the registered domain"
+      }
+    }
+    columns {
+      name    = "url_data"
+      type    = "struct<path:string,decoded_path:string,query:string,decoded_query:string,query_keys:array<string>,file_extension:string>"
+      comment = "Breakdown of the request URL"
+      parameters = {
+        "comment.decoded_path"   = "Path with percent encoding decoded"
+        "comment.decoded_query"  = "Query string with percent encoding decoded"
+        "comment.file_extension" = "Extension of the last path segment"
+        "comment.path"           = "Path of the URL"
+        "comment.query"          = "Query string of the URL"
+        "comment.query_keys"     = "Names of the query parameters"
+      }
+    }
+    columns {
+      name    = "user_agent_data"
+      type    = "struct<browser_family:string,browser_version:string,os_family:string,device_family:string,is_scripted:boolean>"
+      comment = "Classification of the User-Agent header"
+      parameters = {
+        "comment.browser_family"  = "Browser family, e.g. Chrome or Firefox"
+        "comment.browser_version" = "Browser version"
+        "comment.device_family"   = "Device family"
+        "comment.is_scripted"     = "Whether the client is a script or command line tool such as curl"
+        "comment.os_family"       = "Operating system family"
+      }
+    }
+    columns {
+      name    = "ti_matches"
+      type    = "array<struct<indicator:string,indicator_type:string,field:string,source:string,confidence:int>>"
+      comment = "Threat intel indicators the event matched"
+      parameters = {
+        "comment.confidence"     = "Confidence of the feed in the indicator, 0 to 100"
+        "comment.field"          = "Event field the indicator matched"
+        "comment.indicator"      = "Indicator which matched"
+        "comment.indicator_type" = "Type of the indicator, e.g. ip, cidr or domain"
+        "comment.source"         = "Feed the indicator came from"
+      }
+    }
+    columns {
+      name    = "sensor"
+      type    = "struct<name:string,hostname:string,site:string,tags:array<string>,eve_host:string,source:string>"
+      comment = "Sensor which captured the event"
+      parameters = {
+        "comment.eve_host" = "Host field Suricata wrote in the event"
+        "comment.hostname" = "Hostname of the machine running eve-processor"
+        "comment.name"     = "Name the sensor is configured with"
+        "comment.site"     = "Site the sensor is deployed at"
+        "comment.source"   = "EVE source the event was read from"
+        "comment.tags"     = "Tags the sensor is configured with"
+      }
     }
   }
 
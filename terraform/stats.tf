@@ -5,7 +5,9 @@ resource "aws_glue_catalog_table" "stats_events" {
   table_type    = "EXTERNAL_TABLE"
   parameters = {
     EXTERNAL                         = "TRUE"
+    "parquet.block.size"             = "134217728"
     "parquet.compression"            = "SNAPPY"
+    "parquet.page.size"              = "8192"
     "projection.enabled"             = "true"
     "projection.event_date.format"   = "yyyy-MM-dd"
     "projection.event_date.range"    = "NOW-1YEARS,NOW"
@@ -13,6 +15,7 @@ resource "aws_glue_catalog_table" "stats_events" {
     "projection.event_hour.interval" = "1"
     "projection.event_hour.range"    = "0,23"
     "projection.event_hour.type"     = "integer"
+    "surithena.schema_version"       = "1"
   }
 
   storage_descriptor {
@@ -31,12 +34,88 @@ resource "aws_glue_catalog_table" "stats_events" {
     columns {
       name    = "event_time"
       type    = "timestamp"
-      comment = ""
+      comment = "Time Suricata logged the event"
     }
     columns {
       name    = "stats"
       type    = "struct<uptime:bigint,capture:struct<kernel_packets:bigint,kernel_drops:bigint,errors:bigint>,decoder:struct<pkts:bigint,bytes:bigint,invalid:bigint,ipv4:bigint,ipv6:bigint,ethernet:bigint,chdlc:bigint,raw:bigint,null:bigint,sll:bigint,tcp:bigint,udp:bigint,sctp:bigint,icmpv4:bigint,icmpv6:bigint,ppp:bigint,pppoe:bigint,geneve:bigint,gre:bigint,vlan:bigint,vlan_qinq:bigint,vxlan:bigint,vntag:bigint,ieee8021ah:bigint,teredo:bigint,ipv4_in_ipv6:bigint,ipv6_in_ipv6:bigint,mpls:bigint,avg_packet_size:bigint,max_packet_size:bigint,max_mac_addrs_src:bigint,max_mac_addrs_dst:bigint,erspan:bigint>,flow:struct<memcap:bigint,tcp:bigint,udp:bigint,icmpv4:bigint,icmpv6:bigint,tcp_reuse:bigint,get_used:bigint,get_used_eval:bigint,get_used_eval_reject:bigint,get_used_eval_busy:bigint,get_used_failed:bigint>,tcp:struct<sessions:bigint,ssn_memcap_drop:bigint,pseudo:bigint,pseudo_failed:bigint,invalid_checksum:bigint,no_flow:bigint,syn:bigint,synack:bigint,rst:bigint>>"
-      comment = ""
+      comment = "Suricata engine counters"
+      parameters = {
+        "comment.capture"                   = "Packet capture counters"
+        "comment.capture.errors"            = "Capture errors"
+        "comment.capture.kernel_drops"      = "Packets the kernel dropped before Suricata read them"
+        "comment.capture.kernel_packets"    = "Packets the kernel delivered to Suricata"
+        "comment.decoder"                   = "Packet decoder counters"
+        "comment.decoder.avg_packet_size"   = "Average packet size in bytes"
+        "comment.decoder.bytes"             = "Bytes decoded"
+        "comment.decoder.chdlc"             = "Cisco HDLC frames decoded"
+        "comment.decoder.erspan"            = "ERSPAN encapsulated packets decoded"
+        "comment.decoder.ethernet"          = "Ethernet frames decoded"
+        "comment.decoder.geneve"            = "Geneve encapsulated packets decoded"
+        "comment.decoder.gre"               = "GRE encapsulated packets decoded"
+        "comment.decoder.icmpv4"            = "ICMPv4 packets decoded"
+        "comment.decoder.icmpv6"            = "ICMPv6 packets decoded"
+        "comment.decoder.ieee8021ah"        = "IEEE 802.1ah provider backbone bridge frames decoded"
+        "comment.decoder.invalid"           = "Packets which failed to decode"
+        "comment.decoder.ipv4"              = "IPv4 packets decoded"
+        "comment.decoder.ipv4_in_ipv6"      = "IPv4 in IPv6 tunneled packets decoded"
+        "comment.decoder.ipv6"              = "IPv6 packets decoded"
+        "comment.decoder.ipv6_in_ipv6"      = "IPv6 in IPv6 tunneled packets decoded"
+        "comment.decoder.max_mac_addrs_dst" = "Most destination MAC addresses seen on a single flow"
+        "comment.decoder.max_mac_addrs_src" = "Most source MAC addresses seen on a single flow"
+        "comment.decoder.max_packet_size"   = "Largest packet size in bytes"
+        "comment.decoder.mpls"              = "MPLS packets decoded"
+        "comment.decoder.null"              = "BSD loopback frames decoded"
+        "comment.decoder.pkts"              = "Packets decoded"
+        "comment.decoder.ppp"               = "PPP frames decoded"
+        "comment.decoder.pppoe"             = "PPPoE frames decoded"
+        "comment.decoder.raw"               = "Raw IP packets decoded"
+        "comment.decoder.sctp"              = "SCTP packets decoded"
+        "comment.decoder.sll"               = "Linux cooked capture frames decoded"
+        "comment.decoder.tcp"               = "TCP segments decoded"
+        "comment.decoder.teredo"            = "Teredo tunneled packets decoded"
+        "comment.decoder.udp"               = "UDP datagrams decoded"
+        "comment.decoder.vlan"              = "VLAN tagged frames decoded"
+        "comment.decoder.vlan_qinq"         = "QinQ double tagged frames decoded"
+        "comment.decoder.vntag"             = "VN-Tag frames decoded"
+        "comment.decoder.vxlan"             = "VXLAN encapsulated packets decoded"
+        "comment.flow"                      = "Flow engine counters"
+        "comment.flow.get_used"             = "Flows taken from the hash when no spare flow was free"
+        "comment.flow.get_used_eval"        = "Flows evaluated as candidates for reuse"
+        "comment.flow.get_used_eval_busy"   = "Reuse candidates skipped because another thread held them"
+        "comment.flow.get_used_eval_reject" = "Reuse candidates rejected because they were still active"
+        "comment.flow.get_used_failed"      = "Times no flow could be reused, dropping the packet's flow"
+        "comment.flow.icmpv4"               = "ICMPv4 flows created"
+        "comment.flow.icmpv6"               = "ICMPv6 flows created"
+        "comment.flow.memcap"               = "Flows which couldn't be created because flow.memcap was reached"
+        "comment.flow.tcp"                  = "TCP flows created"
+        "comment.flow.tcp_reuse"            = "TCP flows reused for a new session on the same tuple"
+        "comment.flow.udp"                  = "UDP flows created"
+        "comment.tcp"                       = "TCP stream engine counters"
+        "comment.tcp.invalid_checksum"      = "Segments with an invalid checksum"
+        "comment.tcp.no_flow"               = "Segments which couldn't be assigned a flow"
+        "comment.tcp.pseudo"                = "Pseudo packets created to flush streams"
+        "comment.tcp.pseudo_failed"         = "Pseudo packets which couldn't be created"
+        "comment.tcp.rst"                   = "RST packets seen"
+        "comment.tcp.sessions"              = "TCP sessions tracked"
+        "comment.tcp.ssn_memcap_drop"       = "Sessions dropped because stream.memcap was reached"
+        "comment.tcp.syn"                   = "SYN packets seen"
+        "comment.tcp.synack"                = "SYN/ACK packets seen"
+        "comment.uptime"                    = "Seconds since Suricata started"
+      }
+    }
+    columns {
+      name    = "sensor"
+      type    = "struct<name:string,hostname:string,site:string,tags:array<string>,eve_host:string,source:string>"
+      comment = "Sensor which captured the event"
+      parameters = {
+        "comment.eve_host" = "Host field Suricata wrote in the event"
+        "comment.hostname" = "Hostname of the machine running eve-processor"
+        "comment.name"     = "Name the sensor is configured with"
+        "comment.site"     = "Site the sensor is deployed at"
+        "comment.source"   = "EVE source the event was read from"
+        "comment.tags"     = "Tags the sensor is configured with"
+      }
     }
   }
 